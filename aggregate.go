@@ -0,0 +1,247 @@
+package indexmap
+
+import "cmp"
+
+// Accumulator folds the values of a group into a result.
+// Retract undoes Add for a value added before, that keeps the result
+// up to date when values are updated or removed.
+type Accumulator[V any] interface {
+	Add(value *V)
+	Retract(value *V)
+	Result() any
+}
+
+// Reducer creates the Accumulator of a new group.
+type Reducer[V any] func() Accumulator[V]
+
+// Number is the constraint of the values Sum and Avg add up.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// aggregateIndex maintains the accumulators of every group,
+// it's added as index so it's kept up to date on every insert, update and remove.
+type aggregateIndex[V any] struct {
+	groupBy  func(value *V) any
+	reducers []Reducer[V]
+
+	groups map[any]*aggregateGroup[V]
+}
+
+type aggregateGroup[V any] struct {
+	count        int
+	accumulators []Accumulator[V]
+}
+
+func (index *aggregateIndex[V]) insert(elem *V) {
+	key := index.groupBy(elem)
+	group, ok := index.groups[key]
+	if !ok {
+		group = &aggregateGroup[V]{accumulators: make([]Accumulator[V], len(index.reducers))}
+		for i, reducer := range index.reducers {
+			group.accumulators[i] = reducer()
+		}
+		index.groups[key] = group
+	}
+	group.count++
+	for _, accumulator := range group.accumulators {
+		accumulator.Add(elem)
+	}
+}
+
+func (index *aggregateIndex[V]) remove(elem *V) {
+	key := index.groupBy(elem)
+	group, ok := index.groups[key]
+	if !ok {
+		return
+	}
+	group.count--
+	if group.count == 0 {
+		delete(index.groups, key)
+		return
+	}
+	for _, accumulator := range group.accumulators {
+		accumulator.Retract(elem)
+	}
+}
+
+func (index *aggregateIndex[V]) clear() {
+	index.groups = make(map[any]*aggregateGroup[V])
+}
+
+func (group *aggregateGroup[V]) results() []any {
+	results := make([]any, len(group.accumulators))
+	for i, accumulator := range group.accumulators {
+		results[i] = accumulator.Result()
+	}
+	return results
+}
+
+// AddAggregate adds an aggregate maintained on every insert, update and remove,
+// the values are grouped by the key groupBy returns, and every group is
+// folded by the reducers, like
+//
+//	imap.AddAggregate("ageByCity", groupByCity, Count[Person](), Sum(age), Max(age))
+//
+// The aggregate shares the names with the indexes,
+// the return value indicates whether it was added, false if the name existed.
+func (imap *IndexMap[K, V]) AddAggregate(name string, groupBy func(value *V) any, reducers ...Reducer[V]) bool {
+	return imap.AddIndex(name, &aggregateIndex[V]{
+		groupBy:  groupBy,
+		reducers: reducers,
+		groups:   make(map[any]*aggregateGroup[V]),
+	})
+}
+
+// Aggregate returns the results of the reducers of the named aggregate for the group
+// in the order they were added, in O(1) for the built-in reducers.
+// nil if the aggregate or the group doesn't exist.
+func (imap *IndexMap[K, V]) Aggregate(name string, group any) []any {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[name].(*aggregateIndex[V])
+	if !ok {
+		return nil
+	}
+	g, ok := index.groups[group]
+	if !ok {
+		return nil
+	}
+	return g.results()
+}
+
+// AggregateGroups returns the results of the named aggregate for all groups,
+// nil if the aggregate doesn't exist.
+func (imap *IndexMap[K, V]) AggregateGroups(name string) map[any][]any {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[name].(*aggregateIndex[V])
+	if !ok {
+		return nil
+	}
+	results := make(map[any][]any, len(index.groups))
+	for key, group := range index.groups {
+		results[key] = group.results()
+	}
+	return results
+}
+
+type countAccumulator[V any] struct {
+	count int
+}
+
+func (acc *countAccumulator[V]) Add(*V)      { acc.count++ }
+func (acc *countAccumulator[V]) Retract(*V)  { acc.count-- }
+func (acc *countAccumulator[V]) Result() any { return acc.count }
+
+// Count counts the values of a group, the result is an int.
+func Count[V any]() Reducer[V] {
+	return func() Accumulator[V] {
+		return &countAccumulator[V]{}
+	}
+}
+
+type sumAccumulator[V any, N Number] struct {
+	field func(value *V) N
+	sum   N
+}
+
+func (acc *sumAccumulator[V, N]) Add(value *V)     { acc.sum += acc.field(value) }
+func (acc *sumAccumulator[V, N]) Retract(value *V) { acc.sum -= acc.field(value) }
+func (acc *sumAccumulator[V, N]) Result() any      { return acc.sum }
+
+// Sum adds up the field of the values of a group, the result has the type of the field.
+func Sum[V any, N Number](field func(value *V) N) Reducer[V] {
+	return func() Accumulator[V] {
+		return &sumAccumulator[V, N]{field: field}
+	}
+}
+
+type avgAccumulator[V any, N Number] struct {
+	field func(value *V) N
+	sum   float64
+	count int
+}
+
+func (acc *avgAccumulator[V, N]) Add(value *V) {
+	acc.sum += float64(acc.field(value))
+	acc.count++
+}
+
+func (acc *avgAccumulator[V, N]) Retract(value *V) {
+	acc.sum -= float64(acc.field(value))
+	acc.count--
+}
+
+func (acc *avgAccumulator[V, N]) Result() any {
+	if acc.count == 0 {
+		return 0.0
+	}
+	return acc.sum / float64(acc.count)
+}
+
+// Avg averages the field of the values of a group, the result is a float64.
+func Avg[V any, N Number](field func(value *V) N) Reducer[V] {
+	return func() Accumulator[V] {
+		return &avgAccumulator[V, N]{field: field}
+	}
+}
+
+// extremeAccumulator keeps the minimum or maximum,
+// retracting it recalculates from the counted distinct field values.
+type extremeAccumulator[V any, T cmp.Ordered] struct {
+	field  func(value *V) T
+	sign   int // 1 for the maximum, -1 for the minimum
+	counts map[T]int
+	result T
+}
+
+func (acc *extremeAccumulator[V, T]) Add(value *V) {
+	field := acc.field(value)
+	if len(acc.counts) == 0 || cmp.Compare(field, acc.result)*acc.sign > 0 {
+		acc.result = field
+	}
+	acc.counts[field]++
+}
+
+func (acc *extremeAccumulator[V, T]) Retract(value *V) {
+	field := acc.field(value)
+	acc.counts[field]--
+	if acc.counts[field] > 0 {
+		return
+	}
+	delete(acc.counts, field)
+	if field != acc.result {
+		return
+	}
+	first := true
+	for other := range acc.counts {
+		if first || cmp.Compare(other, acc.result)*acc.sign > 0 {
+			acc.result, first = other, false
+		}
+	}
+}
+
+func (acc *extremeAccumulator[V, T]) Result() any {
+	return acc.result
+}
+
+// Min keeps the minimum field of the values of a group, the result has the type of the field.
+// Retracting the minimum costs O(distinct field values of the group).
+func Min[V any, T cmp.Ordered](field func(value *V) T) Reducer[V] {
+	return func() Accumulator[V] {
+		return &extremeAccumulator[V, T]{field: field, sign: -1, counts: make(map[T]int)}
+	}
+}
+
+// Max keeps the maximum field of the values of a group, the result has the type of the field.
+// Retracting the maximum costs O(distinct field values of the group).
+func Max[V any, T cmp.Ordered](field func(value *V) T) Reducer[V] {
+	return func() Accumulator[V] {
+		return &extremeAccumulator[V, T]{field: field, sign: 1, counts: make(map[T]int)}
+	}
+}
@@ -0,0 +1,134 @@
+package indexmap
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const AgeByCity = "ageByCity"
+
+func personAge(value *Person) int {
+	return value.Age
+}
+
+func addAgeByCity(imap *IndexMap[int64, Person]) bool {
+	return imap.AddAggregate(AgeByCity, func(value *Person) any {
+		return value.City
+	}, Count[Person](), Sum(personAge), Min(personAge), Max(personAge), Avg(personAge))
+}
+
+func checkAgeByCity(t *testing.T, imap *IndexMap[int64, Person]) {
+	groups := 0
+	for _, city := range cities {
+		persons := imap.GetAllBy(CityIndex, city)
+		if len(persons) == 0 {
+			assert.Nil(t, imap.Aggregate(AgeByCity, city), city)
+			continue
+		}
+		groups++
+
+		sum, minAge, maxAge := 0, persons[0].Age, persons[0].Age
+		for _, person := range persons {
+			sum += person.Age
+			minAge = min(minAge, person.Age)
+			maxAge = max(maxAge, person.Age)
+		}
+		results := imap.Aggregate(AgeByCity, city)
+		assert.Equal(t, []any{len(persons), sum, minAge, maxAge}, results[:4], city)
+		assert.InDelta(t, float64(sum)/float64(len(persons)), results[4], 1e-9, city)
+	}
+	assert.Len(t, imap.AggregateGroups(AgeByCity), groups)
+}
+
+func TestAggregate(t *testing.T) {
+	imap := CreateTestMap(1000)
+	assert.True(t, addAgeByCity(imap))
+	assert.False(t, addAgeByCity(imap))
+	checkAgeByCity(t, imap)
+
+	myRand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		id := int64(myRand.Intn(1000))
+		switch myRand.Intn(3) {
+		case 0:
+			imap.Remove(id)
+		case 1:
+			imap.Update(id, func(value *Person) (*Person, bool) {
+				if value == nil {
+					return nil, false
+				}
+				value.Age = myRand.Intn(100)
+				value.City = cities[myRand.Intn(len(cities))]
+				return value, true
+			})
+		default:
+			InsertRandomDataFrom(imap, int(id), 1)
+		}
+	}
+	checkAgeByCity(t, imap)
+
+	imap.RemoveBy(CityIndex, cities[0])
+	assert.Nil(t, imap.Aggregate(AgeByCity, cities[0]))
+	checkAgeByCity(t, imap)
+
+	imap.Clear()
+	assert.Empty(t, imap.AggregateGroups(AgeByCity))
+}
+
+func TestAggregate_Retract(t *testing.T) {
+	imap := CreateTestMap(0)
+	addAgeByCity(imap)
+	for i, age := range []int{30, 10, 50, 10, 50} {
+		imap.Insert(&Person{ID: int64(i), Age: age, City: "Berlin"})
+	}
+	assert.Equal(t, []any{5, 150, 10, 50, 30.0}, imap.Aggregate(AgeByCity, "Berlin"))
+
+	// the extremes exist twice
+	imap.Remove(1)
+	imap.Remove(2)
+	assert.Equal(t, []any{3, 90, 10, 50, 30.0}, imap.Aggregate(AgeByCity, "Berlin"))
+
+	imap.Remove(3)
+	imap.Remove(4)
+	assert.Equal(t, []any{1, 30, 30, 30, 30.0}, imap.Aggregate(AgeByCity, "Berlin"))
+
+	imap.Remove(0)
+	assert.Nil(t, imap.Aggregate(AgeByCity, "Berlin"))
+	assert.Nil(t, imap.Aggregate("nothing", "Berlin"))
+	assert.Nil(t, imap.AggregateGroups(NameIndex))
+}
+
+// distinctAccumulator is a custom reducer counting the distinct names.
+type distinctAccumulator struct {
+	counts map[string]int
+}
+
+func (acc *distinctAccumulator) Add(value *Person) { acc.counts[value.Name]++ }
+func (acc *distinctAccumulator) Retract(value *Person) {
+	if acc.counts[value.Name]--; acc.counts[value.Name] == 0 {
+		delete(acc.counts, value.Name)
+	}
+}
+func (acc *distinctAccumulator) Result() any { return len(acc.counts) }
+
+func TestAggregate_Custom(t *testing.T) {
+	imap := CreateTestMap(0)
+	imap.AddAggregate("names", func(value *Person) any {
+		return value.Age >= 18
+	}, func() Accumulator[Person] {
+		return &distinctAccumulator{counts: make(map[string]int)}
+	})
+	for i, name := range []string{"Ann", "Bob", "Ann"} {
+		imap.Insert(&Person{ID: int64(i), Name: name, Age: 20})
+	}
+	assert.Equal(t, []any{2}, imap.Aggregate("names", true))
+
+	imap.Update(1, func(value *Person) (*Person, bool) {
+		value.Age = 10
+		return value, true
+	})
+	assert.Equal(t, []any{1}, imap.Aggregate("names", true))
+	assert.Equal(t, []any{1}, imap.Aggregate("names", false))
+}
@@ -0,0 +1,150 @@
+package indexmap
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A Tokenizer splits a text into tokens.
+type Tokenizer func(text string) []string
+
+// A TokenFilter transforms the tokens of a text,
+// it may change, remove or add tokens.
+type TokenFilter func(tokens []string) []string
+
+// Analyzer turns the texts of a TextIndex and the terms of search queries into
+// index terms, the tokens of the Tokenizer are passed through the Filters in order,
+// then Stem reduces them to their stem.
+type Analyzer struct {
+	Tokenizer Tokenizer
+	Filters   []TokenFilter
+	// Stem is nil for analyzers keeping the words. Prefix terms of queries aren't stemmed,
+	// they match the words of the texts before stemming.
+	Stem func(word string) string
+}
+
+// NewAnalyzer creates an Analyzer,
+// a nil tokenizer splits the text into words.
+func NewAnalyzer(tokenizer Tokenizer, filters ...TokenFilter) *Analyzer {
+	if tokenizer == nil {
+		tokenizer = WordTokenizer
+	}
+	return &Analyzer{Tokenizer: tokenizer, Filters: filters}
+}
+
+// DefaultAnalyzer splits into words and lowercases them.
+func DefaultAnalyzer() *Analyzer {
+	return NewAnalyzer(WordTokenizer, LowercaseFilter)
+}
+
+// EnglishAnalyzer splits into words, lowercases them, removes English stop words
+// and stems the rest.
+func EnglishAnalyzer() *Analyzer {
+	analyzer := NewAnalyzer(WordTokenizer, LowercaseFilter, StopWordFilter(EnglishStopWords...))
+	analyzer.Stem = EnglishStem
+	return analyzer
+}
+
+// Analyze returns the terms of the text.
+func (analyzer *Analyzer) Analyze(text string) []string {
+	terms := analyzer.words(text)
+	if analyzer.Stem != nil {
+		for i := range terms {
+			terms[i] = analyzer.Stem(terms[i])
+		}
+	}
+	return terms
+}
+
+// words returns the filtered tokens of the text, not stemmed yet.
+func (analyzer *Analyzer) words(text string) []string {
+	tokens := analyzer.Tokenizer(text)
+	for _, filter := range analyzer.Filters {
+		tokens = filter(tokens)
+	}
+	return tokens
+}
+
+// WordTokenizer splits the text at every rune that is neither a letter nor a digit.
+func WordTokenizer(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// WhitespaceTokenizer splits the text at white space.
+func WhitespaceTokenizer(text string) []string {
+	return strings.Fields(text)
+}
+
+// LowercaseFilter lowercases all tokens.
+func LowercaseFilter(tokens []string) []string {
+	for i := range tokens {
+		tokens[i] = strings.ToLower(tokens[i])
+	}
+	return tokens
+}
+
+// StopWordFilter removes the given words,
+// it must be placed behind the LowercaseFilter to remove them case insensitive.
+func StopWordFilter(words ...string) TokenFilter {
+	stopWords := make(Set[string], len(words))
+	stopWords.Insert(words...)
+	return func(tokens []string) []string {
+		kept := tokens[:0]
+		for _, token := range tokens {
+			if !stopWords.Contain(token) {
+				kept = append(kept, token)
+			}
+		}
+		return kept
+	}
+}
+
+// StemFilter replaces every token by its stem.
+// Prefix terms of queries are stemmed by it as well, the Stem of the Analyzer avoids that.
+func StemFilter(stem func(word string) string) TokenFilter {
+	return func(tokens []string) []string {
+		for i := range tokens {
+			tokens[i] = stem(tokens[i])
+		}
+		return tokens
+	}
+}
+
+// EnglishStopWords are common English words hardly worth indexing.
+var EnglishStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in", "into",
+	"is", "it", "no", "not", "of", "on", "or", "such", "that", "the", "their", "then",
+	"there", "these", "they", "this", "to", "was", "will", "with",
+}
+
+// englishSuffixes are stripped by EnglishStem, longest first.
+var englishSuffixes = []struct {
+	suffix, replacement string
+}{
+	{"ational", "ate"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"ization", "ize"}, {"ations", "ate"}, {"ation", "ate"}, {"ingly", ""}, {"edly", ""},
+	{"ness", ""}, {"ment", ""}, {"sses", "ss"}, {"ies", "y"}, {"ing", ""}, {"ly", ""},
+	{"ed", ""}, {"es", ""}, {"s", ""},
+}
+
+// EnglishStem is a light suffix stripping stemmer for English,
+// i.e. "running" and "runs" become "run".
+// It is much simpler than a Porter stemmer, a better one can be plugged in by the Stem of an Analyzer.
+func EnglishStem(word string) string {
+	for _, s := range englishSuffixes {
+		stem, ok := strings.CutSuffix(word, s.suffix)
+		// keep at least three runes, "ss" stays as in "glass"
+		if !ok || len([]rune(stem)) < 3 || (s.suffix == "s" && strings.HasSuffix(stem, "s")) {
+			continue
+		}
+		stem += s.replacement
+		// running -> runn -> run
+		if n := len(stem); s.replacement == "" && n > 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("lsz", rune(stem[n-1])) {
+			stem = stem[:n-1]
+		}
+		return stem
+	}
+	return word
+}
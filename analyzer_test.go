@@ -0,0 +1,35 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzer(t *testing.T) {
+	assert.Equal(t, []string{"san", "francisco", "ca"}, DefaultAnalyzer().Analyze("San Francisco, CA"))
+	assert.Equal(t, []string{"Hello,", "World!"}, NewAnalyzer(WhitespaceTokenizer).Analyze(" Hello,  World! "))
+	assert.Equal(t, []string{"run", "fast", "cat", "glass"}, EnglishAnalyzer().Analyze("The running of the fast cats is a glass"))
+	assert.Empty(t, EnglishAnalyzer().Analyze("to be or not to be"))
+	assert.Equal(t, []string{"running", "cats"}, EnglishAnalyzer().words("The running cats"))
+}
+
+func TestEnglishStem(t *testing.T) {
+	for word, stem := range map[string]string{
+		"running":   "run",
+		"runs":      "run",
+		"jumped":    "jump",
+		"cities":    "city",
+		"glasses":   "glass",
+		"glass":     "glass",
+		"falling":   "fall",
+		"happiness": "happi",
+		"is":        "is",
+		"has":       "has",
+		"added":     "add",
+		"quickly":   "quick",
+		"shanghai":  "shanghai",
+	} {
+		assert.Equal(t, stem, EnglishStem(word), word)
+	}
+}
@@ -0,0 +1,275 @@
+package indexmap
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ordinalTable numbers the values of an IndexMap for the bitmaps of BitmapIndexes,
+// the ordinals of removed values are reused.
+type ordinalTable[V any] struct {
+	ordinals map[*V]uint32
+	// the values by ordinal, nil if it's free
+	values []*V
+	free   []uint32
+	// the ordinals in use, the universe of Not
+	live bitmap
+}
+
+func newOrdinalTable[V any]() *ordinalTable[V] {
+	return &ordinalTable[V]{ordinals: make(map[*V]uint32)}
+}
+
+func (table *ordinalTable[V]) assign(value *V) {
+	if _, ok := table.ordinals[value]; ok {
+		return
+	}
+	var ordinal uint32
+	if n := len(table.free); n > 0 {
+		ordinal, table.free = table.free[n-1], table.free[:n-1]
+		table.values[ordinal] = value
+	} else {
+		ordinal = uint32(len(table.values))
+		table.values = append(table.values, value)
+	}
+	table.ordinals[value] = ordinal
+	table.live.add(ordinal)
+}
+
+func (table *ordinalTable[V]) release(value *V) {
+	ordinal, ok := table.ordinals[value]
+	if !ok {
+		return
+	}
+	delete(table.ordinals, value)
+	table.values[ordinal] = nil
+	table.free = append(table.free, ordinal)
+	table.live.remove(ordinal)
+}
+
+func (table *ordinalTable[V]) clear() {
+	*table = *newOrdinalTable[V]()
+}
+
+// set collects the values of the ordinals.
+func (table *ordinalTable[V]) set(b *bitmap) Set[*V] {
+	values := make(Set[*V], b.cardinality())
+	b.iterate(func(ordinal uint32) bool {
+		values.Insert(table.values[ordinal])
+		return true
+	})
+	return values
+}
+
+// ordinalIndex is an Index of the ordinals of the values,
+// AddIndex numbers the values for it before they are inserted.
+type ordinalIndex[V any] interface {
+	setOrdinals(ordinals *ordinalTable[V])
+}
+
+// BitmapIndex is a secondary index for fields with few distinct values like a status,
+// a country or a flag. The values of a key are a compressed bitmap of ordinals of the values,
+// saving the memory of huge buckets, and BitmapFilters combine the bitmaps of several
+// BitmapIndexes fast, see IndexMap.FilterBitmap.
+// It's used like a SecondaryIndex by GetAllBy, Query and the like,
+// those collect the values of the bitmaps.
+type BitmapIndex[V any] struct {
+	extractField func(value *V) []any
+
+	inner    map[any]*bitmap
+	ordinals *ordinalTable[V]
+	// the sum of the values of all keys
+	entries int
+}
+
+// Create a bitmap index,
+// the extractField func returns the keys for seeking the value like for NewSecondaryIndex.
+func NewBitmapIndex[V any](extractField func(value *V) []any) *BitmapIndex[V] {
+	return &BitmapIndex[V]{
+		extractField: extractField,
+		inner:        make(map[any]*bitmap),
+	}
+}
+
+func (index *BitmapIndex[V]) setOrdinals(ordinals *ordinalTable[V]) {
+	index.ordinals = ordinals
+}
+
+func (index *BitmapIndex[V]) insert(elem *V) {
+	ordinal := index.ordinals.ordinals[elem]
+	for _, key := range index.extractField(elem) {
+		b, ok := index.inner[key]
+		if !ok {
+			b = &bitmap{}
+			index.inner[key] = b
+		}
+		if b.add(ordinal) {
+			index.entries++
+		}
+	}
+}
+
+func (index *BitmapIndex[V]) remove(elem *V) {
+	ordinal, ok := index.ordinals.ordinals[elem]
+	if !ok {
+		return
+	}
+	for _, key := range index.extractField(elem) {
+		b, ok := index.inner[key]
+		if !ok || !b.remove(ordinal) {
+			continue
+		}
+		index.entries--
+		if len(b.keys) == 0 {
+			delete(index.inner, key)
+		}
+	}
+}
+
+func (index *BitmapIndex[V]) clear() {
+	index.inner = make(map[any]*bitmap)
+	index.entries = 0
+}
+
+func (index *BitmapIndex[V]) get(key any) bucket[V] {
+	b, ok := index.inner[key]
+	if !ok {
+		return bucket[V]{}
+	}
+	return setBucket(index.ordinals.set(b))
+}
+
+func (index *BitmapIndex[V]) iterate(fn func(key any, elems bucket[V]) bool) {
+	for key, b := range index.inner {
+		if !fn(key, setBucket(index.ordinals.set(b))) {
+			return
+		}
+	}
+}
+
+func (index *BitmapIndex[V]) counts() (keys, entries int) {
+	return len(index.inner), index.entries
+}
+
+type bitmapOp int
+
+const (
+	bitmapKeys bitmapOp = iota
+	bitmapAnd
+	bitmapOr
+	bitmapNot
+)
+
+// BitmapFilter selects values by the bitmaps of BitmapIndexes,
+// filters are combined by And, Or and Not, like
+//
+//	indexmap.BitmapKeys("status", "active").And(indexmap.BitmapKeys("country", "DE", "AT").Not())
+//
+// They are evaluated on the bitmaps, see IndexMap.CountBitmap and IndexMap.FilterBitmap.
+type BitmapFilter struct {
+	op        bitmapOp
+	indexName string
+	keys      []any
+	children  []*BitmapFilter
+}
+
+// BitmapKeys selects the values of any of the keys of the BitmapIndex.
+func BitmapKeys(indexName string, keys ...any) *BitmapFilter {
+	return &BitmapFilter{op: bitmapKeys, indexName: indexName, keys: keys}
+}
+
+// And selects the values selected by the filter and all others.
+func (filter *BitmapFilter) And(others ...*BitmapFilter) *BitmapFilter {
+	return &BitmapFilter{op: bitmapAnd, children: append([]*BitmapFilter{filter}, others...)}
+}
+
+// Or selects the values selected by the filter or any of the others.
+func (filter *BitmapFilter) Or(others ...*BitmapFilter) *BitmapFilter {
+	return &BitmapFilter{op: bitmapOr, children: append([]*BitmapFilter{filter}, others...)}
+}
+
+// Not selects the values of the map not selected by the filter.
+func (filter *BitmapFilter) Not() *BitmapFilter {
+	return &BitmapFilter{op: bitmapNot, children: []*BitmapFilter{filter}}
+}
+
+// CountBitmap returns the number of values selected by the filter,
+// without collecting them.
+// It fails with ErrUnknownName if the filter names no BitmapIndex.
+func (imap *IndexMap[K, V]) CountBitmap(filter *BitmapFilter) (int, error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	b, err := imap.evalBitmap(filter)
+	if err != nil {
+		return 0, err
+	}
+	return b.cardinality(), nil
+}
+
+// FilterBitmap returns the values selected by the filter, in no particular order.
+// It fails with ErrUnknownName if the filter names no BitmapIndex.
+func (imap *IndexMap[K, V]) FilterBitmap(filter *BitmapFilter) ([]*V, error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	b, err := imap.evalBitmap(filter)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*V, 0, b.cardinality())
+	b.iterate(func(ordinal uint32) bool {
+		values = append(values, imap.ordinals.values[ordinal])
+		return true
+	})
+	return values, nil
+}
+
+// evalBitmap returns the ordinals of the values selected by the filter,
+// the caller holds the lock of the map and must not modify the result.
+func (imap *IndexMap[K, V]) evalBitmap(filter *BitmapFilter) (*bitmap, error) {
+	switch filter.op {
+	case bitmapKeys:
+		index, ok := imap.indexes[filter.indexName].(*BitmapIndex[V])
+		if !ok {
+			return nil, fmt.Errorf("%w: bitmap index %s", ErrUnknownName, filter.indexName)
+		}
+		result := &bitmap{}
+		for _, key := range filter.keys {
+			if b, ok := index.inner[key]; ok {
+				result = result.or(b)
+			}
+		}
+		return result, nil
+	case bitmapNot:
+		b, err := imap.evalBitmap(filter.children[0])
+		if err != nil {
+			return nil, err
+		}
+		return imap.ordinals.live.andNot(b), nil
+	}
+
+	children := make([]*bitmap, len(filter.children))
+	for i, child := range filter.children {
+		var err error
+		if children[i], err = imap.evalBitmap(child); err != nil {
+			return nil, err
+		}
+	}
+	if filter.op == bitmapOr {
+		result := &bitmap{}
+		for _, b := range children {
+			result = result.or(b)
+		}
+		return result, nil
+	}
+	// the smallest first, the intersections are at most as big
+	slices.SortFunc(children, func(b1, b2 *bitmap) int {
+		return b1.cardinality() - b2.cardinality()
+	})
+	result := children[0]
+	for _, b := range children[1:] {
+		result = result.and(b)
+	}
+	return result, nil
+}
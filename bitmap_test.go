@@ -0,0 +1,128 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	AgeGroupIndex = "age_group"
+	AdultIndex    = "adult"
+)
+
+func createBitmapTestMap(n int) *IndexMap[int64, Person] {
+	imap := CreateTestMap(n)
+	imap.AddIndex(AgeGroupIndex, NewBitmapIndex(func(value *Person) []any {
+		return []any{value.Age / 10}
+	}))
+	imap.AddIndex(AdultIndex, NewBitmapIndex(func(value *Person) []any {
+		return []any{value.Age >= 18}
+	}))
+	return imap
+}
+
+func TestBitmapIndex(t *testing.T) {
+	imap := createBitmapTestMap(1000)
+
+	assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age/10 == 3 }), imap.GetAllBy(AgeGroupIndex, 3))
+	assert.Nil(t, imap.GetAllBy(AgeGroupIndex, 30))
+
+	imap.Update(1, func(value *Person) (*Person, bool) {
+		value.Age = 5
+		return value, true
+	})
+	imap.Remove(2)
+	imap.Insert(&Person{ID: 2000, Name: "New", Age: 35, City: "Venice"})
+	for group := range 11 {
+		assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age/10 == group }), imap.GetAllBy(AgeGroupIndex, group), group)
+	}
+	assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age < 18 }), imap.GetAllBy(AdultIndex, false))
+
+	result, err := imap.Query(`adult = false AND age_group = 0`)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age < 10 }), result)
+
+	imap.Clear()
+	assert.Nil(t, imap.GetAllBy(AdultIndex, true))
+	imap.Insert(&Person{ID: 1, Age: 40})
+	assert.Len(t, imap.GetAllBy(AdultIndex, true), 1)
+}
+
+func TestIndexMap_FilterBitmap(t *testing.T) {
+	imap := createBitmapTestMap(5000)
+
+	tests := []struct {
+		filter *BitmapFilter
+		pred   func(value *Person) bool
+	}{
+		{BitmapKeys(AgeGroupIndex, 2, 3), func(value *Person) bool { return value.Age >= 20 && value.Age < 40 }},
+		{BitmapKeys(AgeGroupIndex, 1).And(BitmapKeys(AdultIndex, false)), func(value *Person) bool { return value.Age >= 10 && value.Age < 18 }},
+		{BitmapKeys(AgeGroupIndex, 1).Or(BitmapKeys(AgeGroupIndex, 5), BitmapKeys(AgeGroupIndex, 99)), func(value *Person) bool { return value.Age/10 == 1 || value.Age/10 == 5 }},
+		{BitmapKeys(AdultIndex, true).Not(), func(value *Person) bool { return value.Age < 18 }},
+		{BitmapKeys(AdultIndex, true).And(BitmapKeys(AgeGroupIndex, 1, 2).Not()), func(value *Person) bool { return value.Age >= 30 }},
+		{BitmapKeys(AgeGroupIndex), func(value *Person) bool { return false }},
+	}
+	for i, test := range tests {
+		expected := filterPersons(imap, test.pred)
+		count, err := imap.CountBitmap(test.filter)
+		assert.NoError(t, err, i)
+		assert.Equal(t, len(expected), count, i)
+		values, err := imap.FilterBitmap(test.filter)
+		assert.NoError(t, err, i)
+		assert.ElementsMatch(t, expected, values, i)
+	}
+
+	_, err := imap.CountBitmap(BitmapKeys(CityIndex, "Venice"))
+	assert.ErrorIs(t, err, ErrUnknownName)
+	_, err = imap.FilterBitmap(BitmapKeys(AdultIndex, true).And(BitmapKeys(InvalidIndex)))
+	assert.ErrorIs(t, err, ErrUnknownName)
+}
+
+func TestBitmapIndex_BulkInsert(t *testing.T) {
+	imap := createBitmapTestMap(2000)
+	values := make([]*Person, 0, 3000)
+	for i := range 3000 {
+		values = append(values, &Person{ID: int64(1000 + i), Name: names[i%len(names)], Age: i % 100, City: cities[i%len(cities)]})
+	}
+	values = append(values, imap.Get(5))
+	imap.BulkInsert(values...)
+
+	assert.Equal(t, 4000, imap.Len())
+	count, err := imap.CountBitmap(BitmapKeys(AdultIndex, true).Or(BitmapKeys(AdultIndex, false)))
+	assert.NoError(t, err)
+	assert.Equal(t, 4000, count)
+	for group := range 11 {
+		assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age/10 == group }), imap.GetAllBy(AgeGroupIndex, group), group)
+	}
+}
+
+func BenchmarkBitmapCount(b *testing.B) {
+	imap := createBitmapTestMap(100000)
+	filter := BitmapKeys(AdultIndex, true).And(BitmapKeys(AgeGroupIndex, 1, 2, 3).Not())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = imap.CountBitmap(filter)
+	}
+}
+
+func BenchmarkSecondaryIntersect(b *testing.B) {
+	imap := CreateTestMap(100000)
+	groups := NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Age / 10}
+	})
+	adults := NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Age >= 18}
+	})
+	imap.AddIndex(AgeGroupIndex, groups)
+	imap.AddIndex(AdultIndex, adults)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		for value := range adults.get(true).all() {
+			if !groups.get(1).contains(value) && !groups.get(2).contains(value) && !groups.get(3).contains(value) {
+				count++
+			}
+		}
+	}
+}
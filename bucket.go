@@ -0,0 +1,150 @@
+package indexmap
+
+import (
+	"iter"
+	"slices"
+)
+
+// bucketSliceMax is the number of values up to which a bucket is a slice,
+// above it the values are a Set. Buckets shrinking to half of it are slices again,
+// so alternating inserts and removes don't convert every time.
+const bucketSliceMax = 16
+
+// bucket holds the values of a key of an index, adaptively by size:
+// a single value inline, a few in a slice, and many in a Set.
+// That saves the memory of a Set per key, most keys of near-unique indexes have one value.
+// The zero bucket is empty. A bucket returned by an index must not be used
+// after the index is modified.
+type bucket[V any] struct {
+	one  *V
+	few  []*V
+	many Set[*V]
+}
+
+// setBucket wraps the Set of an index, nil is empty.
+func setBucket[V any](set Set[*V]) bucket[V] {
+	return bucket[V]{many: set}
+}
+
+func (b bucket[V]) len() int {
+	switch {
+	case b.one != nil:
+		return 1
+	case b.many != nil:
+		return len(b.many)
+	}
+	return len(b.few)
+}
+
+func (b bucket[V]) contains(value *V) bool {
+	switch {
+	case b.one != nil:
+		return b.one == value
+	case b.many != nil:
+		return b.many.Contain(value)
+	}
+	return slices.Contains(b.few, value)
+}
+
+// all iterates over the values in no particular order.
+func (b bucket[V]) all() iter.Seq[*V] {
+	return func(yield func(*V) bool) {
+		switch {
+		case b.one != nil:
+			yield(b.one)
+		case b.many != nil:
+			for value := range b.many {
+				if !yield(value) {
+					return
+				}
+			}
+		default:
+			for _, value := range b.few {
+				if !yield(value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// first returns any of the values, nil if the bucket is empty.
+func (b bucket[V]) first() *V {
+	for value := range b.all() {
+		return value
+	}
+	return nil
+}
+
+func (b bucket[V]) collect() []*V {
+	switch {
+	case b.one != nil:
+		return []*V{b.one}
+	case b.many != nil:
+		return b.many.Collect()
+	}
+	return slices.Clone(b.few)
+}
+
+// addTo inserts the values into the set.
+func (b bucket[V]) addTo(set Set[*V]) {
+	for value := range b.all() {
+		set.Insert(value)
+	}
+}
+
+// insert returns the bucket with the value, and whether it wasn't in the bucket.
+func (b bucket[V]) insert(value *V) (bucket[V], bool) {
+	switch {
+	case b.contains(value):
+		return b, false
+	case b.many != nil:
+		b.many.Insert(value)
+		return b, true
+	case b.one != nil:
+		return bucket[V]{few: []*V{b.one, value}}, true
+	case len(b.few) == 0:
+		return bucket[V]{one: value}, true
+	case len(b.few) < bucketSliceMax:
+		b.few = append(b.few, value)
+		return b, true
+	}
+
+	many := make(Set[*V], len(b.few)+1)
+	many.Insert(b.few...)
+	many.Insert(value)
+	return bucket[V]{many: many}, true
+}
+
+// remove returns the bucket without the value, and whether it was in the bucket.
+func (b bucket[V]) remove(value *V) (bucket[V], bool) {
+	switch {
+	case b.one != nil:
+		if b.one != value {
+			return b, false
+		}
+		return bucket[V]{}, true
+	case b.many != nil:
+		if !b.many.Contain(value) {
+			return b, false
+		}
+		b.many.Remove(value)
+		if len(b.many) <= bucketSliceMax/2 {
+			return bucket[V]{few: b.many.Collect()}, true
+		}
+		return b, true
+	}
+
+	i := slices.Index(b.few, value)
+	if i < 0 {
+		return b, false
+	}
+	last := len(b.few) - 1
+	b.few[i] = b.few[last]
+	b.few[last] = nil
+	b.few = b.few[:last]
+	if len(b.few) == 1 {
+		return bucket[V]{one: b.few[0]}, true
+	}
+	return b, true
+}
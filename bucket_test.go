@@ -0,0 +1,67 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket(t *testing.T) {
+	persons := make([]*Person, 40)
+	for i := range persons {
+		persons[i] = &Person{ID: int64(i)}
+	}
+
+	b := bucket[Person]{}
+	assert.Equal(t, 0, b.len())
+	assert.Nil(t, b.first())
+
+	b, ok := b.insert(persons[0])
+	assert.True(t, ok)
+	assert.Same(t, persons[0], b.one)
+	_, ok = b.insert(persons[0])
+	assert.False(t, ok)
+
+	b, _ = b.insert(persons[1])
+	assert.Nil(t, b.one)
+	assert.Len(t, b.few, 2)
+	for _, person := range persons[2:bucketSliceMax] {
+		b, _ = b.insert(person)
+	}
+	assert.Len(t, b.few, bucketSliceMax)
+	assert.Nil(t, b.many)
+	b, _ = b.insert(persons[bucketSliceMax])
+	assert.Nil(t, b.few)
+	assert.Len(t, b.many, bucketSliceMax+1)
+	for _, person := range persons {
+		b, _ = b.insert(person)
+	}
+	assert.Equal(t, len(persons), b.len())
+	assert.ElementsMatch(t, persons, b.collect())
+	assert.True(t, b.contains(persons[39]))
+
+	// shrinks to a slice at half of bucketSliceMax
+	for _, person := range persons[:len(persons)-bucketSliceMax/2-1] {
+		b, ok = b.remove(person)
+		assert.True(t, ok)
+	}
+	assert.NotNil(t, b.many)
+	b, _ = b.remove(persons[len(persons)-bucketSliceMax/2-1])
+	assert.Nil(t, b.many)
+	assert.ElementsMatch(t, persons[len(persons)-bucketSliceMax/2:], b.collect())
+	_, ok = b.remove(persons[0])
+	assert.False(t, ok)
+
+	for _, person := range persons[len(persons)-bucketSliceMax/2 : len(persons)-1] {
+		b, _ = b.remove(person)
+	}
+	assert.Same(t, persons[39], b.one)
+	assert.Same(t, persons[39], b.first())
+	b, ok = b.remove(persons[39])
+	assert.True(t, ok)
+	assert.Equal(t, 0, b.len())
+
+	set := make(Set[*Person])
+	setBucket(Set[*Person]{persons[1]: {}, persons[2]: {}}).addTo(set)
+	assert.Len(t, set, 2)
+}
@@ -0,0 +1,202 @@
+package indexmap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DuplicatePolicy decides what BulkLoad does with values whose primary key
+// is already in the map, or used by an earlier value of the load.
+type DuplicatePolicy int
+
+const (
+	// RejectDuplicates fails the load with ErrDuplicateKey, nothing is loaded then.
+	// This is the default.
+	RejectDuplicates DuplicatePolicy = iota
+	// OverwriteDuplicates keeps the last value, like Insert.
+	OverwriteDuplicates
+	// SkipDuplicates keeps the first value, the value in the map if there is one.
+	SkipDuplicates
+)
+
+// BulkLoadOption configures BulkLoad.
+type BulkLoadOption func(config *bulkLoadConfig)
+
+type bulkLoadConfig struct {
+	duplicates DuplicatePolicy
+}
+
+// WithDuplicatePolicy sets the policy for duplicate primary keys, RejectDuplicates by default.
+func WithDuplicatePolicy(policy DuplicatePolicy) BulkLoadOption {
+	return func(config *bulkLoadConfig) {
+		config.duplicates = policy
+	}
+}
+
+// BulkLoad inserts many values faster than Insert, i.e. to load a dataset at startup.
+// The primary index is filled first, sized by the number of values if the map is empty,
+// then every index is built in one pass over the values, in parallel if there are several,
+// so the extractField funcs of the indexes must be safe for concurrent use.
+// Duplicate primary keys are handled by the DuplicatePolicy, see WithDuplicatePolicy.
+// Values referencing missing values of foreign keys fail with ErrForeignKey,
+// nothing is loaded then.
+// One change event is emitted per loaded key, from the value stored before,
+// or an insert, to the value kept.
+func (imap *IndexMap[K, V]) BulkLoad(values []*V, opts ...BulkLoadOption) error {
+	config := bulkLoadConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	defer imap.writeLock()()
+
+	return imap.bulkLoad(values, config.duplicates, false)
+}
+
+// bulkLoad is the lock free version of BulkLoad,
+// eachValue emits a change for every value like Insert instead of one per key.
+func (imap *IndexMap[K, V]) bulkLoad(values []*V, policy DuplicatePolicy, eachValue bool) error {
+	for i := range values {
+		if err := imap.validate(values[i]); err != nil {
+			return err
+		}
+	}
+
+	var changes []Change[K, V]
+	emit := len(imap.listeners) > 0
+	// the loaded keys in the order of their first value, and the value kept for every key
+	var keys []K
+	latest := make(map[K]*V, len(values))
+	for _, value := range values {
+		key := imap.primaryIndex.extractField(value)
+		old, ok := latest[key]
+		if !ok {
+			old = imap.primaryIndex.get(key)
+		}
+		if old != nil {
+			switch policy {
+			case RejectDuplicates:
+				return fmt.Errorf("%w: %v", ErrDuplicateKey, key)
+			case SkipDuplicates:
+				latest[key] = old
+				continue
+			}
+		}
+		if !ok {
+			keys = append(keys, key)
+		}
+		latest[key] = value
+		if !emit || !eachValue {
+			continue
+		}
+		if old != nil {
+			changes = append(changes, Change[K, V]{Kind: Updated, OldKey: key, NewKey: key, Old: old, New: value})
+		} else {
+			changes = append(changes, Change[K, V]{Kind: Inserted, NewKey: key, New: value})
+		}
+	}
+
+	// otherwise one change per key, from the stored value to the last one loaded
+	var replaced []*V
+	for _, key := range keys {
+		old := imap.primaryIndex.get(key)
+		if old != nil {
+			replaced = append(replaced, old)
+		}
+		if !emit || eachValue {
+			continue
+		}
+		if old != nil {
+			changes = append(changes, Change[K, V]{Kind: Updated, OldKey: key, NewKey: key, Old: old, New: latest[key]})
+		} else {
+			changes = append(changes, Change[K, V]{Kind: Inserted, NewKey: key, New: latest[key]})
+		}
+	}
+
+	for _, old := range replaced {
+		imap.logDel(old)
+	}
+	if len(imap.primaryIndex.inner) == 0 {
+		imap.primaryIndex.inner = make(map[K]*V, len(latest))
+	}
+	if imap.seqs != nil && len(imap.seqs) == 0 {
+		imap.seqs = make(map[*V]uint64, len(latest))
+	}
+	// in the order of values, for the orderings
+	added := make([]*V, 0, len(latest))
+	for _, value := range values {
+		key := imap.primaryIndex.extractField(value)
+		if latest[key] != value {
+			continue
+		}
+		delete(latest, key)
+		imap.logPut(value)
+		imap.primaryIndex.inner[key] = value
+		added = append(added, value)
+	}
+
+	imap.buildIndexes(replaced, added)
+	imap.emit(changes...)
+	return nil
+}
+
+// buildIndexes removes the replaced values from the indexes and the orderings,
+// and adds the values, several indexes are built in parallel.
+func (imap *IndexMap[K, V]) buildIndexes(replaced, added []*V) {
+	imap.version++
+	parallel := len(imap.indexes) > 1 && len(added) >= parallelChunk
+	imap.eachIndex(parallel, func(index Index[V]) {
+		for _, old := range replaced {
+			index.remove(old)
+		}
+	})
+	for _, old := range replaced {
+		imap.unorder(old)
+	}
+	// the values are numbered after the replaced ones are released, they may be the same
+	if imap.ordinals != nil {
+		for _, old := range replaced {
+			imap.ordinals.release(old)
+		}
+		for _, value := range added {
+			imap.ordinals.assign(value)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		imap.eachIndex(parallel, func(index Index[V]) {
+			for _, value := range added {
+				index.insert(value)
+			}
+		})
+	}()
+	for _, value := range added {
+		imap.order(value)
+	}
+	wg.Wait()
+}
+
+// eachIndex calls fn for all indexes, on a goroutine per index if parallel is true.
+func (imap *IndexMap[K, V]) eachIndex(parallel bool, fn func(index Index[V])) {
+	if !parallel {
+		for _, index := range imap.indexes {
+			fn(index)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for _, index := range imap.indexes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(index)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createBulkPersons(n int) []*Person {
+	values := make([]*Person, 0, n)
+	for i := range n {
+		values = append(values, &Person{ID: int64(i), Name: names[i%len(names)], Age: i % 100, City: cities[i%len(cities)]})
+	}
+	return values
+}
+
+func TestIndexMap_BulkLoad(t *testing.T) {
+	imap := CreateTestMap(0)
+	values := createBulkPersons(5000)
+	assert.NoError(t, imap.BulkLoad(values))
+
+	expected := CreateTestMap(0)
+	expected.Insert(values...)
+	assert.Equal(t, expected.Len(), imap.Len())
+	for _, key := range cities {
+		assert.ElementsMatch(t, expected.GetAllBy(CityIndex, key), imap.GetAllBy(CityIndex, key), key)
+	}
+	for _, key := range names {
+		assert.ElementsMatch(t, expected.GetAllBy(NameIndex, key), imap.GetAllBy(NameIndex, key), key)
+	}
+}
+
+func TestIndexMap_BulkLoadDuplicates(t *testing.T) {
+	imap := CreateTestMap(10)
+	first := &Person{ID: 20, Name: "First", City: "Venice"}
+	last := &Person{ID: 20, Name: "Last", City: "Venice"}
+	existing := &Person{ID: 5, Name: "Existing", City: "Venice"}
+
+	err := imap.BulkLoad([]*Person{first, last})
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	assert.EqualError(t, err, "indexmap: duplicate primary key: 20")
+	assert.ErrorIs(t, imap.BulkLoad([]*Person{existing}), ErrDuplicateKey)
+	assert.Equal(t, 10, imap.Len())
+	assert.Empty(t, imap.GetAllBy(CityIndex, "Venice"))
+
+	old := imap.Get(5)
+	assert.NoError(t, imap.BulkLoad([]*Person{first, existing, last}, WithDuplicatePolicy(SkipDuplicates)))
+	assert.Equal(t, 11, imap.Len())
+	assert.Same(t, first, imap.Get(20))
+	assert.Same(t, old, imap.Get(5))
+	assert.Equal(t, []*Person{first}, imap.GetAllBy(CityIndex, "Venice"))
+
+	var changes []Change[int64, Person]
+	imap.OnChange(func(change Change[int64, Person]) {
+		changes = append(changes, change)
+	})
+	assert.NoError(t, imap.BulkLoad([]*Person{last, existing}, WithDuplicatePolicy(OverwriteDuplicates)))
+	assert.Equal(t, 11, imap.Len())
+	assert.Same(t, last, imap.Get(20))
+	assert.Same(t, existing, imap.Get(5))
+	assert.ElementsMatch(t, []*Person{last, existing}, imap.GetAllBy(CityIndex, "Venice"))
+	assert.Empty(t, imap.GetAllBy(NameIndex, "First"))
+	assert.Equal(t, []Change[int64, Person]{
+		{Kind: Updated, OldKey: 20, NewKey: 20, Old: first, New: last},
+		{Kind: Updated, OldKey: 5, NewKey: 5, Old: old, New: existing},
+	}, changes)
+
+	// duplicates within the load change a key once, from the stored value to the last one
+	changes = nil
+	second := &Person{ID: 21, Name: "Second", City: "Rome"}
+	third := &Person{ID: 21, Name: "Third", City: "Rome"}
+	assert.NoError(t, imap.BulkLoad([]*Person{first, second, existing, third, last}, WithDuplicatePolicy(OverwriteDuplicates)))
+	assert.Same(t, last, imap.Get(20))
+	assert.Same(t, third, imap.Get(21))
+	assert.Equal(t, []Change[int64, Person]{
+		{Kind: Updated, OldKey: 20, NewKey: 20, Old: last, New: last},
+		{Kind: Inserted, NewKey: 21, New: third},
+		{Kind: Updated, OldKey: 5, NewKey: 5, Old: existing, New: existing},
+	}, changes)
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	values := createBulkPersons(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = CreateTestMap(0).BulkLoad(values)
+	}
+}
@@ -0,0 +1,171 @@
+package indexmap
+
+// CompactionPolicy compacts an IndexMap automatically, see SetCompactionPolicy.
+type CompactionPolicy struct {
+	// Ratio of the values removed since the last compaction to the values left
+	// triggering a compaction, like 1 for as many removed values as are left.
+	// A Ratio <= 0 disables automatic compaction, that's the default.
+	Ratio float64
+	// MinRemoves is the number of removed values below which the map isn't compacted,
+	// compacting small maps isn't worth it.
+	MinRemoves int
+}
+
+// compactIndex is an Index rebuilding its maps at their current size.
+type compactIndex interface {
+	compact()
+}
+
+// SetCompactionPolicy compacts the map in the background when the values removed
+// since the last compaction reach the ratio of the policy, see Compact.
+func (imap *IndexMap[K, V]) SetCompactionPolicy(policy CompactionPolicy) {
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	imap.compaction = policy
+}
+
+// Compact rebuilds the maps of the IndexMap and its indexes at their current size.
+// Go maps don't shrink when entries are deleted, so maps that held many more values
+// keep that memory until they are compacted.
+// The primary index and every index are rebuilt one after another, each under the write lock,
+// so readers wait only for one of them at a time.
+func (imap *IndexMap[K, V]) Compact() {
+	imap.compactStep(func() {
+		imap.removes = 0
+		imap.pageKeys = nil
+		imap.primaryIndex.inner = compactMap(imap.primaryIndex.inner)
+		if imap.seqs != nil {
+			imap.seqs = compactMap(imap.seqs)
+		}
+	})
+	// renumbering the ordinals rebuilds the BitmapIndexes
+	imap.compactStep(func() {
+		if imap.ordinals == nil || len(imap.ordinals.free) == 0 {
+			return
+		}
+		values := imap.ordinals.values
+		imap.ordinals.clear()
+		for _, value := range values {
+			if value != nil {
+				imap.ordinals.assign(value)
+			}
+		}
+		for _, index := range imap.indexes {
+			if _, ok := index.(ordinalIndex[V]); ok {
+				index.clear()
+				for _, value := range imap.ordinals.values {
+					index.insert(value)
+				}
+			}
+		}
+	})
+
+	imap.lock.RLock()
+	names := make([]string, 0, len(imap.indexes))
+	for name := range imap.indexes {
+		names = append(names, name)
+	}
+	imap.lock.RUnlock()
+	for _, name := range names {
+		imap.compactStep(func() {
+			if index, ok := imap.indexes[name].(compactIndex); ok {
+				index.compact()
+			}
+		})
+	}
+}
+
+func (imap *IndexMap[K, V]) compactStep(step func()) {
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	imap.version++
+	step()
+}
+
+// removed counts n removed values, and starts a compaction if the policy is due.
+// Values only replaced by updates don't count. The caller holds the write lock of the map.
+func (imap *IndexMap[K, V]) removed(n int) {
+	if n == 0 {
+		return
+	}
+	imap.removes += n
+	policy := imap.compaction
+	if policy.Ratio <= 0 || imap.removes < policy.MinRemoves ||
+		float64(imap.removes) < policy.Ratio*float64(len(imap.primaryIndex.inner)) {
+		return
+	}
+	if _, ok := imap.lock.(*noLock); ok {
+		// the goroutine using the map compacts it
+		imap.compactDue = true
+		return
+	}
+	if imap.compacting.CompareAndSwap(false, true) {
+		// waits for the lock held by the caller
+		go func() {
+			defer imap.compacting.Store(false)
+			imap.Compact()
+		}()
+	}
+}
+
+// compactMap copies the map into a map of its size.
+func compactMap[M ~map[K]E, K comparable, E any](m M) M {
+	compacted := make(M, len(m))
+	for key, elem := range m {
+		compacted[key] = elem
+	}
+	return compacted
+}
+
+func (b bucket[V]) compact() bucket[V] {
+	switch {
+	case b.many != nil:
+		b.many = compactMap(b.many)
+	case b.few != nil:
+		b.few = append([]*V(nil), b.few...)
+	}
+	return b
+}
+
+func (index *SecondaryIndex[V]) compact() {
+	inner := make(map[any]bucket[V], len(index.inner))
+	for key, elems := range index.inner {
+		inner[key] = elems.compact()
+	}
+	index.inner = inner
+}
+
+func (index *PartialIndex[V]) compact() {
+	index.covered = compactMap(index.covered)
+	index.inner.compact()
+}
+
+func (index *BitmapIndex[V]) compact() {
+	index.inner = compactMap(index.inner)
+}
+
+func (index *TextIndex[V]) compact() {
+	postings := make(map[string]map[*V][]int, len(index.postings))
+	for term, docs := range index.postings {
+		postings[term] = compactMap(docs)
+	}
+	index.postings = postings
+	index.docs = compactMap(index.docs)
+	index.words = compactMap(index.words)
+}
+
+func (index *GeoIndex[V]) compact() {
+	cells := make(map[geoCell]Set[*V], len(index.cells))
+	for cell, values := range index.cells {
+		cells[cell] = compactMap(values)
+	}
+	index.cells = cells
+	index.shapes = compactMap(index.shapes)
+	index.large = compactMap(index.large)
+}
+
+func (index *aggregateIndex[V]) compact() {
+	index.groups = compactMap(index.groups)
+}
@@ -0,0 +1,119 @@
+package indexmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexMap_Compact(t *testing.T) {
+	imap := createBitmapTestMap(2000)
+	imap.AddIndex(IDIndex, NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.ID}
+	}))
+	imap.AddOrdering(AgeOrdering, Ascending(func(value *Person) int {
+		return value.Age
+	}))
+	for id := range int64(1800) {
+		imap.Remove(id)
+	}
+	ordered := imap.CollectOrderedBy(AgeOrdering)
+	stats := imap.MemoryStats()
+
+	imap.Compact()
+	assert.Equal(t, 200, imap.Len())
+	assert.Equal(t, ordered, imap.CollectOrderedBy(AgeOrdering))
+	for name, compacted := range imap.MemoryStats().Indexes {
+		assert.Equal(t, stats.Indexes[name].Keys, compacted.Keys, name)
+		assert.Equal(t, stats.Indexes[name].Entries, compacted.Entries, name)
+		assert.LessOrEqual(t, compacted.Bytes, stats.Indexes[name].Bytes, name)
+	}
+	assert.Len(t, imap.ordinals.values, 200)
+	assert.Empty(t, imap.ordinals.free)
+	assert.Zero(t, imap.removes)
+	for group := range 11 {
+		assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age/10 == group }), imap.GetAllBy(AgeGroupIndex, group), group)
+	}
+	adults, err := imap.FilterBitmap(BitmapKeys(AdultIndex, true))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, filterPersons(imap, func(value *Person) bool { return value.Age >= 18 }), adults)
+	assert.Same(t, imap.Get(1900), imap.GetBy(IDIndex, int64(1900)))
+
+	imap.Insert(&Person{ID: 1, Age: 40})
+	assert.Len(t, imap.GetAllBy(IDIndex, int64(1)), 1)
+	count, _ := imap.CountBitmap(BitmapKeys(AgeGroupIndex, 4))
+	assert.Len(t, imap.GetAllBy(AgeGroupIndex, 4), count)
+}
+
+func TestIndexMap_SetCompactionPolicy(t *testing.T) {
+	imap := createBitmapTestMap(1000)
+	imap.SetCompactionPolicy(CompactionPolicy{Ratio: 1, MinRemoves: 100})
+
+	for id := range int64(50) {
+		imap.Remove(id)
+	}
+	assert.False(t, imap.compacting.Load())
+
+	keys := make([]int64, 0, 500)
+	for id := range int64(500) {
+		keys = append(keys, 50+id)
+	}
+	imap.Remove(keys...)
+	assert.Eventually(t, func() bool {
+		imap.lock.RLock()
+		defer imap.lock.RUnlock()
+		return imap.removes == 0 && len(imap.ordinals.free) == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 450, imap.Len())
+	assert.Equal(t, 450, len(imap.GetAllBy(AdultIndex, true))+len(imap.GetAllBy(AdultIndex, false)))
+
+	imap.Remove(999)
+	imap.Clear()
+	assert.Zero(t, imap.removes)
+}
+
+func BenchmarkCompact(b *testing.B) {
+	imap := CreateTestMap(100_000)
+	for range b.N {
+		b.StopTimer()
+		InsertRandomDataFrom(imap, 0, 100_000)
+		for id := range int64(90_000) {
+			imap.Remove(id)
+		}
+		b.StartTimer()
+		released, _ := heapBytes(func() any {
+			imap.Compact()
+			return nil
+		})
+		// the heap shrinks, so the unsigned difference is negative
+		b.ReportMetric(float64(-int64(released)), "B-released")
+	}
+}
+
+func TestIndexMap_RemovesCount(t *testing.T) {
+	imap := CreateTestMap(100)
+	for id := range int64(60) {
+		imap.Update(id, func(value *Person) (*Person, bool) {
+			value.Age++
+			return value, true
+		})
+	}
+	imap.Upsert(&Person{ID: 1, Age: 1}, func(old, new *Person) *Person { return new })
+	imap.GetOrInsert(2, func() *Person { return &Person{ID: 2} })
+	assert.Zero(t, imap.removes)
+
+	imap.Update(3, func(value *Person) (*Person, bool) {
+		return nil, true
+	})
+	imap.Remove(4, 5, 1000)
+	assert.Equal(t, 3, imap.removes)
+
+	// the value with the new key is replaced
+	imap.SetKeyConflictPolicy(OverwriteKeyConflict)
+	imap.Update(6, func(value *Person) (*Person, bool) {
+		value.ID = 7
+		return value, true
+	})
+	assert.Equal(t, 4, imap.removes)
+}
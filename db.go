@@ -0,0 +1,286 @@
+package indexmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// DB is a small in-memory database, a catalog of named tables,
+// every table is an IndexMap with its indexes, orderings and foreign keys.
+// It provides transactions spanning several tables, see Update and View,
+// consistent snapshots of all tables, see Snapshot and Restore,
+// and one change feed of all tables, see OnChange.
+//
+// The tables can still be used directly, every method call is a transaction of its own then.
+type DB struct {
+	lock   sync.RWMutex
+	tables map[string]dbTable
+
+	feedLock     sync.RWMutex
+	feed         []feedListener
+	nextListener uint64
+}
+
+// TableChange is a Change of a table of a DB,
+// the keys and values are of the types of the table.
+// OldKey and Old are nil for Inserted, NewKey and New are nil for Removed.
+type TableChange struct {
+	Table  string
+	Kind   ChangeKind
+	OldKey any
+	NewKey any
+	Old    any
+	New    any
+}
+
+type feedListener struct {
+	id uint64
+	fn func(change TableChange)
+}
+
+type dbTable struct {
+	table
+	// cancel detaches the change feed
+	cancel func()
+}
+
+// table is implemented by IndexMap for all types.
+type table interface {
+	groupMember
+	// marshal is the lock free version of MarshalJSON
+	marshal() ([]byte, error)
+	// restore replaces all values by the JSON data, foreign keys aren't checked
+	restore(data []byte) error
+	// check validates the foreign keys of all values
+	check() error
+	// setTxLog starts recording the modifications, nil stops it
+	setTxLog(log *txLog)
+}
+
+// NewDB creates an empty DB.
+func NewDB() *DB {
+	return &DB{tables: make(map[string]dbTable)}
+}
+
+// AddTable registers the IndexMap as table of the DB by name,
+// it fails with ErrDuplicateName if the DB has a table with the name,
+// and with ErrReadOnly for read-only maps like the IndexMap of a View.
+// A View of a table is updated when a transaction commits while the tables are locked,
+// so it can't be a table itself.
+// Maps related by foreign keys should be tables of the same DB,
+// or else cascades into them aren't rolled back by failed transactions.
+func AddTable[K comparable, V any](db *DB, name string, table *IndexMap[K, V]) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.tables[name]; ok {
+		return fmt.Errorf("%w: table %s", ErrDuplicateName, name)
+	}
+	if table.readOnly {
+		return fmt.Errorf("%w: table %s", ErrReadOnly, name)
+	}
+	cancel := table.addListener(listener[K, V]{batch: func(changes []Change[K, V]) {
+		publish(db, name, changes)
+	}})
+	db.tables[name] = dbTable{table: table, cancel: cancel}
+	return nil
+}
+
+// GetTable returns the table by name, it fails with ErrUnknownName if there is none,
+// and with ErrTableType if the table has other types.
+func GetTable[K comparable, V any](db *DB, name string) (*IndexMap[K, V], error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return tableOf[K, V](db.tables, name)
+}
+
+func tableOf[K comparable, V any](tables map[string]dbTable, name string) (*IndexMap[K, V], error) {
+	t, ok := tables[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: table %s", ErrUnknownName, name)
+	}
+	imap, ok := t.table.(*IndexMap[K, V])
+	if !ok {
+		return nil, fmt.Errorf("%w: table %s is %T", ErrTableType, name, t.table)
+	}
+	return imap, nil
+}
+
+// DropTable unregisters the table by name,
+// the return value indicates whether the table existed.
+// The IndexMap itself is kept as it is.
+func (db *DB) DropTable(name string) bool {
+	db.lock.Lock()
+	t, ok := db.tables[name]
+	delete(db.tables, name)
+	db.lock.Unlock()
+
+	if ok {
+		t.cancel()
+	}
+	return ok
+}
+
+// Tables returns the names of the tables in ascending order.
+func (db *DB) Tables() []string {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// snapshotTables returns a copy of the tables,
+// so the tables can be locked without holding the DB lock.
+func (db *DB) snapshotTables() map[string]dbTable {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	tables := make(map[string]dbTable, len(db.tables))
+	for name, t := range db.tables {
+		tables[name] = t
+	}
+	return tables
+}
+
+// OnChange registers fn to be called for every change of every table,
+// the returned func unregisters it.
+// The changes of a transaction are delivered in order when it commits,
+// nothing is delivered for rolled back transactions.
+// fn is called synchronously while the table is locked,
+// so it must not call methods of the DB or the tables, or else it will deadlock.
+func (db *DB) OnChange(fn func(change TableChange)) (cancel func()) {
+	db.feedLock.Lock()
+	defer db.feedLock.Unlock()
+
+	db.nextListener++
+	id := db.nextListener
+	db.feed = append(db.feed, feedListener{id: id, fn: fn})
+
+	return func() {
+		db.feedLock.Lock()
+		defer db.feedLock.Unlock()
+
+		for i := range db.feed {
+			if db.feed[i].id == id {
+				db.feed = append(db.feed[:i:i], db.feed[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func publish[K comparable, V any](db *DB, name string, changes []Change[K, V]) {
+	db.feedLock.RLock()
+	defer db.feedLock.RUnlock()
+
+	if len(db.feed) == 0 {
+		return
+	}
+	for _, change := range changes {
+		tableChange := TableChange{Table: name, Kind: change.Kind}
+		if change.Kind != Inserted {
+			tableChange.OldKey, tableChange.Old = change.OldKey, change.Old
+		}
+		if change.Kind != Removed {
+			tableChange.NewKey, tableChange.New = change.NewKey, change.New
+		}
+		for i := range db.feed {
+			db.feed[i].fn(tableChange)
+		}
+	}
+}
+
+// Snapshot writes the values of all tables as one JSON object by table name to w,
+// all tables are locked together, so the snapshot is consistent.
+func (db *DB) Snapshot(w io.Writer) error {
+	tables := db.snapshotTables()
+	locks := make([]mapLock, 0, len(tables))
+	for _, t := range tables {
+		locks = append(locks, t.mapLock())
+	}
+
+	snapshot := make(map[string]json.RawMessage, len(tables))
+	unlock := lockMaps(false, locks...)
+	for name, t := range tables {
+		data, err := t.marshal()
+		if err != nil {
+			unlock()
+			return fmt.Errorf("table %s: %w", name, err)
+		}
+		snapshot[name] = data
+	}
+	unlock()
+
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// Restore replaces the values of the tables by a snapshot written by Snapshot
+// in one transaction, tables missing in the snapshot are kept as they are.
+// It fails with ErrUnknownName for unknown tables, and with ErrForeignKey
+// if the restored values violate foreign keys, nothing is restored then.
+func (db *DB) Restore(r io.Reader) error {
+	var snapshot map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *Tx) error {
+		for name, data := range snapshot {
+			t, ok := tx.tables[name]
+			if !ok {
+				return fmt.Errorf("%w: table %s", ErrUnknownName, name)
+			}
+			if err := t.restore(data); err != nil {
+				return fmt.Errorf("table %s: %w", name, err)
+			}
+		}
+		// the tables reference each other, so they are checked after all are restored
+		for _, t := range tx.tables {
+			if err := t.check(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (imap *IndexMap[K, V]) marshal() ([]byte, error) {
+	return json.Marshal(imap.primaryIndex.inner)
+}
+
+func (imap *IndexMap[K, V]) restore(data []byte) error {
+	values := make(map[K]*V)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	var changes []Change[K, V]
+	for key := range imap.primaryIndex.inner {
+		old := imap.del(key)
+		changes = append(changes, Change[K, V]{Kind: Removed, OldKey: key, Old: old})
+	}
+	for _, value := range values {
+		imap.put(value)
+		changes = append(changes, Change[K, V]{Kind: Inserted, NewKey: imap.primaryIndex.extractField(value), New: value})
+	}
+	imap.emit(changes...)
+	return nil
+}
+
+func (imap *IndexMap[K, V]) check() error {
+	for _, value := range imap.primaryIndex.inner {
+		if err := imap.validate(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
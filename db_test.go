@@ -0,0 +1,124 @@
+package indexmap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	PersonsTable = "persons"
+	OrdersTable  = "orders"
+)
+
+// createDB has the persons and their orders, deleting persons cascades.
+func createDB(t *testing.T) *DB {
+	persons, orders := createPersonOrders(t, Cascade)
+	db := NewDB()
+	assert.NoError(t, AddTable(db, PersonsTable, persons))
+	assert.NoError(t, AddTable(db, OrdersTable, orders))
+	return db
+}
+
+func TestDB_Tables(t *testing.T) {
+	db := createDB(t)
+	assert.Equal(t, []string{OrdersTable, PersonsTable}, db.Tables())
+
+	persons, err := GetTable[int64, Person](db, PersonsTable)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, persons.Len())
+
+	_, err = GetTable[int64, Order](db, PersonsTable)
+	assert.ErrorIs(t, err, ErrTableType)
+	_, err = GetTable[int64, Person](db, "nothing")
+	assert.ErrorIs(t, err, ErrUnknownName)
+	assert.ErrorIs(t, AddTable(db, PersonsTable, CreateTestMap(0)), ErrDuplicateName)
+
+	assert.True(t, db.DropTable(PersonsTable))
+	assert.False(t, db.DropTable(PersonsTable))
+	assert.Equal(t, []string{OrdersTable}, db.Tables())
+	assert.Equal(t, 100, persons.Len())
+}
+
+func TestDB_OnChange(t *testing.T) {
+	db := createDB(t)
+	persons, _ := GetTable[int64, Person](db, PersonsTable)
+
+	var changes []TableChange
+	cancel := db.OnChange(func(change TableChange) {
+		changes = append(changes, change)
+	})
+
+	persons.Remove(1)
+	assert.Len(t, changes, 7)
+	assert.Equal(t, TableChange{Table: PersonsTable, Kind: Removed, OldKey: int64(1), Old: changes[0].Old}, changes[0])
+	assert.IsType(t, &Person{}, changes[0].Old)
+	for _, change := range changes[1:] {
+		assert.Equal(t, OrdersTable, change.Table)
+		assert.Equal(t, Removed, change.Kind)
+		assert.Nil(t, change.New)
+	}
+
+	persons.Insert(&Person{ID: 1000})
+	assert.Equal(t, TableChange{Table: PersonsTable, Kind: Inserted, NewKey: int64(1000), New: persons.Get(1000)}, changes[7])
+
+	// dropped tables aren't part of the feed
+	db.DropTable(PersonsTable)
+	persons.Remove(1000)
+	assert.Len(t, changes, 8)
+
+	cancel()
+	db.Update(func(tx *Tx) error {
+		orders, _ := GetTxTable[int64, Order](tx, OrdersTable)
+		return orders.Clear()
+	})
+	assert.Len(t, changes, 8)
+}
+
+func TestDB_Snapshot(t *testing.T) {
+	db := createDB(t)
+	var buf bytes.Buffer
+	assert.NoError(t, db.Snapshot(&buf))
+	snapshot := buf.String()
+
+	persons, _ := GetTable[int64, Person](db, PersonsTable)
+	orders, _ := GetTable[int64, Order](db, OrdersTable)
+	expectedPersons := persons.CollectValues()
+	expectedOrders := orders.GetAllBy(OrderPersonFK, int64(1))
+	persons.Clear()
+	assert.Zero(t, orders.Len())
+
+	var changes int
+	db.OnChange(func(change TableChange) {
+		changes++
+	})
+	assert.NoError(t, db.Restore(bytes.NewBufferString(snapshot)))
+	assert.Equal(t, 400, changes)
+	assert.ElementsMatch(t, expectedPersons, persons.CollectValues())
+	assert.ElementsMatch(t, expectedOrders, orders.GetAllBy(OrderPersonFK, int64(1)))
+	assert.Equal(t, 300, orders.Len())
+	assert.Len(t, persons.GetAllBy(CityIndex, expectedPersons[0].City), len(GetAllByCity(expectedPersons, expectedPersons[0].City)))
+
+	// dangling references
+	assert.ErrorIs(t, db.Restore(bytes.NewBufferString(`{"persons": {}}`)), ErrForeignKey)
+	assert.Equal(t, 100, persons.Len())
+	assert.ErrorIs(t, db.Restore(bytes.NewBufferString(`{"nothing": {}}`)), ErrUnknownName)
+	assert.Error(t, db.Restore(bytes.NewBufferString(`{"persons": []}`)))
+	assert.Equal(t, 100, persons.Len())
+
+	// tables missing in the snapshot are kept
+	assert.NoError(t, db.Restore(bytes.NewBufferString(`{"orders": {}}`)))
+	assert.Zero(t, orders.Len())
+	assert.Equal(t, 100, persons.Len())
+}
+
+func GetAllByCity(persons []*Person, city string) []*Person {
+	var result []*Person
+	for _, person := range persons {
+		if person.City == city {
+			result = append(result, person)
+		}
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+package indexmap
+
+import "errors"
+
+var (
+	// ErrUnknownName is returned if no ordering or index is registered with the given name.
+	ErrUnknownName = errors.New("indexmap: unknown ordering or index")
+	// ErrInvalidCursor is returned for cursors not created by Page.
+	ErrInvalidCursor = errors.New("indexmap: invalid cursor")
+	// ErrKeyConflict is returned if an update changes the primary key of a value
+	// to the key of another value and the KeyConflictPolicy rejects it.
+	ErrKeyConflict = errors.New("indexmap: primary key conflict")
+	// ErrDuplicateKey is returned by BulkLoad for duplicate primary keys
+	// if the DuplicatePolicy rejects them.
+	ErrDuplicateKey = errors.New("indexmap: duplicate primary key")
+	// ErrInvalidQuery is returned for queries with syntax errors and invalid predicates.
+	ErrInvalidQuery = errors.New("indexmap: invalid query")
+	// ErrReadOnly is returned for modifying the values of a View by the Try methods,
+	// and by AddTable for Views. The other methods panic with it.
+	ErrReadOnly = errors.New("indexmap: read-only map")
+	// ErrForeignKey is returned for modifications violating a foreign key.
+	ErrForeignKey = errors.New("indexmap: foreign key violation")
+	// ErrDuplicateName is returned if an index with the given name exists.
+	ErrDuplicateName = errors.New("indexmap: duplicate name")
+	// ErrInvalidOption is returned by TryNewIndexMap for invalid options.
+	ErrInvalidOption = errors.New("indexmap: invalid option")
+	// ErrTableType is returned if a table of a DB is accessed with other types.
+	ErrTableType = errors.New("indexmap: table type mismatch")
+)
@@ -0,0 +1,109 @@
+package indexmap
+
+// ChangeKind tells what happened to a value.
+type ChangeKind int
+
+const (
+	Inserted ChangeKind = iota + 1
+	Updated
+	Removed
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case Inserted:
+		return "inserted"
+	case Updated:
+		return "updated"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// Change describes a modification of the IndexMap.
+// OldKey and Old are not set for Inserted, NewKey and New are not set for Removed.
+// Old is the value as it is now, so for values modified in place by an
+// update Old and New are the same.
+type Change[K comparable, V any] struct {
+	Kind   ChangeKind
+	OldKey K
+	NewKey K
+	Old    *V
+	New    *V
+}
+
+// KeyChanged reports whether an update changed the primary key.
+func (change Change[K, V]) KeyChanged() bool {
+	return change.Kind == Updated && change.OldKey != change.NewKey
+}
+
+type listener[K comparable, V any] struct {
+	id uint64
+	fn func(change Change[K, V])
+	// batch is called once with all changes of an operation instead of fn,
+	// i.e. by views to apply them atomically
+	batch func(changes []Change[K, V])
+}
+
+// OnChange registers fn to be called for every change of the map,
+// the returned func unregisters it.
+// fn is called synchronously after the change is applied, while the map is locked,
+// so it must not call methods of the map, or else it will deadlock.
+func (imap *IndexMap[K, V]) OnChange(fn func(change Change[K, V])) (cancel func()) {
+	return imap.addListener(listener[K, V]{fn: fn})
+}
+
+func (imap *IndexMap[K, V]) addListener(l listener[K, V]) (cancel func()) {
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	return imap.listen(l)
+}
+
+// listen is the lock free version of addListener.
+func (imap *IndexMap[K, V]) listen(l listener[K, V]) (cancel func()) {
+	imap.nextListener++
+	id := imap.nextListener
+	l.id = id
+	imap.listeners = append(imap.listeners, l)
+
+	return func() {
+		imap.lock.Lock()
+		defer imap.lock.Unlock()
+
+		for i := range imap.listeners {
+			if imap.listeners[i].id == id {
+				imap.listeners = append(imap.listeners[:i:i], imap.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit calls the listeners with the changes of one operation.
+func (imap *IndexMap[K, V]) emit(changes ...Change[K, V]) {
+	if len(changes) == 0 {
+		return
+	}
+	if imap.txLog != nil {
+		// delivered when the transaction commits
+		imap.txLog.emits = append(imap.txLog.emits, func() {
+			imap.notify(changes)
+		})
+		return
+	}
+	imap.notify(changes)
+}
+
+func (imap *IndexMap[K, V]) notify(changes []Change[K, V]) {
+	for i := range imap.listeners {
+		if imap.listeners[i].batch != nil {
+			imap.listeners[i].batch(changes)
+			continue
+		}
+		for _, change := range changes {
+			imap.listeners[i].fn(change)
+		}
+	}
+}
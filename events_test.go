@@ -0,0 +1,69 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recordChanges(imap *IndexMap[int64, Person]) (*[]Change[int64, Person], func()) {
+	changes := &[]Change[int64, Person]{}
+	cancel := imap.OnChange(func(change Change[int64, Person]) {
+		*changes = append(*changes, change)
+	})
+	return changes, cancel
+}
+
+func TestIndexMap_OnChange(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}))
+	changes, cancel := recordChanges(imap)
+	persons := GenPersons()
+
+	imap.Insert(persons[0])
+	assert.Equal(t, Change[int64, Person]{Kind: Inserted, NewKey: 0, New: persons[0]}, (*changes)[0])
+
+	replacement := &Person{ID: 0, Name: "Tracer"}
+	imap.Insert(replacement)
+	assert.Equal(t, Change[int64, Person]{Kind: Updated, OldKey: 0, NewKey: 0, Old: persons[0], New: replacement}, (*changes)[1])
+
+	imap.Update(0, func(value *Person) (*Person, bool) {
+		value.ID = 7
+		return value, true
+	})
+	assert.Equal(t, Updated, (*changes)[2].Kind)
+	assert.True(t, (*changes)[2].KeyChanged())
+	assert.Equal(t, int64(0), (*changes)[2].OldKey)
+	assert.Equal(t, int64(7), (*changes)[2].NewKey)
+
+	imap.Remove(7, 8)
+	assert.Equal(t, Change[int64, Person]{Kind: Removed, OldKey: 7, Old: replacement}, (*changes)[3])
+	assert.Equal(t, 4, len(*changes))
+
+	InsertData(imap, persons)
+	imap.Clear()
+	assert.Equal(t, 4+4+4, len(*changes))
+	for _, change := range (*changes)[8:] {
+		assert.Equal(t, Removed, change.Kind)
+		assert.Equal(t, "removed", change.Kind.String())
+	}
+
+	cancel()
+	imap.Insert(persons[1])
+	assert.Equal(t, 12, len(*changes))
+}
+
+func TestIndexMap_OnChangeUnmarshal(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}))
+	changes, _ := recordChanges(imap)
+
+	err := imap.UnmarshalJSON([]byte(`{"1":{"ID":1,"Name":"Ashe"},"2":{"ID":2,"Name":"Bob"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(*changes))
+	for _, change := range *changes {
+		assert.Equal(t, Inserted, change.Kind)
+	}
+}
@@ -0,0 +1,235 @@
+package indexmap
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// fieldAccessor reads a field of a struct by a path like "Address.City",
+// the names are matched case-insensitively, embedded fields are promoted and
+// pointers are dereferenced on the way.
+type fieldAccessor struct {
+	path []fieldStep
+	// the type of the field
+	typ reflect.Type
+}
+
+type fieldStep struct {
+	index []int
+	// the struct is reached by a pointer
+	pointer bool
+}
+
+type fieldKey struct {
+	typ  reflect.Type
+	path string
+}
+
+// fieldAccessors caches the accessors by fieldKey.
+var fieldAccessors sync.Map
+
+// accessorOf returns the cached accessor of the field of the struct type by path,
+// it fails if the path doesn't name an exported field.
+func accessorOf(typ reflect.Type, path string) (*fieldAccessor, error) {
+	key := fieldKey{typ: typ, path: path}
+	if accessor, ok := fieldAccessors.Load(key); ok {
+		return accessor.(*fieldAccessor), nil
+	}
+
+	accessor := &fieldAccessor{}
+	current := typ
+	for _, name := range strings.Split(path, ".") {
+		step := fieldStep{}
+		if current.Kind() == reflect.Pointer {
+			step.pointer = true
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%s is no struct", current)
+		}
+		field, ok := current.FieldByNameFunc(func(fieldName string) bool {
+			return strings.EqualFold(fieldName, name)
+		})
+		if !ok || !field.IsExported() {
+			return nil, fmt.Errorf("%s has no field %s", current, name)
+		}
+		step.index = field.Index
+		accessor.path = append(accessor.path, step)
+		current = field.Type
+	}
+	accessor.typ = current
+
+	fieldAccessors.Store(key, accessor)
+	return accessor, nil
+}
+
+// get returns the field of the struct value, false if a pointer on the path is nil.
+func (accessor *fieldAccessor) get(value reflect.Value) (reflect.Value, bool) {
+	var err error
+	for _, step := range accessor.path {
+		if step.pointer {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		if value, err = value.FieldByIndexErr(step.index); err != nil {
+			// nil embedded pointer
+			return reflect.Value{}, false
+		}
+	}
+	return value, true
+}
+
+// literalFor converts the literal of a query to compare it with fields of the type,
+// it fails if they can't be compared.
+// Slices are compared by their elements, nil literals with nil pointers.
+func literalFor(typ reflect.Type, literal any) (any, error) {
+	if literal == nil {
+		return nil, nil
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Interface {
+		// compared by the dynamic type
+		return literal, nil
+	}
+	if (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) && typ.Elem().Kind() != reflect.Uint8 {
+		return literalFor(typ.Elem(), literal)
+	}
+	if typ == timeType {
+		if s, ok := literal.(string); ok {
+			for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("%q is no time", s)
+		}
+	}
+
+	ok := false
+	switch literal.(type) {
+	case int64, float64:
+		ok = isNumber(typ.Kind())
+	case string:
+		ok = typ.Kind() == reflect.String
+	case bool:
+		ok = typ.Kind() == reflect.Bool
+	case time.Time:
+		ok = typ == timeType
+	}
+	if !ok {
+		return nil, fmt.Errorf("can't compare %s with %#v", typ, literal)
+	}
+	return literal, nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return reflect.Int <= kind && kind <= reflect.Float64 && kind != reflect.Uintptr
+}
+
+// compareLiteral compares the value to a literal converted by literalFor,
+// ok is false if they aren't comparable, i.e. for nil pointers.
+func compareLiteral(value reflect.Value, literal any) (c int, ok bool) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return 0, false
+		}
+		value = value.Elem()
+	}
+
+	kind := value.Kind()
+	switch literal := literal.(type) {
+	case int64:
+		switch {
+		case reflect.Int <= kind && kind <= reflect.Int64:
+			return cmp.Compare(value.Int(), literal), true
+		case reflect.Uint <= kind && kind <= reflect.Uint64:
+			if literal < 0 {
+				return 1, true
+			}
+			return cmp.Compare(value.Uint(), uint64(literal)), true
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			return cmp.Compare(value.Float(), float64(literal)), true
+		}
+	case float64:
+		switch {
+		case reflect.Int <= kind && kind <= reflect.Int64:
+			return cmp.Compare(float64(value.Int()), literal), true
+		case reflect.Uint <= kind && kind <= reflect.Uint64:
+			return cmp.Compare(float64(value.Uint()), literal), true
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			return cmp.Compare(value.Float(), literal), true
+		}
+	case string:
+		if kind == reflect.String {
+			return cmp.Compare(value.String(), literal), true
+		}
+	case bool:
+		if kind == reflect.Bool {
+			switch {
+			case value.Bool() == literal:
+				return 0, true
+			case literal:
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if t, ok := value.Interface().(time.Time); ok {
+			return t.Compare(literal), true
+		}
+	}
+	return 0, false
+}
+
+// compareValues compares two values of a field, for ORDER BY.
+// Missing values and nil pointers are ordered first.
+func compareValues(value1, value2 reflect.Value) int {
+	for value1.IsValid() && (value1.Kind() == reflect.Pointer || value1.Kind() == reflect.Interface) {
+		value1 = value1.Elem()
+	}
+	for value2.IsValid() && (value2.Kind() == reflect.Pointer || value2.Kind() == reflect.Interface) {
+		value2 = value2.Elem()
+	}
+	switch {
+	case !value1.IsValid() && !value2.IsValid():
+		return 0
+	case !value1.IsValid():
+		return -1
+	case !value2.IsValid():
+		return 1
+	}
+
+	kind := value1.Kind()
+	switch {
+	case reflect.Int <= kind && kind <= reflect.Int64:
+		return cmp.Compare(value1.Int(), value2.Int())
+	case reflect.Uint <= kind && kind <= reflect.Uint64:
+		return cmp.Compare(value1.Uint(), value2.Uint())
+	case kind == reflect.Float32 || kind == reflect.Float64:
+		return cmp.Compare(value1.Float(), value2.Float())
+	case kind == reflect.String:
+		return cmp.Compare(value1.String(), value2.String())
+	case kind == reflect.Bool:
+		return cmp.Compare(boolInt(value1.Bool()), boolInt(value2.Bool()))
+	case value1.Type() == timeType:
+		return value1.Interface().(time.Time).Compare(value2.Interface().(time.Time))
+	}
+	return sortKeyOf(value1.Interface()).compare(sortKeyOf(value2.Interface()))
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,209 @@
+package indexmap
+
+import "fmt"
+
+// DeletePolicy decides what happens to the values referencing a removed value.
+type DeletePolicy int
+
+const (
+	// Restrict rejects removing values that are referenced
+	// with ErrForeignKey. This is the default.
+	Restrict DeletePolicy = iota
+	// Cascade removes the referencing values as well.
+	Cascade
+	// SetNull clears the references by ForeignKey.SetNull.
+	SetNull
+)
+
+// ForeignKey declares that the values of a child map reference values of a parent map
+// by their primary key, see AddForeignKey.
+type ForeignKey[C any, PK comparable] struct {
+	// Ref returns the referenced primary key of the parent,
+	// false for a null reference.
+	Ref func(value *C) (PK, bool)
+	// OnDelete applies to removing a referenced parent value.
+	// Changing the primary key of a referenced parent value fails with ErrForeignKey
+	// whatever the policy, the references aren't updated.
+	OnDelete DeletePolicy
+	// SetNull clears the reference of the value,
+	// it's required by the SetNull policy.
+	SetNull func(value *C)
+}
+
+// deleteHook is registered at the parent map by a foreign key.
+type deleteHook[K comparable] struct {
+	// check returns an error if removing the keys violates the foreign key
+	check func(keys []K, visited Set[fkVisit]) error
+	// apply cascades the removal of the keys
+	apply func(keys []K)
+	// referenced returns an error if one of the keys is referenced
+	referenced func(keys []K) error
+}
+
+// fkVisit stops checking cyclic cascades.
+type fkVisit struct {
+	mapID uint64
+	key   any
+}
+
+// AddForeignKey declares that the values of child reference values of parent by fk.Ref,
+// it's registered at child as keyed index by name, the referencing values of a parent key
+// are found by child.GetAllBy(name, parentKey).
+//
+// Afterwards inserting or updating child values referencing a missing parent value
+// fails with ErrForeignKey, use the Try methods like TryInsert to get the error.
+// Removing referenced parent values applies fk.OnDelete,
+// changing the primary key of referenced parent values fails with ErrForeignKey.
+// Both maps are modified atomically, every modification of one of them locks
+// both, and all maps related to them by other foreign keys.
+//
+// It fails with ErrDuplicateName if child has an index with the name,
+// and with ErrForeignKey if child already contains a dangling reference.
+func AddForeignKey[CK, PK comparable, C, P any](name string, child *IndexMap[CK, C], parent *IndexMap[PK, P], fk ForeignKey[C, PK]) error {
+	if fk.OnDelete == SetNull && fk.SetNull == nil {
+		return fmt.Errorf("%w: %s: SetNull policy without SetNull func", ErrForeignKey, name)
+	}
+
+	unlock := joinGroups(child, parent)
+	defer unlock()
+
+	if _, ok := child.indexes[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateName, name)
+	}
+
+	validate := func(value *C) error {
+		key, ok := fk.Ref(value)
+		if ok && parent.primaryIndex.get(key) == nil {
+			return fmt.Errorf("%w: %s references missing %v", ErrForeignKey, name, key)
+		}
+		return nil
+	}
+	for _, value := range child.primaryIndex.inner {
+		if err := validate(value); err != nil {
+			return err
+		}
+	}
+
+	index := NewSecondaryIndex(func(value *C) []any {
+		if key, ok := fk.Ref(value); ok {
+			return []any{key}
+		}
+		return nil
+	})
+	child.indexes[name] = index
+	child.primaryIndex.iterate(func(_ CK, value *C) {
+		index.insert(value)
+	})
+	child.validators = append(child.validators, validate)
+
+	// the keys of the child values referencing the parent keys
+	referencing := func(keys []PK) []CK {
+		var childKeys []CK
+		for _, key := range keys {
+			for value := range index.get(key).all() {
+				childKeys = append(childKeys, child.primaryIndex.extractField(value))
+			}
+		}
+		return childKeys
+	}
+
+	referenced := func(keys []PK) error {
+		for _, key := range keys {
+			if index.get(key).len() > 0 {
+				return fmt.Errorf("%w: %s references %v", ErrForeignKey, name, key)
+			}
+		}
+		return nil
+	}
+	hook := deleteHook[PK]{referenced: referenced}
+	switch fk.OnDelete {
+	case Restrict:
+		hook.check = func(keys []PK, _ Set[fkVisit]) error {
+			return referenced(keys)
+		}
+	case Cascade:
+		hook.check = func(keys []PK, visited Set[fkVisit]) error {
+			return child.checkDelete(referencing(keys), visited)
+		}
+		hook.apply = func(keys []PK) {
+			// checked before, it can't fail
+			_ = child.remove(referencing(keys)...)
+		}
+	case SetNull:
+		hook.apply = func(keys []PK) {
+			for _, key := range referencing(keys) {
+				_, _ = child.update(key, func(old *C) *C {
+					fk.SetNull(old)
+					return old
+				})
+			}
+		}
+	}
+	parent.deleteHooks = append(parent.deleteHooks, hook)
+	return nil
+}
+
+// validate checks the foreign keys of the value.
+func (imap *IndexMap[K, V]) validate(value *V) error {
+	for _, validate := range imap.validators {
+		if err := validate(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDelete checks the foreign keys referencing the removed keys,
+// visited are the keys checked before by cascades.
+func (imap *IndexMap[K, V]) checkDelete(keys []K, visited Set[fkVisit]) error {
+	if len(imap.deleteHooks) == 0 || len(keys) == 0 {
+		return nil
+	}
+	if visited == nil {
+		visited = make(Set[fkVisit])
+	}
+	unvisited := make([]K, 0, len(keys))
+	for _, key := range keys {
+		visit := fkVisit{mapID: imap.id, key: key}
+		if !visited.Contain(visit) {
+			visited.Insert(visit)
+			unvisited = append(unvisited, key)
+		}
+	}
+
+	for _, hook := range imap.deleteHooks {
+		if hook.check == nil {
+			continue
+		}
+		if err := hook.check(unvisited, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRename checks that the keys given up by updates changing the primary key
+// aren't referenced by foreign keys, the references would dangle.
+func (imap *IndexMap[K, V]) checkRename(keys []K) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, hook := range imap.deleteHooks {
+		if err := hook.referenced(keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterDelete cascades the removed keys.
+func (imap *IndexMap[K, V]) afterDelete(keys []K) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, hook := range imap.deleteHooks {
+		if hook.apply != nil {
+			hook.apply(keys)
+		}
+	}
+}
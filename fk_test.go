@@ -0,0 +1,307 @@
+package indexmap
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const OrderPersonFK = "order_person"
+
+// orderPersonFK references persons by Order.PersonID, -1 is null.
+func orderPersonFK(policy DeletePolicy) ForeignKey[Order, int64] {
+	return ForeignKey[Order, int64]{
+		Ref: func(value *Order) (int64, bool) {
+			return value.PersonID, value.PersonID >= 0
+		},
+		OnDelete: policy,
+		SetNull: func(value *Order) {
+			value.PersonID = -1
+		},
+	}
+}
+
+func createPersonOrders(t *testing.T, policy DeletePolicy) (*IndexMap[int64, Person], *IndexMap[int64, Order]) {
+	persons := CreateTestMap(100)
+	orders := createOrderMap(100, 0)
+	for i := 0; i < 300; i++ {
+		orders.Insert(&Order{ID: int64(i), PersonID: int64(i % 50), Item: names[i%len(names)]})
+	}
+	assert.NoError(t, AddForeignKey(OrderPersonFK, orders, persons, orderPersonFK(policy)))
+	return persons, orders
+}
+
+func assertNoOrphans(t *testing.T, persons *IndexMap[int64, Person], orders *IndexMap[int64, Order]) {
+	for order, person := range LeftJoin(orders, persons, func(value *Order) any {
+		return value.PersonID
+	}, PrimaryKeyName) {
+		assert.True(t, person != nil || order.PersonID < 0, "orphan %+v", order)
+	}
+}
+
+func TestAddForeignKey(t *testing.T) {
+	persons := CreateTestMap(100)
+	orders := createOrderMap(100, 300)
+
+	// createOrderMap has dangling references
+	err := AddForeignKey(OrderPersonFK, orders, persons, orderPersonFK(Restrict))
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.Nil(t, orders.GetAllBy(OrderPersonFK, int64(1)))
+
+	orders.RemoveBy(PersonIDIndex, int64(100), int64(101), int64(102))
+	for id := int64(103); id < 150; id++ {
+		orders.RemoveBy(PersonIDIndex, id)
+	}
+	assert.NoError(t, AddForeignKey(OrderPersonFK, orders, persons, orderPersonFK(Restrict)))
+	assert.ElementsMatch(t, orders.GetAllBy(PersonIDIndex, int64(1)), orders.GetAllBy(OrderPersonFK, int64(1)))
+
+	err = AddForeignKey(OrderPersonFK, orders, persons, orderPersonFK(Restrict))
+	assert.ErrorIs(t, err, ErrDuplicateName)
+	err = AddForeignKey("other", orders, persons, ForeignKey[Order, int64]{Ref: orderPersonFK(Restrict).Ref, OnDelete: SetNull})
+	assert.ErrorIs(t, err, ErrForeignKey)
+}
+
+func TestForeignKey_Insert(t *testing.T) {
+	persons, orders := createPersonOrders(t, Restrict)
+	n := orders.Len()
+
+	err := orders.TryInsert(&Order{ID: 1000, PersonID: 1}, &Order{ID: 1001, PersonID: 1000})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.Equal(t, n, orders.Len())
+	orders.Insert(&Order{ID: 1001, PersonID: 1000})
+	assert.False(t, orders.Contains(1001))
+	assert.False(t, orders.InsertIfAbsent(&Order{ID: 1001, PersonID: 1000}))
+
+	// null references are fine
+	assert.NoError(t, orders.TryInsert(&Order{ID: 1002, PersonID: -1}))
+
+	persons.Insert(&Person{ID: 1000, Name: "Late"})
+	assert.NoError(t, orders.TryInsert(&Order{ID: 1001, PersonID: 1000}))
+
+	// updates are rolled back
+	_, err = orders.TryUpdate(1001, func(value *Order) (*Order, bool) {
+		value.PersonID = 2000
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.Equal(t, int64(1000), orders.Get(1001).PersonID)
+	assert.Len(t, orders.GetAllBy(OrderPersonFK, int64(1000)), 1)
+
+	err = orders.TryUpdateBy(OrderPersonFK, int64(1), func(value *Order) (*Order, bool) {
+		value.PersonID++
+		if value.ID > 100 {
+			value.PersonID = 2000
+		}
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	for _, order := range orders.GetAllBy(OrderPersonFK, int64(1)) {
+		assert.Equal(t, int64(1), order.PersonID)
+	}
+	assertNoOrphans(t, persons, orders)
+}
+
+func TestForeignKey_Restrict(t *testing.T) {
+	persons, orders := createPersonOrders(t, Restrict)
+
+	// all or nothing
+	assert.ErrorIs(t, persons.TryRemove(99, 1), ErrForeignKey)
+	assert.True(t, persons.Contains(99))
+	assert.ErrorIs(t, persons.TryRemoveBy(CityIndex, persons.Get(1).City), ErrForeignKey)
+	assert.ErrorIs(t, persons.TryClear(), ErrForeignKey)
+	persons.Remove(1)
+	assert.True(t, persons.Contains(1))
+	assert.Equal(t, 100, persons.Len())
+
+	// changing the key removes it as well
+	_, err := persons.TryUpdate(1, func(value *Person) (*Person, bool) {
+		value.ID = 1000
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.Equal(t, int64(1), persons.Get(1).ID)
+	assert.NotNil(t, persons.Compute(1, func(key int64, old *Person) *Person { return nil }))
+	assert.True(t, persons.Contains(1))
+
+	// unreferenced
+	assert.NoError(t, persons.TryRemove(99))
+	orders.RemoveBy(OrderPersonFK, int64(1))
+	assert.NoError(t, persons.TryRemove(1))
+	assertNoOrphans(t, persons, orders)
+}
+
+func TestForeignKey_RestrictOverwrite(t *testing.T) {
+	persons, _ := createPersonOrders(t, Restrict)
+	persons.SetKeyConflictPolicy(OverwriteKeyConflict)
+	before := persons.CollectValues()
+
+	// the rename of 1 fails, the overwritten value of 60 stays
+	_, err := persons.TryUpdate(1, func(value *Person) (*Person, bool) {
+		value.ID = 60
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.ElementsMatch(t, before, persons.CollectValues())
+
+	// the overwritten values of 11 and 80 come back with the rollback
+	persons.AddIndex("pair", NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.ID == 1 || value.ID == 70}
+	}))
+	err = persons.TryUpdateBy("pair", true, func(value *Person) (*Person, bool) {
+		value.ID += 10
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.ElementsMatch(t, before, persons.CollectValues())
+	for _, value := range before {
+		assert.Same(t, value, persons.Get(value.ID))
+	}
+}
+
+func TestForeignKey_Cascade(t *testing.T) {
+	persons, orders := createPersonOrders(t, Cascade)
+
+	var removed []int64
+	orders.OnChange(func(change Change[int64, Order]) {
+		if change.Kind == Removed {
+			removed = append(removed, change.OldKey)
+		}
+	})
+
+	persons.Remove(1)
+	assert.Len(t, removed, 6)
+	assert.Empty(t, orders.GetAllBy(PersonIDIndex, int64(1)))
+
+	// renaming a referenced key fails instead of removing the references
+	_, err := persons.TryUpdate(2, func(value *Person) (*Person, bool) {
+		value.ID = 1000
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.True(t, persons.Contains(2))
+	assert.False(t, persons.Contains(1000))
+	assert.Len(t, orders.GetAllBy(PersonIDIndex, int64(2)), 6)
+	err = persons.TryUpdateBy(CityIndex, persons.Get(2).City, func(value *Person) (*Person, bool) {
+		value.ID += 1000
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.True(t, persons.Contains(2))
+	assert.Len(t, orders.GetAllBy(PersonIDIndex, int64(2)), 6)
+
+	// unreferenced keys can be renamed
+	_, err = persons.TryUpdate(60, func(value *Person) (*Person, bool) {
+		value.ID = 1000
+		return value, true
+	})
+	assert.NoError(t, err)
+	assert.True(t, persons.Contains(1000))
+
+	persons.RemoveBy(CityIndex, cities[0])
+	assertNoOrphans(t, persons, orders)
+
+	persons.Clear()
+	assert.Zero(t, orders.Len())
+}
+
+type OrderItem struct {
+	ID      int64
+	OrderID int64
+}
+
+func TestForeignKey_CascadeRestricted(t *testing.T) {
+	persons, orders := createPersonOrders(t, Cascade)
+	items := NewIndexMap(NewPrimaryIndex(func(value *OrderItem) int64 {
+		return value.ID
+	}))
+	items.Insert(&OrderItem{ID: 1, OrderID: 1})
+	assert.NoError(t, AddForeignKey("item_order", items, orders, ForeignKey[OrderItem, int64]{
+		Ref: func(value *OrderItem) (int64, bool) {
+			return value.OrderID, true
+		},
+	}))
+
+	// order 1 of person 1 has an item
+	assert.ErrorIs(t, persons.TryRemove(1), ErrForeignKey)
+	assert.True(t, persons.Contains(1))
+	assert.Len(t, orders.GetAllBy(OrderPersonFK, int64(1)), 6)
+
+	items.Remove(1)
+	assert.NoError(t, persons.TryRemove(1))
+	assert.Empty(t, orders.GetAllBy(OrderPersonFK, int64(1)))
+}
+
+func TestForeignKey_SetNull(t *testing.T) {
+	persons, orders := createPersonOrders(t, SetNull)
+
+	var updated int
+	orders.OnChange(func(change Change[int64, Order]) {
+		if change.Kind == Updated {
+			updated++
+		}
+	})
+
+	persons.Remove(1)
+	assert.Equal(t, 6, updated)
+	assert.Empty(t, orders.GetAllBy(OrderPersonFK, int64(1)))
+	assert.Len(t, orders.GetAllBy(PersonIDIndex, int64(-1)), 6)
+	assert.Equal(t, 300, orders.Len())
+	assertNoOrphans(t, persons, orders)
+
+	// renaming a referenced key keeps the references
+	_, err := persons.TryUpdate(2, func(value *Person) (*Person, bool) {
+		value.ID = 1000
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrForeignKey)
+	assert.Equal(t, 6, updated)
+	assert.Len(t, orders.GetAllBy(OrderPersonFK, int64(2)), 6)
+}
+
+type Employee struct {
+	ID      int64
+	Manager int64
+}
+
+func TestForeignKey_SelfCascade(t *testing.T) {
+	employees := NewIndexMap(NewPrimaryIndex(func(value *Employee) int64 {
+		return value.ID
+	}))
+	employees.Insert(&Employee{ID: 1, Manager: 1}, &Employee{ID: 2, Manager: 1}, &Employee{ID: 3, Manager: 2}, &Employee{ID: 4, Manager: 4})
+	assert.NoError(t, AddForeignKey("manager", employees, employees, ForeignKey[Employee, int64]{
+		Ref: func(value *Employee) (int64, bool) {
+			return value.Manager, true
+		},
+		OnDelete: Cascade,
+	}))
+
+	employees.Remove(1)
+	assert.Equal(t, []int64{4}, employees.CollectKeys())
+}
+
+func TestForeignKey_Concurrent(t *testing.T) {
+	persons, orders := createPersonOrders(t, Cascade)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(seed int64) {
+			defer wg.Done()
+			myRand := rand.New(rand.NewSource(seed))
+			for j := 0; j < 200; j++ {
+				_ = orders.TryInsert(&Order{ID: int64(1000 + myRand.Intn(1000)), PersonID: int64(myRand.Intn(100))})
+			}
+		}(int64(i))
+		go func(seed int64) {
+			defer wg.Done()
+			myRand := rand.New(rand.NewSource(seed))
+			for j := 0; j < 50; j++ {
+				persons.Remove(int64(myRand.Intn(100)))
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	assertNoOrphans(t, persons, orders)
+}
@@ -0,0 +1,421 @@
+package indexmap
+
+import (
+	"math"
+	"slices"
+)
+
+// earthRadius is the mean earth radius in meters.
+const earthRadius = 6371008.8
+
+// Point is a geographic coordinate in degrees.
+type Point struct {
+	Lat, Lon float64
+}
+
+// Rect returns the rectangle containing only the point.
+func (p Point) Rect() Rect {
+	return Rect{Min: p, Max: p}
+}
+
+// Rect is a bounding box in degrees, Min is the south west corner,
+// Max the north east corner. Boxes crossing the antimeridian are not supported,
+// split them into two.
+type Rect struct {
+	Min, Max Point
+}
+
+func (r Rect) intersects(other Rect) bool {
+	return r.Min.Lat <= other.Max.Lat && other.Min.Lat <= r.Max.Lat &&
+		r.Min.Lon <= other.Max.Lon && other.Min.Lon <= r.Max.Lon
+}
+
+// Distance returns the great circle distance in meters.
+func Distance(p1, p2 Point) float64 {
+	lat1, lat2 := p1.Lat*math.Pi/180, p2.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (p2.Lon - p1.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(min(h, 1)))
+}
+
+// distanceToRect returns the distance in meters from p to the nearest point of r.
+func distanceToRect(p Point, r Rect) float64 {
+	nearest := Point{
+		Lat: min(max(p.Lat, r.Min.Lat), r.Max.Lat),
+		Lon: min(max(p.Lon, r.Min.Lon), r.Max.Lon),
+	}
+	return Distance(p, nearest)
+}
+
+// DefaultGeoCellSize is the grid cell size of a GeoIndex in degrees, about 11 km.
+const DefaultGeoCellSize = 0.1
+
+// maxGeoCells limits the cells a shape is stored in,
+// larger shapes are checked on every query instead.
+const maxGeoCells = 1024
+
+// GeoIndex is a spatial secondary index over points and rectangles,
+// stored in a grid of cells of equal size in degrees.
+// Added by AddIndex it is searched by IndexMap.InBBox, IndexMap.Within
+// and IndexMap.Nearest.
+type GeoIndex[V any] struct {
+	extractField func(value *V) []Rect
+	cellSize     float64
+	lonCells     int
+
+	cells  map[geoCell]Set[*V]
+	shapes map[*V][]Rect
+	// values with shapes too large for the grid
+	large Set[*V]
+}
+
+type geoCell struct {
+	lat, lon int
+}
+
+// Create a geospatial index,
+// the extractField func returns the shapes of the value, use Point.Rect for points.
+// The cellSize in degrees should be about the size of typical queries,
+// DefaultGeoCellSize is used if it isn't positive.
+func NewGeoIndex[V any](extractField func(value *V) []Rect, cellSize float64) *GeoIndex[V] {
+	if cellSize <= 0 {
+		cellSize = DefaultGeoCellSize
+	}
+	// the cells wrap around at the antimeridian
+	lonCells := int(math.Ceil(360 / cellSize))
+	return &GeoIndex[V]{
+		extractField: extractField,
+		cellSize:     360 / float64(lonCells),
+		lonCells:     lonCells,
+		cells:        make(map[geoCell]Set[*V]),
+		shapes:       make(map[*V][]Rect),
+		large:        make(Set[*V]),
+	}
+}
+
+func (index *GeoIndex[V]) cellOf(p Point) geoCell {
+	// the north pole and the antimeridian belong to the last cells
+	return geoCell{
+		lat: min(int(math.Floor((p.Lat+90)/index.cellSize)), int(math.Ceil(180/index.cellSize))-1),
+		lon: min(int(math.Floor((p.Lon+180)/index.cellSize)), index.lonCells-1),
+	}
+}
+
+// eachCell calls fn for the cells covered by r, false if there are too many of them.
+func (index *GeoIndex[V]) eachCell(r Rect, limit int, fn func(cell geoCell)) bool {
+	low, high := index.cellOf(r.Min), index.cellOf(r.Max)
+	if (high.lat-low.lat+1)*(high.lon-low.lon+1) > limit {
+		return false
+	}
+	for lat := low.lat; lat <= high.lat; lat++ {
+		for lon := low.lon; lon <= high.lon; lon++ {
+			fn(geoCell{lat, lon})
+		}
+	}
+	return true
+}
+
+func (index *GeoIndex[V]) insert(elem *V) {
+	shapes := index.extractField(elem)
+	if len(shapes) == 0 {
+		return
+	}
+	index.shapes[elem] = shapes
+	for _, shape := range shapes {
+		fits := index.eachCell(shape, maxGeoCells, func(cell geoCell) {
+			elems, ok := index.cells[cell]
+			if !ok {
+				elems = make(Set[*V])
+				index.cells[cell] = elems
+			}
+			elems.Insert(elem)
+		})
+		if !fits {
+			index.large.Insert(elem)
+		}
+	}
+}
+
+func (index *GeoIndex[V]) remove(elem *V) {
+	shapes, ok := index.shapes[elem]
+	if !ok {
+		return
+	}
+	delete(index.shapes, elem)
+	index.large.Remove(elem)
+	for _, shape := range shapes {
+		index.eachCell(shape, maxGeoCells, func(cell geoCell) {
+			if elems, ok := index.cells[cell]; ok {
+				elems.Remove(elem)
+				if len(elems) == 0 {
+					delete(index.cells, cell)
+				}
+			}
+		})
+	}
+}
+
+func (index *GeoIndex[V]) clear() {
+	index.cells = make(map[geoCell]Set[*V])
+	index.shapes = make(map[*V][]Rect)
+	index.large = make(Set[*V])
+}
+
+// candidates returns the values possibly intersecting r.
+func (index *GeoIndex[V]) candidates(r Rect) Set[*V] {
+	result := make(Set[*V])
+	fits := index.eachCell(r, len(index.cells), func(cell geoCell) {
+		for elem := range index.cells[cell] {
+			result.Insert(elem)
+		}
+	})
+	if !fits {
+		// scanning all shapes is cheaper than visiting the cells
+		for elem := range index.shapes {
+			result.Insert(elem)
+		}
+		return result
+	}
+	for elem := range index.large {
+		result.Insert(elem)
+	}
+	return result
+}
+
+func (index *GeoIndex[V]) distance(p Point, elem *V) float64 {
+	distance := math.Inf(1)
+	for _, shape := range index.shapes[elem] {
+		distance = min(distance, distanceToRect(p, shape))
+	}
+	return distance
+}
+
+func (index *GeoIndex[V]) inBBox(r Rect) []*V {
+	var result []*V
+	for elem := range index.candidates(r) {
+		for _, shape := range index.shapes[elem] {
+			if shape.intersects(r) {
+				result = append(result, elem)
+				break
+			}
+		}
+	}
+	return result
+}
+
+type geoHit[V any] struct {
+	value    *V
+	distance float64
+}
+
+func sortGeoHits[V any](hits []geoHit[V]) []*V {
+	slices.SortStableFunc(hits, func(hit1, hit2 geoHit[V]) int {
+		switch {
+		case hit1.distance < hit2.distance:
+			return -1
+		case hit1.distance > hit2.distance:
+			return 1
+		}
+		return 0
+	})
+	values := make([]*V, len(hits))
+	for i := range hits {
+		values[i] = hits[i].value
+	}
+	return values
+}
+
+func (index *GeoIndex[V]) within(center Point, radius float64) []*V {
+	dLat := radius / earthRadius * 180 / math.Pi
+	bbox := Rect{Min: Point{center.Lat - dLat, -180}, Max: Point{center.Lat + dLat, 180}}
+	if cos := math.Cos((math.Abs(center.Lat) + dLat) * math.Pi / 180); cos > 0 {
+		if dLon := dLat / cos; dLon < 180 {
+			bbox.Min.Lon, bbox.Max.Lon = center.Lon-dLon, center.Lon+dLon
+		}
+	}
+
+	// the box may cross the antimeridian
+	boxes := []Rect{bbox}
+	switch {
+	case bbox.Min.Lon < -180:
+		boxes = []Rect{
+			{Min: Point{bbox.Min.Lat, bbox.Min.Lon + 360}, Max: Point{bbox.Max.Lat, 180}},
+			{Min: Point{bbox.Min.Lat, -180}, Max: bbox.Max},
+		}
+	case bbox.Max.Lon > 180:
+		boxes = []Rect{
+			{Min: bbox.Min, Max: Point{bbox.Max.Lat, 180}},
+			{Min: Point{bbox.Min.Lat, -180}, Max: Point{bbox.Max.Lat, bbox.Max.Lon - 360}},
+		}
+	}
+	candidates := make(Set[*V])
+	for _, box := range boxes {
+		for elem := range index.candidates(box) {
+			candidates.Insert(elem)
+		}
+	}
+
+	var hits []geoHit[V]
+	for elem := range candidates {
+		if distance := index.distance(center, elem); distance <= radius {
+			hits = append(hits, geoHit[V]{elem, distance})
+		}
+	}
+	return sortGeoHits(hits)
+}
+
+func (index *GeoIndex[V]) nearest(p Point, k int) []*V {
+	if k <= 0 || len(index.shapes) == 0 {
+		return nil
+	}
+
+	seen := make(Set[*V])
+	var hits []geoHit[V]
+	visit := func(elem *V) {
+		if !seen.Contain(elem) {
+			seen.Insert(elem)
+			hits = append(hits, geoHit[V]{elem, index.distance(p, elem)})
+		}
+	}
+	for elem := range index.large {
+		visit(elem)
+	}
+
+	center := index.cellOf(p)
+	latCells := int(math.Ceil(180 / index.cellSize))
+	for ring := 0; len(seen) < len(index.shapes); ring++ {
+		if 8*ring > len(index.shapes)+len(index.cells) || ring > max(latCells, index.lonCells) {
+			// the rings got larger than the data, check the rest directly
+			for elem := range index.shapes {
+				visit(elem)
+			}
+			break
+		}
+		index.eachRingCell(center, ring, func(cell geoCell) {
+			for elem := range index.cells[cell] {
+				visit(elem)
+			}
+		})
+
+		// everything outside of the ring is at least this far away
+		if len(hits) >= k && kthDistance(hits, k) <= index.ringDistance(p, center, ring) {
+			break
+		}
+	}
+
+	values := sortGeoHits(hits)
+	return values[:min(k, len(values))]
+}
+
+// eachRingCell calls fn once for every cell with the chebyshev distance ring to center,
+// the longitude wraps around.
+func (index *GeoIndex[V]) eachRingCell(center geoCell, ring int, fn func(cell geoCell)) {
+	latCells := int(math.Ceil(180 / index.cellSize))
+	wrap := func(lon int) int {
+		return ((lon % index.lonCells) + index.lonCells) % index.lonCells
+	}
+
+	west, east := center.lon-ring, center.lon+ring
+	if east-west+1 >= index.lonCells {
+		west, east = 0, index.lonCells-1
+	}
+	row := func(lat int) {
+		if lat < 0 || lat >= latCells {
+			return
+		}
+		for lon := west; lon <= east; lon++ {
+			fn(geoCell{lat, wrap(lon)})
+		}
+	}
+	row(center.lat - ring)
+	if ring > 0 {
+		row(center.lat + ring)
+	}
+
+	// the columns between are new unless the inner rings covered all longitudes
+	if 2*ring-1 >= index.lonCells {
+		return
+	}
+	left, right := wrap(center.lon-ring), wrap(center.lon+ring)
+	for lat := max(center.lat-ring+1, 0); lat < min(center.lat+ring, latCells); lat++ {
+		fn(geoCell{lat, left})
+		if right != left {
+			fn(geoCell{lat, right})
+		}
+	}
+}
+
+// ringDistance is a lower bound of the distance from p to the cells outside the ring.
+func (index *GeoIndex[V]) ringDistance(p Point, center geoCell, ring int) float64 {
+	south := float64(center.lat-ring)*index.cellSize - 90
+	north := float64(center.lat+ring+1)*index.cellSize - 90
+	west := float64(center.lon-ring)*index.cellSize - 180
+	east := float64(center.lon+ring+1)*index.cellSize - 180
+
+	latDistance := math.Inf(1)
+	if south > -90 {
+		latDistance = (p.Lat - south) * math.Pi / 180 * earthRadius
+	}
+	if north < 90 {
+		latDistance = min(latDistance, (north-p.Lat)*math.Pi/180*earthRadius)
+	}
+	if east-west >= 360 {
+		// the ring covers all longitudes
+		return latDistance
+	}
+	// the distance to the great circle of the nearer meridian
+	dLon := min(p.Lon-west, east-p.Lon) * math.Pi / 180
+	lonDistance := math.Asin(math.Abs(math.Sin(dLon))*math.Cos(p.Lat*math.Pi/180)) * earthRadius
+	return min(latDistance, lonDistance)
+}
+
+func kthDistance[V any](hits []geoHit[V], k int) float64 {
+	distances := make([]float64, len(hits))
+	for i := range hits {
+		distances[i] = hits[i].distance
+	}
+	slices.Sort(distances)
+	return distances[k-1]
+}
+
+// InBBox returns the values of the named GeoIndex with a shape intersecting the box,
+// nil if the index doesn't exist.
+func (imap *IndexMap[K, V]) InBBox(indexName string, bbox Rect) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*GeoIndex[V])
+	if !ok {
+		return nil
+	}
+	return index.inBBox(bbox)
+}
+
+// Within returns the values of the named GeoIndex with a shape within radius meters
+// of center, ordered by ascending distance,
+// nil if the index doesn't exist.
+func (imap *IndexMap[K, V]) Within(indexName string, center Point, radius float64) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*GeoIndex[V])
+	if !ok {
+		return nil
+	}
+	return index.within(center, radius)
+}
+
+// Nearest returns the k values of the named GeoIndex nearest to p,
+// ordered by ascending distance,
+// nil if the index doesn't exist.
+func (imap *IndexMap[K, V]) Nearest(indexName string, p Point, k int) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*GeoIndex[V])
+	if !ok {
+		return nil
+	}
+	return index.nearest(p, k)
+}
@@ -0,0 +1,203 @@
+package indexmap
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const GeoIndexName = "geo"
+
+type Shop struct {
+	ID       int64
+	Name     string
+	Location Point
+	// the delivery area, if any
+	Area *Rect
+}
+
+func createShopMap(n int, cellSize float64, myRand *rand.Rand) *IndexMap[int64, Shop] {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Shop) int64 {
+		return value.ID
+	}))
+	imap.AddIndex(NameIndex, NewSecondaryIndex(func(value *Shop) []any {
+		return []any{value.Name}
+	}))
+	imap.AddIndex(GeoIndexName, NewGeoIndex(func(value *Shop) []Rect {
+		shapes := []Rect{value.Location.Rect()}
+		if value.Area != nil {
+			shapes = append(shapes, *value.Area)
+		}
+		return shapes
+	}, cellSize))
+
+	for i := 0; i < n; i++ {
+		imap.Insert(randomShop(int64(i), myRand))
+	}
+	return imap
+}
+
+func randomShop(id int64, myRand *rand.Rand) *Shop {
+	shop := &Shop{
+		ID:       id,
+		Name:     names[myRand.Intn(len(names))],
+		Location: Point{Lat: myRand.Float64()*180 - 90, Lon: myRand.Float64()*360 - 180},
+	}
+	// most shops are around Berlin
+	if myRand.Intn(4) > 0 {
+		shop.Location = Point{Lat: 52.5 + myRand.NormFloat64()*0.2, Lon: 13.4 + myRand.NormFloat64()*0.3}
+	}
+	if myRand.Intn(10) == 0 {
+		size := myRand.Float64() * 0.5
+		if myRand.Intn(10) == 0 {
+			size = 60
+		}
+		shop.Area = &Rect{
+			Min: shop.Location,
+			Max: Point{Lat: min(shop.Location.Lat+size, 90), Lon: min(shop.Location.Lon+size, 180)},
+		}
+	}
+	return shop
+}
+
+func shopDistance(p Point, shop *Shop) float64 {
+	distance := Distance(p, shop.Location)
+	if shop.Area != nil {
+		distance = min(distance, distanceToRect(p, *shop.Area))
+	}
+	return distance
+}
+
+func TestDistance(t *testing.T) {
+	berlin, paris := Point{52.52, 13.405}, Point{48.8566, 2.3522}
+	assert.InDelta(t, 877_000, Distance(berlin, paris), 2_000)
+	assert.InDelta(t, Distance(berlin, paris), Distance(paris, berlin), 1e-6)
+	assert.Zero(t, Distance(berlin, berlin))
+
+	// across the antimeridian
+	assert.InDelta(t, 2*math.Pi*earthRadius*0.2/360, Distance(Point{0, 179.9}, Point{0, -179.9}), 1)
+	assert.InDelta(t, math.Pi*earthRadius, Distance(Point{90, 0}, Point{-90, 0}), 1)
+
+	box := Rect{Min: Point{0, 0}, Max: Point{1, 1}}
+	assert.Zero(t, distanceToRect(Point{0.5, 0.5}, box))
+	assert.InDelta(t, Distance(Point{2, 0.5}, Point{1, 0.5}), distanceToRect(Point{2, 0.5}, box), 1e-6)
+}
+
+func TestGeoIndex(t *testing.T) {
+	myRand := rand.New(rand.NewSource(1))
+	for _, cellSize := range []float64{0, 0.05, 1, 7} {
+		imap := createShopMap(1000, cellSize, myRand)
+		checkGeoIndex(t, imap, myRand)
+
+		// updates and removes
+		for i := 0; i < 200; i++ {
+			id := int64(myRand.Intn(1000))
+			if myRand.Intn(2) == 0 {
+				imap.Remove(id)
+			} else {
+				imap.Insert(randomShop(id, myRand))
+			}
+		}
+		checkGeoIndex(t, imap, myRand)
+	}
+}
+
+func checkGeoIndex(t *testing.T, imap *IndexMap[int64, Shop], myRand *rand.Rand) {
+	shops := imap.CollectValues()
+	points := []Point{{52.5, 13.4}, {0, 179.99}, {0, -180}, {89.9, 0}, {-90, 45}}
+	for i := 0; i < 20; i++ {
+		points = append(points, randomShop(0, myRand).Location)
+	}
+
+	for _, p := range points {
+		for _, radius := range []float64{0, 1_000, 50_000, 1_000_000, 30_000_000} {
+			var expected []*Shop
+			for _, shop := range shops {
+				if shopDistance(p, shop) <= radius {
+					expected = append(expected, shop)
+				}
+			}
+			found := imap.Within(GeoIndexName, p, radius)
+			assert.Equal(t, shopIDs(expected), shopIDs(found), "%v %v", p, radius)
+			assert.True(t, slices.IsSortedFunc(found, func(shop1, shop2 *Shop) int {
+				return compareFloat(shopDistance(p, shop1), shopDistance(p, shop2))
+			}))
+		}
+
+		slices.SortStableFunc(shops, func(shop1, shop2 *Shop) int {
+			return compareFloat(shopDistance(p, shop1), shopDistance(p, shop2))
+		})
+		for _, k := range []int{0, 1, 5, 50, len(shops) + 1} {
+			found := imap.Nearest(GeoIndexName, p, k)
+			assert.Len(t, found, min(k, len(shops)))
+			for i := range found {
+				// shops at the same distance may be swapped
+				assert.Equal(t, shopDistance(p, shops[i]), shopDistance(p, found[i]), "%v %v", p, k)
+			}
+		}
+
+		bbox := Rect{Min: p, Max: Point{min(p.Lat+1, 90), min(p.Lon+2, 180)}}
+		var expected []*Shop
+		for _, shop := range shops {
+			if bbox.intersects(shop.Location.Rect()) || (shop.Area != nil && bbox.intersects(*shop.Area)) {
+				expected = append(expected, shop)
+			}
+		}
+		assert.Equal(t, shopIDs(expected), shopIDs(imap.InBBox(GeoIndexName, bbox)), "%v", bbox)
+	}
+}
+
+// shopIDs returns the sorted ids, which compares much faster than the shops.
+func shopIDs(shops []*Shop) []int64 {
+	ids := make([]int64, len(shops))
+	for i, shop := range shops {
+		ids[i] = shop.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func compareFloat(f1, f2 float64) int {
+	switch {
+	case f1 < f2:
+		return -1
+	case f1 > f2:
+		return 1
+	}
+	return 0
+}
+
+func TestGeoIndex_Unknown(t *testing.T) {
+	imap := createShopMap(10, 0, rand.New(rand.NewSource(1)))
+	assert.Nil(t, imap.Within(NameIndex, Point{}, 1000))
+	assert.Nil(t, imap.Nearest("nothing", Point{}, 1))
+	assert.Nil(t, imap.InBBox(NameIndex, Rect{Max: Point{90, 180}}))
+	assert.Len(t, imap.InBBox(GeoIndexName, Rect{Min: Point{-90, -180}, Max: Point{90, 180}}), 10)
+
+	imap.Clear()
+	assert.Empty(t, imap.Nearest(GeoIndexName, Point{}, 1))
+	assert.Empty(t, imap.Within(GeoIndexName, Point{}, 1e8))
+}
+
+func TestIntersect(t *testing.T) {
+	imap := createShopMap(1000, 0, rand.New(rand.NewSource(1)))
+	here := Point{52.5, 13.4}
+
+	nearest := imap.Nearest(GeoIndexName, here, 100)
+	found := Intersect(nearest, imap.GetAllBy(NameIndex, "James"))
+	assert.NotEmpty(t, found)
+	for _, shop := range found {
+		assert.Equal(t, "James", shop.Name)
+		assert.Contains(t, nearest, shop)
+	}
+	// the order of the first result is kept
+	assert.True(t, slices.IsSortedFunc(found, func(shop1, shop2 *Shop) int {
+		return compareFloat(shopDistance(here, shop1), shopDistance(here, shop2))
+	}))
+
+	assert.Equal(t, nearest, Intersect(nearest))
+	assert.Empty(t, Intersect(nearest, nil))
+}
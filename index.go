@@ -1,5 +1,30 @@
 package indexmap
 
+// Index is implemented by all indexes that can be added to an IndexMap by AddIndex,
+// like SecondaryIndex and TextIndex.
+// The IndexMap keeps its indexes up to date on every insert, update and remove.
+type Index[V any] interface {
+	insert(elem *V)
+	remove(elem *V)
+	clear()
+}
+
+// keyedIndex is an Index seeking values by key,
+// those can be used by GetBy, GetAllBy, RangeBy, UpdateBy, ...
+type keyedIndex[V any] interface {
+	Index[V]
+	// get returns the values of the key, the bucket is empty if there are none
+	get(key any) bucket[V]
+	iterate(fn func(key any, elems bucket[V]) bool)
+}
+
+// countedIndex is a keyedIndex knowing its size in O(1),
+// the query planner estimates the costs by it.
+type countedIndex interface {
+	// counts returns the number of distinct keys, and the sum of the values of all keys
+	counts() (keys, entries int)
+}
+
 type PrimaryIndex[K comparable, V any] struct {
 	extractField func(value *V) K
 
@@ -36,7 +61,9 @@ func (index *PrimaryIndex[K, V]) iterate(handler func(key K, value *V)) {
 type SecondaryIndex[V any] struct {
 	extractField func(value *V) []any
 
-	inner map[any]Set[*V]
+	inner map[any]bucket[V]
+	// the sum of the values of all keys
+	entries int
 }
 
 // Create a secondary index,
@@ -45,29 +72,22 @@ type SecondaryIndex[V any] struct {
 func NewSecondaryIndex[V any](extractField func(value *V) []any) *SecondaryIndex[V] {
 	return &SecondaryIndex[V]{
 		extractField: extractField,
-		inner:        make(map[any]Set[*V]),
+		inner:        make(map[any]bucket[V]),
 	}
 }
 
-func (index *SecondaryIndex[V]) get(key any) Set[*V] {
-	set, ok := index.inner[key]
-	if !ok {
-		return nil
-	}
-
-	return set
+func (index *SecondaryIndex[V]) get(key any) bucket[V] {
+	return index.inner[key]
 }
 
 func (index *SecondaryIndex[V]) insert(elem *V) {
 	keys := index.extractField(elem)
 	for i := range keys {
-		elems, ok := index.inner[keys[i]]
-		if !ok {
-			elems = make(Set[*V])
+		elems, inserted := index.inner[keys[i]].insert(elem)
+		if inserted {
+			index.entries++
 			index.inner[keys[i]] = elems
 		}
-
-		elems.Insert(elem)
 	}
 }
 
@@ -75,11 +95,35 @@ func (index *SecondaryIndex[V]) remove(elem *V) {
 	keys := index.extractField(elem)
 	for i := range keys {
 		elems, ok := index.inner[keys[i]]
-		if ok {
-			elems.Remove(elem)
+		if !ok {
+			continue
+		}
+		elems, removed := elems.remove(elem)
+		if !removed {
+			continue
 		}
-		if len(index.inner[keys[i]]) == 0 {
+		index.entries--
+		if elems.len() == 0 {
 			delete(index.inner, keys[i])
+		} else {
+			index.inner[keys[i]] = elems
 		}
 	}
 }
+
+func (index *SecondaryIndex[V]) iterate(fn func(key any, elems bucket[V]) bool) {
+	for key, elems := range index.inner {
+		if !fn(key, elems) {
+			return
+		}
+	}
+}
+
+func (index *SecondaryIndex[V]) clear() {
+	index.inner = make(map[any]bucket[V])
+	index.entries = 0
+}
+
+func (index *SecondaryIndex[V]) counts() (keys, entries int) {
+	return len(index.inner), index.entries
+}
@@ -45,13 +45,13 @@ func TestSecondaryIndex(t *testing.T) {
 	}
 
 	for _, person := range persons {
-		result := index.get(person.Name)
+		result := index.get(person.Name).collect()
 
 		assert.Equal(t, 1, len(result))
 		assert.Contains(t,
 			result, person)
 
-		result = index.get(person.City)
+		result = index.get(person.City).collect()
 		assert.Contains(t,
 			result, person)
 	}
@@ -60,14 +60,14 @@ func TestSecondaryIndex(t *testing.T) {
 	ashe2 := &Person{4, "Ashe", 83, "Chengdu", nil}
 	index.insert(ashe2)
 
-	result := index.get(ashe2.Name)
+	result := index.get(ashe2.Name).collect()
 	assert.Equal(t, 2, len(result))
 	assert.Contains(t, result, ashe2)
 	assert.Contains(t, result, persons[0])
 
 	// Remove
 	index.remove(ashe2)
-	result = index.get(persons[0].Name)
+	result = index.get(persons[0].Name).collect()
 	assert.Equal(t, 1, len(result))
 	assert.Contains(t, result, persons[0])
 
@@ -101,11 +101,11 @@ func TestSecondaryContainsIndex(t *testing.T) {
 		index.insert(person)
 	}
 	likes := index.getAllBy("like", "Bob")
-	assert.Equal(t, 2, len(likes), "have to conain Ashe and Cassidy")
+	assert.Equal(t, 2, likes.len(), "have to conain Ashe and Cassidy")
 	likes = index.getAllBy("like", "Cassidy")
-	assert.Equal(t, 2, len(likes), "have to conain Ashe and Harald")
+	assert.Equal(t, 2, likes.len(), "have to conain Ashe and Harald")
 	likes = index.getAllBy("like", "Ashe")
-	assert.Equal(t, 1, len(likes), "Ashe have to like Cassidy")
+	assert.Equal(t, 1, likes.len(), "Ashe have to like Cassidy")
 	likes = index.getAllBy("like", "Harald")
-	assert.Equal(t, 0, len(likes), "Harald have to like no likes")
+	assert.Equal(t, 0, likes.len(), "Harald have to like no likes")
 }
@@ -0,0 +1,348 @@
+package indexmap
+
+import "cmp"
+
+// Interval is the half open range [Start, End).
+type Interval[T any] struct {
+	Start, End T
+}
+
+// IntervalIndex is a secondary index of intervals like bookings, shifts or validity periods.
+// It is an interval tree, an AVL tree ordered by interval start
+// augmented with the maximum end of each subtree, so the queries
+// IndexMap.Overlapping, IndexMap.Containing and IndexMap.ContainedIn
+// cost O(log n + m) for m results.
+// It's also a keyed index by exact Interval, i.e. for GetAllBy and Page.
+type IntervalIndex[V any, T any] struct {
+	extractField func(value *V) []Interval[T]
+	compare      func(t1, t2 T) int
+
+	root *intervalNode[V, T]
+}
+
+type intervalNode[V any, T any] struct {
+	interval    Interval[T]
+	values      Set[*V]
+	left, right *intervalNode[V, T]
+	height      int
+	// the maximum end of the subtree
+	maxEnd T
+}
+
+// intervalQuerier is implemented by IntervalIndex for all interval types,
+// the bounds are passed as any since the IndexMap doesn't know the type.
+type intervalQuerier[V any] interface {
+	Index[V]
+	overlapping(lo, hi any) []*V
+	containing(point any) []*V
+	containedIn(lo, hi any) []*V
+}
+
+// Create an interval index of ordered bounds like numbers,
+// the extractField func returns the intervals of the value.
+// It's OK that the same interval seeks more than one values.
+func NewIntervalIndex[V any, T cmp.Ordered](extractField func(value *V) []Interval[T]) *IntervalIndex[V, T] {
+	return NewIntervalIndexFunc(extractField, cmp.Compare[T])
+}
+
+// Create an interval index of bounds ordered by the compare func,
+// i.e. time.Time.Compare.
+func NewIntervalIndexFunc[V any, T any](extractField func(value *V) []Interval[T], compare func(t1, t2 T) int) *IntervalIndex[V, T] {
+	return &IntervalIndex[V, T]{
+		extractField: extractField,
+		compare:      compare,
+	}
+}
+
+func (index *IntervalIndex[V, T]) insert(elem *V) {
+	for _, interval := range index.extractField(elem) {
+		index.root = index.insertAt(index.root, interval, elem)
+	}
+}
+
+func (index *IntervalIndex[V, T]) remove(elem *V) {
+	for _, interval := range index.extractField(elem) {
+		index.root = index.removeAt(index.root, interval, elem)
+	}
+}
+
+func (index *IntervalIndex[V, T]) clear() {
+	index.root = nil
+}
+
+func (index *IntervalIndex[V, T]) get(key any) bucket[V] {
+	interval, ok := key.(Interval[T])
+	if !ok {
+		return bucket[V]{}
+	}
+	node := index.root
+	for node != nil {
+		switch c := index.compareIntervals(interval, node.interval); {
+		case c < 0:
+			node = node.left
+		case c > 0:
+			node = node.right
+		default:
+			return setBucket(node.values)
+		}
+	}
+	return bucket[V]{}
+}
+
+func (index *IntervalIndex[V, T]) iterate(fn func(key any, elems bucket[V]) bool) {
+	index.root.ascend(func(node *intervalNode[V, T]) bool {
+		return fn(node.interval, setBucket(node.values))
+	})
+}
+
+func (index *IntervalIndex[V, T]) overlapping(lo, hi any) []*V {
+	from, ok1 := lo.(T)
+	to, ok2 := hi.(T)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	values := make(Set[*V])
+	index.overlappingAt(index.root, from, to, values)
+	return values.Collect()
+}
+
+func (index *IntervalIndex[V, T]) containing(point any) []*V {
+	p, ok := point.(T)
+	if !ok {
+		return nil
+	}
+	values := make(Set[*V])
+	index.containingAt(index.root, p, values)
+	return values.Collect()
+}
+
+func (index *IntervalIndex[V, T]) containedIn(lo, hi any) []*V {
+	from, ok1 := lo.(T)
+	to, ok2 := hi.(T)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	values := make(Set[*V])
+	index.containedInAt(index.root, from, to, values)
+	return values.Collect()
+}
+
+// compareIntervals orders by start, then by end.
+func (index *IntervalIndex[V, T]) compareIntervals(i1, i2 Interval[T]) int {
+	if c := index.compare(i1.Start, i2.Start); c != 0 {
+		return c
+	}
+	return index.compare(i1.End, i2.End)
+}
+
+func (index *IntervalIndex[V, T]) insertAt(node *intervalNode[V, T], interval Interval[T], value *V) *intervalNode[V, T] {
+	if node == nil {
+		return &intervalNode[V, T]{interval: interval, values: Set[*V]{value: {}}, height: 1, maxEnd: interval.End}
+	}
+	switch c := index.compareIntervals(interval, node.interval); {
+	case c < 0:
+		node.left = index.insertAt(node.left, interval, value)
+	case c > 0:
+		node.right = index.insertAt(node.right, interval, value)
+	default:
+		node.values.Insert(value)
+		return node
+	}
+	return index.rebalance(node)
+}
+
+func (index *IntervalIndex[V, T]) removeAt(node *intervalNode[V, T], interval Interval[T], value *V) *intervalNode[V, T] {
+	if node == nil {
+		return nil
+	}
+	switch c := index.compareIntervals(interval, node.interval); {
+	case c < 0:
+		node.left = index.removeAt(node.left, interval, value)
+	case c > 0:
+		node.right = index.removeAt(node.right, interval, value)
+	default:
+		node.values.Remove(value)
+		if len(node.values) > 0 {
+			return node
+		}
+		if node.left == nil {
+			return node.right
+		}
+		if node.right == nil {
+			return node.left
+		}
+		var min *intervalNode[V, T]
+		node.right, min = index.removeMin(node.right)
+		min.left, min.right = node.left, node.right
+		return index.rebalance(min)
+	}
+	return index.rebalance(node)
+}
+
+// overlappingAt adds the values of intervals with Start < hi and lo < End.
+func (index *IntervalIndex[V, T]) overlappingAt(node *intervalNode[V, T], lo, hi T, values Set[*V]) {
+	if node == nil || index.compare(node.maxEnd, lo) <= 0 {
+		return
+	}
+	index.overlappingAt(node.left, lo, hi, values)
+	if index.compare(node.interval.Start, hi) >= 0 {
+		// the right subtree starts even later
+		return
+	}
+	if index.compare(lo, node.interval.End) < 0 {
+		addAll(values, node.values)
+	}
+	index.overlappingAt(node.right, lo, hi, values)
+}
+
+// containingAt adds the values of intervals with Start <= p < End.
+func (index *IntervalIndex[V, T]) containingAt(node *intervalNode[V, T], p T, values Set[*V]) {
+	if node == nil || index.compare(node.maxEnd, p) <= 0 {
+		return
+	}
+	index.containingAt(node.left, p, values)
+	if index.compare(node.interval.Start, p) > 0 {
+		return
+	}
+	if index.compare(p, node.interval.End) < 0 {
+		addAll(values, node.values)
+	}
+	index.containingAt(node.right, p, values)
+}
+
+// containedInAt adds the values of intervals with lo <= Start and End <= hi.
+func (index *IntervalIndex[V, T]) containedInAt(node *intervalNode[V, T], lo, hi T, values Set[*V]) {
+	if node == nil {
+		return
+	}
+	startsInside := index.compare(node.interval.Start, lo) >= 0
+	if startsInside {
+		index.containedInAt(node.left, lo, hi, values)
+	}
+	if index.compare(node.interval.Start, hi) > 0 {
+		return
+	}
+	if startsInside && index.compare(node.interval.End, hi) <= 0 {
+		addAll(values, node.values)
+	}
+	index.containedInAt(node.right, lo, hi, values)
+}
+
+// ascend calls fn for every node in interval order,
+// stops if fn returns false.
+func (node *intervalNode[V, T]) ascend(fn func(node *intervalNode[V, T]) bool) bool {
+	if node == nil {
+		return true
+	}
+	return node.left.ascend(fn) && fn(node) && node.right.ascend(fn)
+}
+
+func addAll[V any](values Set[*V], elems Set[*V]) {
+	for elem := range elems {
+		values.Insert(elem)
+	}
+}
+
+func (node *intervalNode[V, T]) depth() int {
+	if node == nil {
+		return 0
+	}
+	return node.height
+}
+
+func (index *IntervalIndex[V, T]) update(node *intervalNode[V, T]) {
+	node.height = 1 + max(node.left.depth(), node.right.depth())
+	node.maxEnd = node.interval.End
+	for _, child := range []*intervalNode[V, T]{node.left, node.right} {
+		if child != nil && index.compare(child.maxEnd, node.maxEnd) > 0 {
+			node.maxEnd = child.maxEnd
+		}
+	}
+}
+
+func (index *IntervalIndex[V, T]) rotateLeft(node *intervalNode[V, T]) *intervalNode[V, T] {
+	right := node.right
+	node.right = right.left
+	right.left = node
+	index.update(node)
+	index.update(right)
+	return right
+}
+
+func (index *IntervalIndex[V, T]) rotateRight(node *intervalNode[V, T]) *intervalNode[V, T] {
+	left := node.left
+	node.left = left.right
+	left.right = node
+	index.update(node)
+	index.update(left)
+	return left
+}
+
+func (index *IntervalIndex[V, T]) rebalance(node *intervalNode[V, T]) *intervalNode[V, T] {
+	index.update(node)
+	switch balance := node.left.depth() - node.right.depth(); {
+	case balance > 1:
+		if node.left.left.depth() < node.left.right.depth() {
+			node.left = index.rotateLeft(node.left)
+		}
+		return index.rotateRight(node)
+	case balance < -1:
+		if node.right.right.depth() < node.right.left.depth() {
+			node.right = index.rotateRight(node.right)
+		}
+		return index.rotateLeft(node)
+	}
+	return node
+}
+
+// removeMin detaches the leftmost node of the subtree.
+func (index *IntervalIndex[V, T]) removeMin(node *intervalNode[V, T]) (*intervalNode[V, T], *intervalNode[V, T]) {
+	if node.left == nil {
+		return node.right, node
+	}
+	var min *intervalNode[V, T]
+	node.left, min = index.removeMin(node.left)
+	return index.rebalance(node), min
+}
+
+// Overlapping returns the values of the named IntervalIndex with an interval
+// overlapping [lo, hi), every value once,
+// nil if the index doesn't exist or lo and hi don't have its interval type.
+func (imap *IndexMap[K, V]) Overlapping(indexName string, lo, hi any) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(intervalQuerier[V])
+	if !ok {
+		return nil
+	}
+	return index.overlapping(lo, hi)
+}
+
+// Containing returns the values of the named IntervalIndex with an interval
+// containing the point, i.e. the records active at a time,
+// nil if the index doesn't exist or point doesn't have its interval type.
+func (imap *IndexMap[K, V]) Containing(indexName string, point any) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(intervalQuerier[V])
+	if !ok {
+		return nil
+	}
+	return index.containing(point)
+}
+
+// ContainedIn returns the values of the named IntervalIndex with an interval
+// lying completely within [lo, hi),
+// nil if the index doesn't exist or lo and hi don't have its interval type.
+func (imap *IndexMap[K, V]) ContainedIn(indexName string, lo, hi any) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(intervalQuerier[V])
+	if !ok {
+		return nil
+	}
+	return index.containedIn(lo, hi)
+}
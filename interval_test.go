@@ -0,0 +1,148 @@
+package indexmap
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const IntervalIndexName = "interval"
+
+type Booking struct {
+	ID         int64
+	Room       string
+	Start, End int
+}
+
+func createBookingMap(n int, myRand *rand.Rand) *IndexMap[int64, Booking] {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Booking) int64 {
+		return value.ID
+	}))
+	imap.AddIndex(IntervalIndexName, NewIntervalIndex(func(value *Booking) []Interval[int] {
+		return []Interval[int]{{value.Start, value.End}}
+	}))
+	for i := 0; i < n; i++ {
+		imap.Insert(randomBooking(int64(i), myRand))
+	}
+	return imap
+}
+
+func randomBooking(id int64, myRand *rand.Rand) *Booking {
+	start := myRand.Intn(1000)
+	return &Booking{
+		ID:    id,
+		Room:  cities[myRand.Intn(len(cities))],
+		Start: start,
+		End:   start + myRand.Intn(50),
+	}
+}
+
+func TestIntervalIndex(t *testing.T) {
+	myRand := rand.New(rand.NewSource(1))
+	imap := createBookingMap(1000, myRand)
+	checkIntervalIndex(t, imap, myRand)
+
+	for i := 0; i < 500; i++ {
+		id := int64(myRand.Intn(1200))
+		switch myRand.Intn(3) {
+		case 0:
+			imap.Remove(id)
+		case 1:
+			imap.Insert(randomBooking(id, myRand))
+		default:
+			imap.Update(id, func(value *Booking) (*Booking, bool) {
+				if value == nil {
+					return nil, false
+				}
+				value.Start -= 10
+				value.End += myRand.Intn(20)
+				return value, true
+			})
+		}
+	}
+	checkIntervalIndex(t, imap, myRand)
+
+	imap.Clear()
+	assert.Empty(t, imap.Overlapping(IntervalIndexName, 0, 2000))
+}
+
+func checkIntervalIndex(t *testing.T, imap *IndexMap[int64, Booking], myRand *rand.Rand) {
+	bookings := imap.CollectValues()
+	for i := 0; i < 100; i++ {
+		lo := myRand.Intn(1100) - 50
+		hi := lo + myRand.Intn(100)
+
+		var overlapping, containing, containedIn []*Booking
+		for _, booking := range bookings {
+			if booking.Start < hi && lo < booking.End {
+				overlapping = append(overlapping, booking)
+			}
+			if booking.Start <= lo && lo < booking.End {
+				containing = append(containing, booking)
+			}
+			if lo <= booking.Start && booking.End <= hi {
+				containedIn = append(containedIn, booking)
+			}
+		}
+		assert.ElementsMatch(t, overlapping, imap.Overlapping(IntervalIndexName, lo, hi), "%v %v", lo, hi)
+		assert.ElementsMatch(t, containing, imap.Containing(IntervalIndexName, lo), "%v", lo)
+		assert.ElementsMatch(t, containedIn, imap.ContainedIn(IntervalIndexName, lo, hi), "%v %v", lo, hi)
+	}
+}
+
+func TestIntervalIndex_Keyed(t *testing.T) {
+	imap := createBookingMap(0, nil)
+	imap.Insert(&Booking{ID: 1, Start: 10, End: 20})
+	imap.Insert(&Booking{ID: 2, Start: 10, End: 20})
+	imap.Insert(&Booking{ID: 3, Start: 5, End: 30})
+	imap.Insert(&Booking{ID: 4, Start: 20, End: 20})
+
+	assert.Len(t, imap.GetAllBy(IntervalIndexName, Interval[int]{10, 20}), 2)
+	assert.Nil(t, imap.GetAllBy(IntervalIndexName, Interval[int]{10, 21}))
+
+	var keys []any
+	imap.RangeBy(IntervalIndexName, func(key any, values []*Booking) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, []any{Interval[int]{5, 30}, Interval[int]{10, 20}, Interval[int]{20, 20}}, keys)
+
+	// [start, end) is half open
+	assert.ElementsMatch(t, []*Booking{imap.Get(3)}, imap.Containing(IntervalIndexName, 20))
+	assert.ElementsMatch(t, []*Booking{imap.Get(1), imap.Get(2), imap.Get(3)}, imap.Containing(IntervalIndexName, 10))
+	assert.Len(t, imap.Overlapping(IntervalIndexName, 20, 25), 1)
+	assert.Len(t, imap.ContainedIn(IntervalIndexName, 10, 20), 3)
+
+	// unknown index and wrong types
+	assert.Nil(t, imap.Overlapping("nothing", 0, 100))
+	assert.Nil(t, imap.Overlapping(IntervalIndexName, int64(0), int64(100)))
+	assert.Nil(t, imap.Containing(IntervalIndexName, "10"))
+	assert.Nil(t, imap.ContainedIn(IntervalIndexName, 0.0, 100.0))
+}
+
+type Shift struct {
+	ID         int64
+	Start, End time.Time
+}
+
+func TestIntervalIndex_Time(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Shift) int64 {
+		return value.ID
+	}))
+	imap.AddIndex(IntervalIndexName, NewIntervalIndexFunc(func(value *Shift) []Interval[time.Time] {
+		return []Interval[time.Time]{{value.Start, value.End}}
+	}, time.Time.Compare))
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		start := day.Add(time.Duration(i*8) * time.Hour)
+		imap.Insert(&Shift{ID: int64(i), Start: start, End: start.Add(8 * time.Hour)})
+	}
+
+	active := imap.Containing(IntervalIndexName, day.Add(9*time.Hour))
+	assert.Equal(t, []*Shift{imap.Get(1)}, active)
+	assert.Len(t, imap.Overlapping(IntervalIndexName, day.Add(7*time.Hour), day.Add(17*time.Hour)), 3)
+	assert.Len(t, imap.ContainedIn(IntervalIndexName, day, day.Add(16*time.Hour)), 2)
+}
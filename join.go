@@ -0,0 +1,83 @@
+package indexmap
+
+import "iter"
+
+// PrimaryKeyName selects the primary key instead of an index for joins.
+const PrimaryKeyName = ""
+
+// InnerJoin streams the pairs of left values and the right values they reference,
+// leftKey extracts the referenced key from a left value, that is looked up in the
+// rightIndex, a keyed index like SecondaryIndex, or PrimaryKeyName for the primary key.
+// A left value is paired with every matching right value,
+// left values without a match are skipped. A nil key never matches.
+// Nothing is yielded if the index doesn't exist.
+//
+// Both maps are read locked while iterating, yield must not modify them,
+// or else it will deadlock.
+func InnerJoin[LK, RK comparable, L, R any](left *IndexMap[LK, L], right *IndexMap[RK, R], leftKey func(value *L) any, rightIndex string) iter.Seq2[*L, *R] {
+	return join(left, right, leftKey, rightIndex, false)
+}
+
+// LeftJoin is InnerJoin, but yields left values without a match
+// paired with nil.
+func LeftJoin[LK, RK comparable, L, R any](left *IndexMap[LK, L], right *IndexMap[RK, R], leftKey func(value *L) any, rightIndex string) iter.Seq2[*L, *R] {
+	return join(left, right, leftKey, rightIndex, true)
+}
+
+func join[LK, RK comparable, L, R any](left *IndexMap[LK, L], right *IndexMap[RK, R], leftKey func(value *L) any, rightIndex string, outer bool) iter.Seq2[*L, *R] {
+	return func(yield func(*L, *R) bool) {
+		unlock := lockMaps(false, left.mapLock(), right.mapLock())
+		defer unlock()
+
+		probe, ok := right.prober(rightIndex)
+		if !ok {
+			return
+		}
+		for _, l := range left.primaryIndex.inner {
+			matched := false
+			for r := range probe(leftKey(l)) {
+				matched = true
+				if !yield(l, r) {
+					return
+				}
+			}
+			if outer && !matched && !yield(l, nil) {
+				return
+			}
+		}
+	}
+}
+
+// prober returns a lookup by the named index or by primary key,
+// false if the index doesn't exist.
+// The caller must hold the lock.
+func (imap *IndexMap[K, V]) prober(indexName string) (func(key any) iter.Seq[*V], bool) {
+	if indexName == PrimaryKeyName {
+		return func(key any) iter.Seq[*V] {
+			return func(yield func(*V) bool) {
+				if k, ok := key.(K); ok {
+					if value := imap.primaryIndex.get(k); value != nil {
+						yield(value)
+					}
+				}
+			}
+		}, true
+	}
+
+	index, ok := imap.indexes[indexName].(keyedIndex[V])
+	if !ok {
+		return nil, false
+	}
+	return func(key any) iter.Seq[*V] {
+		return func(yield func(*V) bool) {
+			if key == nil {
+				return
+			}
+			for value := range index.get(key).all() {
+				if !yield(value) {
+					return
+				}
+			}
+		}
+	}, true
+}
@@ -0,0 +1,162 @@
+package indexmap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Order struct {
+	ID       int64
+	PersonID int64
+	Item     string
+}
+
+const PersonIDIndex = "person_id"
+
+func createOrderMap(persons int, n int) *IndexMap[int64, Order] {
+	orders := NewIndexMap(NewPrimaryIndex(func(value *Order) int64 {
+		return value.ID
+	}))
+	orders.AddIndex(PersonIDIndex, NewSecondaryIndex(func(value *Order) []any {
+		return []any{value.PersonID}
+	}))
+	for i := 0; i < n; i++ {
+		// every third order references a missing person
+		orders.Insert(&Order{ID: int64(i), PersonID: int64(i % (persons + persons/2)), Item: names[i%len(names)]})
+	}
+	return orders
+}
+
+func TestInnerJoin(t *testing.T) {
+	persons := CreateTestMap(100)
+	orders := createOrderMap(100, 1000)
+
+	pairs := 0
+	for order, person := range InnerJoin(orders, persons, func(value *Order) any {
+		return value.PersonID
+	}, PrimaryKeyName) {
+		pairs++
+		assert.Equal(t, order.PersonID, person.ID)
+	}
+	expected := 0
+	orders.Range(func(_ int64, order *Order) bool {
+		if persons.Contains(order.PersonID) {
+			expected++
+		}
+		return true
+	})
+	assert.Equal(t, expected, pairs)
+	assert.Less(t, pairs, orders.Len())
+
+	// the other way round by the index of orders
+	pairs = 0
+	for person, order := range InnerJoin(persons, orders, func(value *Person) any {
+		return value.ID
+	}, PersonIDIndex) {
+		pairs++
+		assert.Equal(t, order.PersonID, person.ID)
+	}
+	assert.Equal(t, expected, pairs)
+
+	// stops early
+	pairs = 0
+	for range InnerJoin(orders, persons, func(value *Order) any { return value.PersonID }, PrimaryKeyName) {
+		pairs++
+		break
+	}
+	assert.Equal(t, 1, pairs)
+
+	// wrong key types, nil keys and unknown indexes don't match
+	for range InnerJoin(orders, persons, func(value *Order) any { return int(value.PersonID) }, PrimaryKeyName) {
+		assert.Fail(t, "int doesn't match int64")
+	}
+	for range InnerJoin(orders, persons, func(value *Order) any { return nil }, NameIndex) {
+		assert.Fail(t, "nil matches nothing")
+	}
+	for range LeftJoin(orders, persons, func(value *Order) any { return value.PersonID }, "nothing") {
+		assert.Fail(t, "unknown index")
+	}
+}
+
+func TestLeftJoin(t *testing.T) {
+	persons := CreateTestMap(100)
+	orders := createOrderMap(100, 1000)
+
+	pairs, unmatched := 0, 0
+	for order, person := range LeftJoin(orders, persons, func(value *Order) any {
+		return value.PersonID
+	}, PrimaryKeyName) {
+		pairs++
+		if person == nil {
+			unmatched++
+			assert.False(t, persons.Contains(order.PersonID))
+		}
+	}
+	assert.Equal(t, orders.Len(), pairs)
+	assert.NotZero(t, unmatched)
+	matched := pairs - unmatched
+
+	// persons without orders, and every order of the others
+	persons.Insert(&Person{ID: 5000, Name: "Nobody"})
+	withoutOrders := 0
+	pairs = 0
+	for person, order := range LeftJoin(persons, orders, func(value *Person) any {
+		return value.ID
+	}, PersonIDIndex) {
+		pairs++
+		if order == nil {
+			withoutOrders++
+			assert.Empty(t, orders.GetAllBy(PersonIDIndex, person.ID))
+		}
+	}
+	assert.Equal(t, matched, pairs-withoutOrders)
+	assert.Equal(t, 1, withoutOrders)
+}
+
+func TestJoin_Self(t *testing.T) {
+	persons := CreateTestMap(0)
+	for id, person := range GenPersons() {
+		person.ID = id
+		persons.Insert(person)
+	}
+
+	likes := map[string][]string{}
+	for person, liked := range InnerJoin(persons, persons, func(value *Person) any {
+		if len(value.Like) == 0 {
+			return nil
+		}
+		return value.Like[0]
+	}, NameIndex) {
+		likes[person.Name] = append(likes[person.Name], liked.Name)
+	}
+	assert.Equal(t, map[string][]string{"Ashe": {"Bob"}, "Cassidy": {"Bob"}, "Harald": {"Cassidy"}}, likes)
+}
+
+func TestJoin_Concurrent(t *testing.T) {
+	persons := CreateTestMap(100)
+	orders := createOrderMap(100, 1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for range InnerJoin(orders, persons, func(value *Order) any { return value.PersonID }, PrimaryKeyName) {
+				}
+				InsertRandomDataFrom(persons, j, 1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for range LeftJoin(persons, orders, func(value *Person) any { return value.ID }, PersonIDIndex) {
+				}
+				orders.Remove(int64(j))
+			}
+		}()
+	}
+	wg.Wait()
+}
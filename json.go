@@ -7,13 +7,19 @@ func (imap *IndexMap[K, V]) MarshalJSON() ([]byte, error) {
 }
 
 func (imap *IndexMap[K, V]) UnmarshalJSON(data []byte) error {
-	if err := json.Unmarshal(data, &imap.primaryIndex.inner); err != nil {
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	values := make(map[K]*V)
+	if err := json.Unmarshal(data, &values); err != nil {
 		return err
 	}
 
-	imap.primaryIndex.iterate(func(_ K, value *V) {
-		imap.Insert(value)
-	})
+	defer imap.writeLock()()
 
-	return nil
+	inserted := make([]*V, 0, len(values))
+	for _, value := range values {
+		inserted = append(inserted, value)
+	}
+	return imap.insert(inserted...)
 }
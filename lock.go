@@ -0,0 +1,259 @@
+package indexmap
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// LockingMode selects how an IndexMap synchronizes concurrent access, see WithLocking.
+type LockingMode int
+
+const (
+	// RWMutexLocking allows concurrent readers or one writer by a sync.RWMutex.
+	// This is the default.
+	RWMutexLocking LockingMode = iota
+	// NoLocking doesn't lock at all, for maps used by one goroutine only like the state of an actor,
+	// it saves the cost of locking on every call. Using the map concurrently is reported
+	// as data race when running with the race detector.
+	// A CompactionPolicy compacts on the next modification instead of in the background.
+	NoLocking
+	// WriterPreferringLocking allows concurrent readers or one writer like RWMutexLocking,
+	// but hands the lock to waiting writers before waiting readers. sync.RWMutex alternates,
+	// after a writer the readers waiting for it go first. So writers see a low latency,
+	// and readers may wait as long as writers keep coming.
+	WriterPreferringLocking
+)
+
+// rwLocker is the lock of an IndexMap.
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+func newLocker(mode LockingMode) rwLocker {
+	switch mode {
+	case NoLocking:
+		return &noLock{}
+	case WriterPreferringLocking:
+		return newWriterPreferringLock()
+	}
+	return &sync.RWMutex{}
+}
+
+// lockerPair locks by a sync.Locker for writers and one for readers, see WithLockers.
+type lockerPair struct {
+	write, read sync.Locker
+}
+
+func (l lockerPair) Lock()    { l.write.Lock() }
+func (l lockerPair) Unlock()  { l.write.Unlock() }
+func (l lockerPair) RLock()   { l.read.Lock() }
+func (l lockerPair) RUnlock() { l.read.Unlock() }
+
+// writerPreferringLock is a readers-writer lock,
+// new readers wait while any writer waits, a writer unlocking hands over to the next writer.
+type writerPreferringLock struct {
+	mu             sync.Mutex
+	readable       *sync.Cond
+	writable       *sync.Cond
+	readers        int
+	waitingWriters int
+	writing        bool
+}
+
+func newWriterPreferringLock() *writerPreferringLock {
+	l := &writerPreferringLock{}
+	l.readable = sync.NewCond(&l.mu)
+	l.writable = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *writerPreferringLock) Lock() {
+	l.mu.Lock()
+	l.waitingWriters++
+	for l.writing || l.readers > 0 {
+		l.writable.Wait()
+	}
+	l.waitingWriters--
+	l.writing = true
+	l.mu.Unlock()
+}
+
+func (l *writerPreferringLock) Unlock() {
+	l.mu.Lock()
+	l.writing = false
+	if l.waitingWriters > 0 {
+		l.writable.Signal()
+	} else {
+		l.readable.Broadcast()
+	}
+	l.mu.Unlock()
+}
+
+func (l *writerPreferringLock) RLock() {
+	l.mu.Lock()
+	for l.writing || l.waitingWriters > 0 {
+		l.readable.Wait()
+	}
+	l.readers++
+	l.mu.Unlock()
+}
+
+func (l *writerPreferringLock) RUnlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 && l.waitingWriters > 0 {
+		l.writable.Signal()
+	}
+	l.mu.Unlock()
+}
+
+// mapIDs numbers the IndexMaps, operations on several maps lock them by ascending id
+// so they can't deadlock each other.
+var mapIDs atomic.Uint64
+
+type mapLock struct {
+	id   uint64
+	lock rwLocker
+}
+
+// lockMaps locks every map once in the order of their ids,
+// read locks unless write. The returned func unlocks them.
+func lockMaps(write bool, locks ...mapLock) (unlock func()) {
+	locks = slices.Clone(locks)
+	slices.SortFunc(locks, func(l1, l2 mapLock) int {
+		switch {
+		case l1.id < l2.id:
+			return -1
+		case l1.id > l2.id:
+			return 1
+		}
+		return 0
+	})
+	locks = slices.CompactFunc(locks, func(l1, l2 mapLock) bool {
+		return l1.id == l2.id
+	})
+
+	for _, l := range locks {
+		if write {
+			l.lock.Lock()
+		} else {
+			l.lock.RLock()
+		}
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			if write {
+				locks[i].lock.Unlock()
+			} else {
+				locks[i].lock.RUnlock()
+			}
+		}
+	}
+}
+
+func (imap *IndexMap[K, V]) mapLock() mapLock {
+	return mapLock{id: imap.id, lock: imap.lock}
+}
+
+// lockGroup are the maps related by foreign keys,
+// they are modified together so all of them are locked for every modification.
+type lockGroup struct {
+	locks []mapLock
+	// the group fields of the maps
+	members []*atomic.Pointer[lockGroup]
+}
+
+// groupMember is implemented by IndexMap for all types.
+type groupMember interface {
+	mapLock() mapLock
+	groupRef() *atomic.Pointer[lockGroup]
+}
+
+func (imap *IndexMap[K, V]) groupRef() *atomic.Pointer[lockGroup] {
+	return &imap.group
+}
+
+// writeLock locks the map for modification together with the maps of its group.
+// The returned func unlocks them.
+func (imap *IndexMap[K, V]) writeLock() (unlock func()) {
+	// only set without locking, so it's never written concurrently
+	if imap.compactDue {
+		imap.compactDue = false
+		imap.Compact()
+	}
+	for {
+		group := imap.group.Load()
+		if group == nil {
+			imap.lock.Lock()
+			if imap.group.Load() == nil {
+				return imap.lock.Unlock
+			}
+			imap.lock.Unlock()
+			continue
+		}
+		unlock := lockMaps(true, group.locks...)
+		// the group may have been merged with another meanwhile
+		if imap.group.Load() == group {
+			return unlock
+		}
+		unlock()
+	}
+}
+
+// lockGroups write locks the maps together with their groups,
+// the groups are returned in the order of the maps, nil for maps without group.
+// The returned func unlocks them.
+func lockGroups(maps ...groupMember) (groups []*lockGroup, locks []mapLock, unlock func()) {
+	for {
+		groups = make([]*lockGroup, len(maps))
+		locks = nil
+		for i, m := range maps {
+			groups[i] = m.groupRef().Load()
+			if groups[i] == nil {
+				locks = append(locks, m.mapLock())
+			} else {
+				locks = append(locks, groups[i].locks...)
+			}
+		}
+		unlock = lockMaps(true, locks...)
+
+		changed := false
+		for i, m := range maps {
+			changed = changed || m.groupRef().Load() != groups[i]
+		}
+		if !changed {
+			return groups, locks, unlock
+		}
+		unlock()
+	}
+}
+
+// joinGroups write locks the groups of the maps and merges them into one group,
+// the returned func unlocks them.
+func joinGroups(maps ...groupMember) (unlock func()) {
+	groups, locks, unlock := lockGroups(maps...)
+
+	merged := &lockGroup{}
+	seen := make(Set[*atomic.Pointer[lockGroup]])
+	for i, m := range maps {
+		members := []*atomic.Pointer[lockGroup]{m.groupRef()}
+		if groups[i] != nil {
+			members = groups[i].members
+		}
+		for _, member := range members {
+			if !seen.Contain(member) {
+				seen.Insert(member)
+				merged.members = append(merged.members, member)
+			}
+		}
+	}
+	merged.locks = locks
+	for _, member := range merged.members {
+		member.Store(merged)
+	}
+	return unlock
+}
@@ -0,0 +1,11 @@
+//go:build !race
+
+package indexmap
+
+// noLock is the lock of maps without locking.
+type noLock struct{}
+
+func (*noLock) Lock()    {}
+func (*noLock) Unlock()  {}
+func (*noLock) RLock()   {}
+func (*noLock) RUnlock() {}
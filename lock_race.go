@@ -0,0 +1,20 @@
+//go:build race
+
+package indexmap
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// noLock is the lock of maps without locking,
+// the race detector reports writers concurrent to other users of the map by the guard,
+// even if they don't access the same entries.
+type noLock struct {
+	guard int
+}
+
+func (l *noLock) Lock()    { runtime.RaceWrite(unsafe.Pointer(&l.guard)) }
+func (l *noLock) Unlock()  { runtime.RaceWrite(unsafe.Pointer(&l.guard)) }
+func (l *noLock) RLock()   { runtime.RaceRead(unsafe.Pointer(&l.guard)) }
+func (l *noLock) RUnlock() { runtime.RaceRead(unsafe.Pointer(&l.guard)) }
@@ -0,0 +1,38 @@
+//go:build race
+
+package indexmap
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIndexMap_NoLockingRace runs the misuse in a subprocess, the race report fails it.
+func TestIndexMap_NoLockingRace(t *testing.T) {
+	if os.Getenv("INDEXMAP_NOLOCKING_RACE") == "1" {
+		imap := createLockingTestMap(10, WithLocking(NoLocking))
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			imap.Insert(&Person{ID: 100})
+		}()
+		go func() {
+			defer wg.Done()
+			// another key than the insert, only the guard of the lock races
+			imap.Get(1)
+		}()
+		wg.Wait()
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestIndexMap_NoLockingRace$")
+	cmd.Env = append(os.Environ(), "INDEXMAP_NOLOCKING_RACE=1")
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "WARNING: DATA RACE")
+}
@@ -0,0 +1,213 @@
+package indexmap
+
+import (
+	"cmp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var lockingOptions = []struct {
+	name string
+	opt  func() Option
+}{
+	{"RWMutex", func() Option { return WithLocking(RWMutexLocking) }},
+	{"NoLocking", func() Option { return WithLocking(NoLocking) }},
+	{"WriterPreferring", func() Option { return WithLocking(WriterPreferringLocking) }},
+	{"Mutex", func() Option {
+		var mu sync.Mutex
+		return WithLockers(&mu, &mu)
+	}},
+	{"RWMutexLockers", func() Option {
+		var rw sync.RWMutex
+		return WithLockers(&rw, rw.RLocker())
+	}},
+}
+
+func createLockingTestMap(n int, opt Option) *IndexMap[int64, Person] {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}), opt, WithIndex(CityIndex, NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.City}
+	})), WithOrdering(func(value1, value2 *Person) int {
+		return cmp.Compare(value1.ID, value2.ID)
+	}))
+	InsertRandomData(imap, n)
+	return imap
+}
+
+func TestIndexMap_Locking(t *testing.T) {
+	for _, locking := range lockingOptions {
+		t.Run(locking.name, func(t *testing.T) {
+			imap := createLockingTestMap(100, locking.opt())
+			assert.Equal(t, 100, imap.Len())
+			imap.Remove(1)
+			assert.Nil(t, imap.Get(1))
+			assert.Equal(t, 99, len(filterPersons(imap, func(value *Person) bool { return true })))
+			readAll(t, imap)
+			if locking.name == "NoLocking" {
+				return
+			}
+
+			var wg sync.WaitGroup
+			for i := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := range 100 {
+						if i%2 == 0 {
+							imap.Insert(&Person{ID: int64(1000 + i*100 + j), City: "Venice"})
+						} else {
+							imap.GetAllBy(CityIndex, "Venice")
+							readAll(t, imap)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, 299, imap.Len())
+		})
+	}
+
+	_, err := TryNewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}), WithLockers(nil, &sync.Mutex{}))
+	assert.ErrorIs(t, err, ErrInvalidOption)
+}
+
+// readAll calls the reading methods, none of them may lock the map twice.
+func readAll(t *testing.T, imap *IndexMap[int64, Person]) {
+	n := imap.Len()
+	assert.GreaterOrEqual(t, len(imap.CollectKeys()), n)
+	assert.GreaterOrEqual(t, len(imap.CollectValues()), n)
+	keys, values := imap.Collect()
+	assert.Equal(t, len(keys), len(values))
+	assert.GreaterOrEqual(t, len(imap.CollectValuesOrdered()), n)
+	cities, _ := imap.CollectBy(CityIndex)
+	assert.NotEmpty(t, cities)
+	count := 0
+	imap.RangeOrdered(func(key int64, value *Person) bool {
+		count++
+		return true
+	})
+	assert.GreaterOrEqual(t, count, n)
+	page, err := imap.Page("", "", 10)
+	assert.NoError(t, err)
+	_, err = imap.Page("", page.Next, 10)
+	assert.NoError(t, err)
+	_, err = imap.Page(CityIndex, "", 10)
+	assert.NoError(t, err)
+}
+
+func TestIndexMap_NoLockingCompaction(t *testing.T) {
+	imap := createLockingTestMap(100, WithLocking(NoLocking))
+	imap.SetCompactionPolicy(CompactionPolicy{Ratio: 1, MinRemoves: 10})
+	for id := range int64(50) {
+		imap.Remove(id)
+	}
+	assert.True(t, imap.compactDue)
+	assert.False(t, imap.compacting.Load())
+
+	// the next modification compacts first
+	imap.Insert(&Person{ID: 1})
+	assert.False(t, imap.compactDue)
+	assert.Zero(t, imap.removes)
+	assert.Equal(t, 51, imap.Len())
+}
+
+// waitFor polls the condition of the lock.
+func waitFor(t *testing.T, l *writerPreferringLock, cond func() bool) {
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return cond()
+	}, time.Second, time.Millisecond)
+}
+
+func TestWriterPreferringLock(t *testing.T) {
+	l := newWriterPreferringLock()
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, s)
+	}
+
+	l.RLock()
+	done := make(chan struct{}, 3)
+	for _, name := range []string{"writer1", "writer2"} {
+		go func() {
+			l.Lock()
+			record(name)
+			l.Unlock()
+			done <- struct{}{}
+		}()
+	}
+	waitFor(t, l, func() bool { return l.waitingWriters == 2 })
+
+	// new readers wait for the waiting writers
+	go func() {
+		l.RLock()
+		record("reader")
+		l.RUnlock()
+		done <- struct{}{}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	assert.Empty(t, order)
+	mu.Unlock()
+
+	l.RUnlock()
+	for range 3 {
+		<-done
+	}
+	assert.ElementsMatch(t, []string{"writer1", "writer2"}, order[:2])
+	assert.Equal(t, "reader", order[2])
+
+	// readers share the lock
+	l.RLock()
+	l.RLock()
+	l.RUnlock()
+	l.RUnlock()
+	l.Lock()
+	l.Unlock()
+}
+
+func BenchmarkLockingGet(b *testing.B) {
+	for _, locking := range lockingOptions {
+		b.Run(locking.name, func(b *testing.B) {
+			imap := createLockingTestMap(1000, locking.opt())
+			b.ResetTimer()
+			for i := range b.N {
+				imap.Get(int64(i % 1000))
+			}
+		})
+	}
+}
+
+// BenchmarkLockingMixed reads concurrently, every tenth operation is an update.
+func BenchmarkLockingMixed(b *testing.B) {
+	for _, locking := range lockingOptions {
+		if locking.name == "NoLocking" {
+			continue
+		}
+		b.Run(locking.name, func(b *testing.B) {
+			imap := createLockingTestMap(1000, locking.opt())
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					i++
+					if i%10 == 0 {
+						imap.Insert(&Person{ID: int64(i % 1000), City: "Venice"})
+					} else {
+						imap.GetAllBy(CityIndex, "Venice")
+					}
+				}
+			})
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package indexmap
 
 import (
+	"fmt"
 	"slices"
 	"sync"
+	"sync/atomic"
 )
 
 // IndexMap is a map supports seeking data with more indexes.
@@ -11,21 +13,66 @@ import (
 // NOTE: DO NOT insert nil value into the IndexMap
 type IndexMap[K comparable, V any] struct {
 	primaryIndex *PrimaryIndex[K, V]
-	indexes      map[string]*SecondaryIndex[V]
-	lock         sync.RWMutex
-	//version      int64
-	sorted []*V
-	cmp    func(p1, p2 *V) int // Closure used in the SortFunc
-	dirty  bool
+	indexes      map[string]Index[V]
+	lock         rwLocker
+	orderings    map[string]*orderedTree[V]
+	seqs         map[*V]uint64 // insertion sequence, nil if there are no orderings
+	seq          uint64
+	// keeps the seqs without orderings, see WithStableOrder
+	stableOrder bool
+
+	keyConflictPolicy KeyConflictPolicy
+	listeners         []listener[K, V]
+	nextListener      uint64
+	// the values of a View are only modified by its source
+	readOnly bool
+	// orders the locks of several maps
+	id uint64
+
+	// the maps related by foreign keys, nil if there are none
+	group atomic.Pointer[lockGroup]
+	// check the foreign keys of the values
+	validators []func(value *V) error
+	// foreign keys referencing this map
+	deleteHooks []deleteHook[K]
+	// the running transaction of a DB, nil if there is none
+	txLog *txLog
+	// the ordinals of the values for BitmapIndexes, nil if there are none
+	ordinals *ordinalTable[V]
+
+	compaction CompactionPolicy
+	// the values removed since the last compaction
+	removes    int
+	compacting atomic.Bool
+	// compact on the next modification, for maps without locking
+	compactDue bool
+
+	// counts the modifications of the indexes, outdating the cached keys of Page
+	version uint64
+	// the sorted keys of the paged indexes by name, readers of the map share them
+	pageMu   sync.Mutex
+	pageKeys map[string]*pageKeys[V]
 }
 
 // Create a IndexMap with a primary index,
 // the primary index must be a one-to-one mapping.
-func NewIndexMap[K comparable, V any](primaryIndex *PrimaryIndex[K, V]) *IndexMap[K, V] {
+// The options add indexes, an ordering and the like before the map is used,
+// it panics for invalid options, see TryNewIndexMap.
+func NewIndexMap[K comparable, V any](primaryIndex *PrimaryIndex[K, V], opts ...Option) *IndexMap[K, V] {
+	imap, err := TryNewIndexMap(primaryIndex, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return imap
+}
+
+func newIndexMap[K comparable, V any](primaryIndex *PrimaryIndex[K, V], lock rwLocker) *IndexMap[K, V] {
 	return &IndexMap[K, V]{
 		primaryIndex: primaryIndex,
-		indexes:      make(map[string]*SecondaryIndex[V]),
-		dirty:        true,
+		lock:         lock,
+		indexes:      make(map[string]Index[V]),
+		orderings:    make(map[string]*orderedTree[V]),
+		id:           mapIDs.Add(1),
 	}
 }
 
@@ -33,32 +80,70 @@ func NewIndexMap[K comparable, V any](primaryIndex *PrimaryIndex[K, V]) *IndexMa
 // function which is use to sort the the result of the calls to
 //   - RangeOrdered
 //   - CollectValuesOrdered
+//   - At
+//   - Rank
 //
-// SortFunc sorts the slice x in ascending order as determined by the cmp function.
-// This sort is not guaranteed to be stable. cmp(a, b) should return a negative
-// number when a < b, a positive number when a > b and zero when a == b.
+// cmp(a, b) should return a negative number when a < b, a positive number
+// when a > b and zero when a == b. Values comparing equal are ordered
+// like in AddOrdering. The order is maintained on every Insert/Update/Remove,
+// setting the compare function sorts the values already inserted once.
+// A nil cmp drops the order.
+// Use AddOrdering to maintain more than one order.
 func (imap *IndexMap[K, V]) SetCmpFn(cmp func(value1, Value2 *V) int) {
-	imap.cmp = cmp
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	if cmp == nil {
+		imap.removeOrdering(defaultOrdering)
+		return
+	}
+	imap.setOrdering(defaultOrdering, cmp)
 }
 
-func (imap *IndexMap[K, V]) setDirty() {
-	imap.dirty = true
+// checkWrite returns ErrReadOnly for read-only maps like the IndexMap of a View.
+func (imap *IndexMap[K, V]) checkWrite() error {
+	if imap.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// mustWrite panics with ErrReadOnly for read-only maps.
+func (imap *IndexMap[K, V]) mustWrite() {
+	if err := imap.checkWrite(); err != nil {
+		panic(err)
+	}
 }
 
 // Add a secondary index,
 // build index for the data inserted,
 // the return value indicates whether succeed to add index,
 // false if the indexName existed.
-func (imap *IndexMap[K, V]) AddIndex(indexName string, index *SecondaryIndex[V]) bool {
+func (imap *IndexMap[K, V]) AddIndex(indexName string, index Index[V]) bool {
 	imap.lock.Lock()
 	defer imap.lock.Unlock()
 
+	return imap.addIndex(indexName, index)
+}
+
+// addIndex is the lock free version of AddIndex
+func (imap *IndexMap[K, V]) addIndex(indexName string, index Index[V]) bool {
 	if _, ok := imap.indexes[indexName]; ok {
 		return false
 	}
 
 	imap.indexes[indexName] = index
 
+	if index, ok := index.(ordinalIndex[V]); ok {
+		if imap.ordinals == nil {
+			imap.ordinals = newOrdinalTable[V]()
+			imap.primaryIndex.iterate(func(_ K, value *V) {
+				imap.ordinals.assign(value)
+			})
+		}
+		index.setOrdinals(imap.ordinals)
+	}
+
 	imap.primaryIndex.iterate(func(_ K, value *V) {
 		index.insert(value)
 	})
@@ -86,21 +171,12 @@ func (imap *IndexMap[K, V]) GetBy(indexName string, key any) *V {
 	imap.lock.RLock()
 	defer imap.lock.RUnlock()
 
-	index, ok := imap.indexes[indexName]
+	index, ok := imap.indexes[indexName].(keyedIndex[V])
 	if !ok {
 		return nil
 	}
 
-	elems := index.get(key)
-	if len(elems) == 0 {
-		return nil
-	}
-
-	for value := range elems {
-		return value
-	}
-
-	return nil
+	return index.get(key).first()
 }
 
 // Return all values the seeked by the key,
@@ -110,11 +186,11 @@ func (imap *IndexMap[K, V]) GetAllBy(indexName string, key any) []*V {
 	defer imap.lock.RUnlock()
 
 	values := imap.getAllBy(indexName, key)
-	if values == nil {
+	if values.len() == 0 {
 		return nil
 	}
 
-	return values.Collect()
+	return values.collect()
 }
 
 // Return true if the value with given key exists,
@@ -137,28 +213,96 @@ func (imap *IndexMap[K, V]) Contains(key K) bool {
 // overwrite if a value with the same primary key existed.
 // NOTE: insert an modified existed value with the same address may confuse the index, use Update() to do this.
 func (imap *IndexMap[K, V]) Insert(values ...*V) {
-	imap.lock.Lock()
-	defer imap.lock.Unlock()
+	imap.mustWrite()
+	_ = imap.TryInsert(values...)
+}
+
+// TryInsert is Insert, but reports values referencing missing values of
+// foreign keys with ErrForeignKey, nothing is inserted then.
+func (imap *IndexMap[K, V]) TryInsert(values ...*V) error {
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	defer imap.writeLock()()
 
-	imap.insert(values...)
+	return imap.insert(values...)
 }
 
-// insert is the lock free version of Inser
-func (imap *IndexMap[K, V]) insert(values ...*V) {
+// insert is the lock free version of TryInsert
+func (imap *IndexMap[K, V]) insert(values ...*V) error {
 	for i := range values {
-		imap.setDirty()
-		oldKey := imap.primaryIndex.extractField(values[i])
-		// don't use Get(oldKey) that rlock on locked map (dead lock)
-		old := imap.primaryIndex.get(oldKey)
-		imap.primaryIndex.insert(values[i])
-		for _, index := range imap.indexes {
-			if old != nil {
-				index.remove(old)
-			}
+		if err := imap.validate(values[i]); err != nil {
+			return err
+		}
+	}
 
-			index.insert(values[i])
+	var changes []Change[K, V]
+	for i := range values {
+		// don't use Get(key) that rlock on locked map (dead lock)
+		old := imap.put(values[i])
+		if len(imap.listeners) == 0 {
+			continue
+		}
+		key := imap.primaryIndex.extractField(values[i])
+		if old != nil {
+			changes = append(changes, Change[K, V]{Kind: Updated, OldKey: key, NewKey: key, Old: old, New: values[i]})
+		} else {
+			changes = append(changes, Change[K, V]{Kind: Inserted, NewKey: key, New: values[i]})
 		}
 	}
+	imap.emit(changes...)
+	return nil
+}
+
+// put stores the value in the primary index, the indexes and the orderings,
+// the replaced value with the same primary key is returned.
+// It doesn't emit change events.
+func (imap *IndexMap[K, V]) put(value *V) *V {
+	old := imap.primaryIndex.get(imap.primaryIndex.extractField(value))
+	if old != nil {
+		imap.logDel(old)
+		imap.unlink(old)
+	}
+	imap.logPut(value)
+	imap.primaryIndex.insert(value)
+	imap.link(value)
+	return old
+}
+
+// del removes the value with the given key from the primary index,
+// the indexes and the orderings, the removed value is returned.
+// It doesn't emit change events.
+func (imap *IndexMap[K, V]) del(key K) *V {
+	old := imap.primaryIndex.get(key)
+	if old == nil {
+		return nil
+	}
+	imap.logDel(old)
+	imap.primaryIndex.remove(key)
+	imap.unlink(old)
+	return old
+}
+
+func (imap *IndexMap[K, V]) link(value *V) {
+	imap.version++
+	if imap.ordinals != nil {
+		imap.ordinals.assign(value)
+	}
+	for _, index := range imap.indexes {
+		index.insert(value)
+	}
+	imap.order(value)
+}
+
+func (imap *IndexMap[K, V]) unlink(value *V) {
+	imap.version++
+	for _, index := range imap.indexes {
+		index.remove(value)
+	}
+	imap.unorder(value)
+	if imap.ordinals != nil {
+		imap.ordinals.release(value)
+	}
 }
 
 // An UpdateFn modifies the given value,
@@ -167,126 +311,477 @@ func (imap *IndexMap[K, V]) insert(values ...*V) {
 // false otherwise.
 type UpdateFn[V any] func(value *V) (*V, bool)
 
+// KeyConflictPolicy decides what happens if an update changes the
+// primary key of a value to the key of another value.
+type KeyConflictPolicy int
+
+const (
+	// RejectKeyConflict keeps the other value, the update is rolled back
+	// and fails with ErrKeyConflict. This is the default.
+	RejectKeyConflict KeyConflictPolicy = iota
+	// OverwriteKeyConflict removes the other value.
+	OverwriteKeyConflict
+)
+
+// SetKeyConflictPolicy sets the policy for updates changing the primary key of a value
+// to the key of another value, that applies to Update, UpdateBy, Compute,
+// Upsert and GetOrInsert.
+func (imap *IndexMap[K, V]) SetKeyConflictPolicy(policy KeyConflictPolicy) {
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	imap.keyConflictPolicy = policy
+}
+
 // Update the value for the given key,
 // it removes the old one if exists, and inserts updateFn(old) if modified and not nil.
+// updateFn may change the primary key, that is reported as one Updated change
+// with the old and the new key. If the new key belongs to another value
+// the KeyConflictPolicy applies, a rejected update keeps and returns the old value,
+// use TryUpdate to get the error.
 func (imap *IndexMap[K, V]) Update(key K, updateFn UpdateFn[V]) *V {
-	imap.lock.Lock()
-	defer imap.lock.Unlock()
+	imap.mustWrite()
+	value, _ := imap.TryUpdate(key, updateFn)
+	return value
+}
 
+// TryUpdate is Update, but reports a rejected change of the primary key
+// with ErrKeyConflict, and violated foreign keys with ErrForeignKey.
+func (imap *IndexMap[K, V]) TryUpdate(key K, updateFn UpdateFn[V]) (*V, error) {
+	if err := imap.checkWrite(); err != nil {
+		return nil, err
+	}
+	defer imap.writeLock()()
+
+	return imap.update(key, func(old *V) *V {
+		value, _ := updateFn(old)
+		return value
+	})
+}
+
+// update is the lock free version of TryUpdate.
+func (imap *IndexMap[K, V]) update(key K, fn func(old *V) *V) (*V, error) {
 	// don't use Get(key) that rlock on locked map (dead lock)
-	old := imap.primaryIndex.get(key)
+	old := imap.del(key)
+	var snapshot V
 	if old != nil {
-		d := imap.dirty
-		imap.remove(key)
-		imap.dirty = d
+		snapshot = *old
+	}
+
+	rollback := func(err error) (*V, error) {
+		if old != nil {
+			*old = snapshot
+			imap.put(old)
+		}
+		return old, err
+	}
+
+	value := fn(old)
+	if value == nil {
+		if old != nil {
+			if err := imap.checkDelete([]K{key}, nil); err != nil {
+				return rollback(err)
+			}
+			imap.emit(Change[K, V]{Kind: Removed, OldKey: key, Old: old})
+			imap.removed(1)
+			imap.afterDelete([]K{key})
+		}
+		return nil, nil
+	}
+	if err := imap.validate(value); err != nil {
+		return rollback(err)
+	}
+
+	// all checks pass before the value of the new key is overwritten
+	newKey := imap.primaryIndex.extractField(value)
+	other := imap.primaryIndex.get(newKey)
+	if other != nil && imap.keyConflictPolicy == RejectKeyConflict {
+		return rollback(keyConflictError(key, newKey))
+	}
+	if old != nil && newKey != key {
+		if err := imap.checkRename([]K{key}); err != nil {
+			return rollback(err)
+		}
+	}
+
+	var changes []Change[K, V]
+	if other != nil {
+		imap.del(newKey)
+		changes = append(changes, Change[K, V]{Kind: Removed, OldKey: newKey, Old: other})
+	}
+
+	imap.put(value)
+	if old == nil {
+		changes = append(changes, Change[K, V]{Kind: Inserted, NewKey: newKey, New: value})
+	} else {
+		changes = append(changes, Change[K, V]{Kind: Updated, OldKey: key, NewKey: newKey, Old: old, New: value})
+	}
+	imap.emit(changes...)
+	imap.removed(countRemoved(changes))
+	return value, nil
+}
+
+// countRemoved returns the number of removed values of the changes.
+func countRemoved[K comparable, V any](changes []Change[K, V]) int {
+	n := 0
+	for _, change := range changes {
+		if change.Kind == Removed {
+			n++
+		}
+	}
+	return n
+}
+
+func keyConflictError(oldKey, newKey any) error {
+	return fmt.Errorf("%w: %v -> %v", ErrKeyConflict, oldKey, newKey)
+}
+
+// InsertIfAbsent inserts the value if there is no value with the same primary key,
+// the return value indicates whether it was inserted.
+// A value referencing a missing value of a foreign key isn't inserted either,
+// the error is dropped.
+func (imap *IndexMap[K, V]) InsertIfAbsent(value *V) bool {
+	imap.mustWrite()
+	defer imap.writeLock()()
+
+	if imap.primaryIndex.get(imap.primaryIndex.extractField(value)) != nil {
+		return false
+	}
+	return imap.insert(value) == nil
+}
+
+// GetOrInsert returns the value for the given key if it exists,
+// otherwise it inserts and returns the value created by factory,
+// the factory must create a value with the given key.
+// The loaded result is true if the value existed.
+// Nothing is inserted and nil is returned if factory returns nil,
+// a value with another key, or a value referencing a missing value of a foreign key,
+// the error is dropped.
+func (imap *IndexMap[K, V]) GetOrInsert(key K, factory func() *V) (value *V, loaded bool) {
+	imap.mustWrite()
+	defer imap.writeLock()()
+
+	if old := imap.primaryIndex.get(key); old != nil {
+		return old, true
+	}
+	value = factory()
+	if value == nil || imap.primaryIndex.extractField(value) != key {
+		return nil, false
+	}
+	value, _ = imap.update(key, func(*V) *V {
+		return value
+	})
+	return value, false
+}
+
+// Upsert inserts the value, if a value with the same primary key exists
+// it is replaced by merge(old, value) instead.
+// The merge func may modify and return old, returning nil removes the value.
+// A nil merge replaces the old value like Insert.
+// The stored value is returned. If merge changes the primary key, the KeyConflictPolicy
+// applies, a rejected value keeps and returns the old one, use TryUpsert to get the error.
+func (imap *IndexMap[K, V]) Upsert(value *V, merge func(old, new *V) *V) *V {
+	imap.mustWrite()
+	stored, _ := imap.TryUpsert(value, merge)
+	return stored
+}
+
+// TryUpsert is Upsert, but reports a rejected change of the primary key
+// with ErrKeyConflict, and violated foreign keys with ErrForeignKey.
+func (imap *IndexMap[K, V]) TryUpsert(value *V, merge func(old, new *V) *V) (*V, error) {
+	if err := imap.checkWrite(); err != nil {
+		return nil, err
 	}
-	updated := false
-	newV, localUpdated := updateFn(old)
-	updated = updated || localUpdated
-	if newV != nil {
-		d := imap.dirty
-		imap.insert(newV)
-		imap.dirty = d
+	defer imap.writeLock()()
+
+	key := imap.primaryIndex.extractField(value)
+	if merge == nil || imap.primaryIndex.get(key) == nil {
+		if err := imap.insert(value); err != nil {
+			return imap.primaryIndex.get(key), err
+		}
+		return value, nil
 	}
-	if updated {
-		imap.setDirty()
+
+	return imap.update(key, func(old *V) *V {
+		return merge(old, value)
+	})
+}
+
+// Compute replaces the value for the given key by fn(key, old),
+// old is nil if the key doesn't exist.
+// fn may create a new value, modify and return old,
+// or return nil to remove the value.
+// The stored value is returned, nil if there is none. If fn changes the primary key,
+// the KeyConflictPolicy applies, a rejected value keeps and returns the old one,
+// use TryCompute to get the error.
+func (imap *IndexMap[K, V]) Compute(key K, fn func(key K, old *V) *V) *V {
+	imap.mustWrite()
+	value, _ := imap.TryCompute(key, fn)
+	return value
+}
+
+// TryCompute is Compute, but reports a rejected change of the primary key
+// with ErrKeyConflict, and violated foreign keys with ErrForeignKey.
+func (imap *IndexMap[K, V]) TryCompute(key K, fn func(key K, old *V) *V) (*V, error) {
+	if err := imap.checkWrite(); err != nil {
+		return nil, err
 	}
-	return newV
+	defer imap.writeLock()()
+
+	return imap.update(key, func(old *V) *V {
+		return fn(key, old)
+	})
 }
 
 // Update the values for the given index and key.
 // it removes the old ones if exist, and inserts updateFn(old) for every old ones if not nil.
-// NOTE: the modified values have to be with unique primary key
+// If updateFn changes primary keys to keys of other values,
+// or of values updated by the same call, the KeyConflictPolicy applies.
+// Rejecting rolls back the whole call, use TryUpdateBy to get the error.
 func (imap *IndexMap[K, V]) UpdateBy(indexName string, key any, updateFn UpdateFn[V]) {
-	imap.lock.Lock()
-	defer imap.lock.Unlock()
+	imap.mustWrite()
+	_ = imap.TryUpdateBy(indexName, key, updateFn)
+}
 
-	updated := false
+// TryUpdateBy is UpdateBy, but reports a rejected change of a primary key
+// with ErrKeyConflict, and violated foreign keys with ErrForeignKey.
+func (imap *IndexMap[K, V]) TryUpdateBy(indexName string, key any, updateFn UpdateFn[V]) error {
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	defer imap.writeLock()()
+
+	return imap.updateBy(indexName, key, updateFn)
+}
+
+// updateBy is the lock free version of TryUpdateBy
+func (imap *IndexMap[K, V]) updateBy(indexName string, key any, updateFn UpdateFn[V]) error {
 	oldValueSet := imap.getAllBy(indexName, key)
-	if len(oldValueSet) == 0 {
-		return
+	if oldValueSet.len() == 0 {
+		return nil
 	}
 
-	oldValues := oldValueSet.Collect()
+	type pending struct {
+		key      K
+		old      *V
+		snapshot V
+	}
+	olds := make([]pending, 0, oldValueSet.len())
+	for _, old := range oldValueSet.collect() {
+		olds = append(olds, pending{key: imap.primaryIndex.extractField(old), old: old, snapshot: *old})
+	}
+	for i := range olds {
+		imap.del(olds[i].key)
+	}
 
-	imap.removeValues(oldValues...)
+	// the changes are emitted after all values are updated successfully
+	changes := make([]Change[K, V], 0, len(olds))
+	stored := make([]*V, 0, len(olds))
+	// the values of other keys removed by the KeyConflictPolicy
+	var overwritten []*V
+	rollback := func(err error) error {
+		for _, value := range stored {
+			imap.del(imap.primaryIndex.extractField(value))
+		}
+		for _, value := range overwritten {
+			imap.put(value)
+		}
+		for i := range olds {
+			*olds[i].old = olds[i].snapshot
+			imap.put(olds[i].old)
+		}
+		return err
+	}
+	// the keys of the values updated to nil, and the keys given up by changing the primary key
+	var removedKeys, renamedKeys []K
+	for _, p := range olds {
+		value, _ := updateFn(p.old)
+		if value == nil {
+			removedKeys = append(removedKeys, p.key)
+			changes = append(changes, Change[K, V]{Kind: Removed, OldKey: p.key, Old: p.old})
+			continue
+		}
+		if err := imap.validate(value); err != nil {
+			return rollback(err)
+		}
 
-	for _, old := range oldValues {
-		newV, localUpdated := updateFn(old)
-		updated = updated || localUpdated
-		if newV != nil {
-			imap.insert(newV)
+		newKey := imap.primaryIndex.extractField(value)
+		if other := imap.primaryIndex.get(newKey); other != nil {
+			if imap.keyConflictPolicy == RejectKeyConflict {
+				return rollback(keyConflictError(p.key, newKey))
+			}
+			imap.del(newKey)
+			changes = append(changes, Change[K, V]{Kind: Removed, OldKey: newKey, Old: other})
+			// values stored by this call are removed by the rollback anyway
+			if !slices.Contains(stored, other) {
+				overwritten = append(overwritten, other)
+			}
 		}
+		if newKey != p.key {
+			renamedKeys = append(renamedKeys, p.key)
+		}
+
+		imap.put(value)
+		stored = append(stored, value)
+		changes = append(changes, Change[K, V]{Kind: Updated, OldKey: p.key, NewKey: newKey, Old: p.old, New: value})
+	}
+
+	// keys given up by one value may be taken by another one
+	taken := func(key K) bool {
+		return imap.primaryIndex.get(key) != nil
+	}
+	removedKeys = slices.DeleteFunc(removedKeys, taken)
+	renamedKeys = slices.DeleteFunc(renamedKeys, taken)
+	if err := imap.checkRename(renamedKeys); err != nil {
+		return rollback(err)
 	}
-	if updated {
-		imap.setDirty()
+	if err := imap.checkDelete(removedKeys, nil); err != nil {
+		return rollback(err)
 	}
+
+	imap.emit(changes...)
+	imap.removed(countRemoved(changes))
+	imap.afterDelete(removedKeys)
+	return nil
 }
 
 // Remove values into the map,
 // also updates the indexes added.
 func (imap *IndexMap[K, V]) Remove(keys ...K) {
-	imap.lock.Lock()
-	defer imap.lock.Unlock()
+	imap.mustWrite()
+	_ = imap.TryRemove(keys...)
+}
+
+// TryRemove is Remove, but reports removing values referenced by a foreign key
+// with the Restrict policy with ErrForeignKey, nothing is removed then.
+func (imap *IndexMap[K, V]) TryRemove(keys ...K) error {
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	defer imap.writeLock()()
 
-	imap.remove(keys...)
+	return imap.remove(keys...)
 }
 
-// remove is the lock free  version Remove
-func (imap *IndexMap[K, V]) remove(keys ...K) {
+// remove is the lock free  version TryRemove
+func (imap *IndexMap[K, V]) remove(keys ...K) error {
+	if len(imap.deleteHooks) > 0 {
+		keys = slices.DeleteFunc(slices.Clone(keys), func(key K) bool {
+			return imap.primaryIndex.get(key) == nil
+		})
+		if err := imap.checkDelete(keys, nil); err != nil {
+			return err
+		}
+	}
 
+	var changes []Change[K, V]
+	removed := 0
 	for i := range keys {
-		elem := imap.primaryIndex.get(keys[i])
-		if elem == nil {
+		old := imap.del(keys[i])
+		if old == nil {
 			continue
 		}
-
-		imap.primaryIndex.remove(keys[i])
-
-		for _, index := range imap.indexes {
-			index.remove(elem)
+		removed++
+		if len(imap.listeners) > 0 {
+			changes = append(changes, Change[K, V]{Kind: Removed, OldKey: keys[i], Old: old})
 		}
 	}
-	imap.setDirty()
+	imap.emit(changes...)
+	imap.removed(removed)
+	imap.afterDelete(keys)
+	return nil
 }
 
 // Remove values into the map,
 // also updates the indexes added.
 func (imap *IndexMap[K, V]) RemoveBy(indexName string, keys ...any) {
-	imap.lock.Lock()
-	defer imap.lock.Unlock()
+	imap.mustWrite()
+	_ = imap.TryRemoveBy(indexName, keys...)
+}
+
+// TryRemoveBy is RemoveBy, but reports removing values referenced by a foreign key
+// with the Restrict policy with ErrForeignKey, nothing is removed then.
+func (imap *IndexMap[K, V]) TryRemoveBy(indexName string, keys ...any) error {
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	defer imap.writeLock()()
 
-	imap.removeBy(indexName, keys...)
+	return imap.removeBy(indexName, keys...)
 }
 
-// removBy is the lock free verison of RemoveBy
-func (imap *IndexMap[K, V]) removeBy(indexName string, keys ...any) {
+// removBy is the lock free verison of TryRemoveBy
+func (imap *IndexMap[K, V]) removeBy(indexName string, keys ...any) error {
+	values := make(Set[*V])
 	for i := range keys {
-		values := imap.getAllBy(indexName, keys[i])
-		if values == nil {
-			continue
-		}
-
-		imap.removeValueSet(values)
+		imap.getAllBy(indexName, keys[i]).addTo(values)
 	}
-	imap.setDirty()
+	return imap.removeValueSet(values)
 }
 
 // Remove all values.
 func (imap *IndexMap[K, V]) Clear() {
-	imap.lock.Lock()
-	defer imap.lock.Unlock()
+	imap.mustWrite()
+	_ = imap.TryClear()
+}
 
-	for k := range imap.primaryIndex.inner {
-		delete(imap.primaryIndex.inner, k)
+// TryClear is Clear, but reports removing values referenced by a foreign key
+// with the Restrict policy with ErrForeignKey, nothing is removed then.
+func (imap *IndexMap[K, V]) TryClear() error {
+	if err := imap.checkWrite(); err != nil {
+		return err
 	}
+	defer imap.writeLock()()
+
+	return imap.clear()
+}
 
-	for i := range imap.indexes {
-		for k := range imap.indexes[i].inner {
-			delete(imap.indexes[i].inner, k)
+// clear is the lock free version of TryClear
+func (imap *IndexMap[K, V]) clear() error {
+	var keys []K
+	if len(imap.deleteHooks) > 0 {
+		keys = make([]K, 0, len(imap.primaryIndex.inner))
+		for key := range imap.primaryIndex.inner {
+			keys = append(keys, key)
+		}
+		if err := imap.checkDelete(keys, nil); err != nil {
+			return err
+		}
+	}
+
+	var removed []Change[K, V]
+	if len(imap.listeners) > 0 {
+		removed = make([]Change[K, V], 0, len(imap.primaryIndex.inner))
+	}
+	for k, v := range imap.primaryIndex.inner {
+		if removed != nil {
+			removed = append(removed, Change[K, V]{Kind: Removed, OldKey: k, Old: v})
 		}
+		imap.logDel(v)
 	}
-	imap.setDirty()
+	// a new map releases the memory, deleting the keys doesn't shrink it
+	imap.primaryIndex.inner = make(map[K]*V)
+	imap.removes = 0
+
+	imap.version++
+	imap.pageKeys = nil
+	for _, index := range imap.indexes {
+		index.clear()
+	}
+
+	for name, tree := range imap.orderings {
+		imap.orderings[name] = newOrderedTree(tree.cmp)
+	}
+	if imap.seqs != nil {
+		imap.seqs = make(map[*V]uint64)
+	}
+	if imap.ordinals != nil {
+		imap.ordinals.clear()
+	}
+
+	imap.emit(removed...)
+	imap.afterDelete(keys)
+	return nil
 }
 
 // Range iterates over all the elements,
@@ -305,21 +800,6 @@ func (imap *IndexMap[K, V]) Range(fn func(key K, value *V) bool) {
 	}
 }
 
-func (imap *IndexMap[K, V]) checkSortedForUpdate() {
-	if imap.dirty {
-		// reuse he underlying array, slice the slice to zero length
-		// due to performance
-		imap.sorted = imap.sorted[:0]
-		for _, v := range imap.primaryIndex.inner {
-			imap.sorted = append(imap.sorted, v)
-		}
-		if imap.cmp != nil {
-			slices.SortFunc(imap.sorted, imap.cmp)
-		}
-		imap.dirty = false
-	}
-}
-
 // Range iterates over all the elements,
 // stops iteration if fn returns false,
 // guarantee to the order if OrderedFn was set before.
@@ -328,14 +808,30 @@ func (imap *IndexMap[K, V]) checkSortedForUpdate() {
 func (imap *IndexMap[K, V]) RangeOrdered(fn func(key K, value *V) bool) {
 	imap.lock.RLock()
 	defer imap.lock.RUnlock()
-	imap.checkSortedForUpdate()
-	for _, v := range imap.sorted {
-		if !fn(imap.PrimaryKey(v), v) {
+
+	if imap.rangeOrderedLocked(defaultOrdering, fn) {
+		return
+	}
+	for k, v := range imap.primaryIndex.inner {
+		if !fn(k, v) {
 			return
 		}
 	}
 }
 
+// At returns the value at position i of the order set by SetCmpFn,
+// nil if i is out of range or no compare function is set.
+func (imap *IndexMap[K, V]) At(i int) *V {
+	return imap.AtBy(defaultOrdering, i)
+}
+
+// Rank returns the position of the value in the order set by SetCmpFn,
+// -1 if the value isn't in the map or no compare function is set.
+// The value must be the one stored in the map, not a copy of it.
+func (imap *IndexMap[K, V]) Rank(value *V) int {
+	return imap.RankBy(defaultOrdering, value)
+}
+
 // RangeBy iterates over the map by a given index
 // fn must not attempt modifying the IndexMap, or else it will deadlock
 func (imap *IndexMap[K, V]) RangeBy(indexName string, fn func(key any, values []*V) bool) {
@@ -344,16 +840,14 @@ func (imap *IndexMap[K, V]) RangeBy(indexName string, fn func(key any, values []
 	imap.rangeByLocked(indexName, fn)
 }
 func (imap *IndexMap[K, V]) rangeByLocked(indexName string, fn func(key any, values []*V) bool) {
-	index, ok := imap.indexes[indexName]
+	index, ok := imap.indexes[indexName].(keyedIndex[V])
 	if !ok {
 		return
 	}
 
-	for k, vs := range index.inner {
-		if !fn(k, vs.Collect()) {
-			return
-		}
-	}
+	index.iterate(func(k any, vs bucket[V]) bool {
+		return fn(k, vs.collect())
+	})
 
 }
 
@@ -363,7 +857,7 @@ func (imap *IndexMap[K, V]) CollectKeys() []K {
 	defer imap.lock.RUnlock()
 
 	var (
-		keys = make([]K, 0, imap.Len())
+		keys = make([]K, 0, len(imap.primaryIndex.inner))
 	)
 	for k := range imap.primaryIndex.inner {
 		keys = append(keys, k)
@@ -378,7 +872,7 @@ func (imap *IndexMap[K, V]) CollectValues() []*V {
 	defer imap.lock.RUnlock()
 
 	var (
-		values = make([]*V, 0, imap.Len())
+		values = make([]*V, 0, len(imap.primaryIndex.inner))
 	)
 	for _, v := range imap.primaryIndex.inner {
 
@@ -391,11 +885,15 @@ func (imap *IndexMap[K, V]) CollectValues() []*V {
 func (imap *IndexMap[K, V]) CollectValuesOrdered() []*V {
 	imap.lock.RLock()
 	defer imap.lock.RUnlock()
-	imap.checkSortedForUpdate()
-	var (
-		values = make([]*V, 0, imap.Len())
-	)
-	values = append(values, imap.sorted...)
+
+	if tree, ok := imap.orderings[defaultOrdering]; ok {
+		return tree.collect()
+	}
+
+	values := make([]*V, 0, len(imap.primaryIndex.inner))
+	for _, v := range imap.primaryIndex.inner {
+		values = append(values, v)
+	}
 	return values
 }
 
@@ -405,8 +903,8 @@ func (imap *IndexMap[K, V]) Collect() ([]K, []*V) {
 	defer imap.lock.RUnlock()
 
 	var (
-		keys   = make([]K, 0, imap.Len())
-		values = make([]*V, 0, imap.Len())
+		keys   = make([]K, 0, len(imap.primaryIndex.inner))
+		values = make([]*V, 0, len(imap.primaryIndex.inner))
 	)
 	for k, v := range imap.primaryIndex.inner {
 		keys = append(keys, k)
@@ -442,24 +940,19 @@ func (imap *IndexMap[K, V]) Len() int {
 }
 
 // getAllBy ist the lock free version if GetAllBy(...)
-func (imap *IndexMap[K, V]) getAllBy(indexName string, key any) Set[*V] {
-	index, ok := imap.indexes[indexName]
+func (imap *IndexMap[K, V]) getAllBy(indexName string, key any) bucket[V] {
+	index, ok := imap.indexes[indexName].(keyedIndex[V])
 	if !ok {
-		return nil
+		return bucket[V]{}
 	}
 	return index.get(key)
 }
 
 // All values must exists
-func (imap *IndexMap[K, V]) removeValues(values ...*V) {
-	for i := range values {
-		imap.remove(imap.primaryIndex.extractField(values[i]))
-	}
-}
-
-// All values must exists
-func (imap *IndexMap[K, V]) removeValueSet(values Set[*V]) {
+func (imap *IndexMap[K, V]) removeValueSet(values Set[*V]) error {
+	keys := make([]K, 0, len(values))
 	for value := range values {
-		imap.remove(imap.primaryIndex.extractField(value))
+		keys = append(keys, imap.primaryIndex.extractField(value))
 	}
+	return imap.remove(keys...)
 }
@@ -43,7 +43,7 @@ func TestIndexMap(t *testing.T) {
 		assert.Equal(t, 1, len(result))
 		assert.Contains(t, result, person)
 
-		assert.Nil(t, imap.getAllBy(InvalidIndex, person.Name))
+		assert.Zero(t, imap.getAllBy(InvalidIndex, person.Name).len())
 	}
 
 	// Add index after inserting data
@@ -124,7 +124,7 @@ func TestIndexMap(t *testing.T) {
 	count = 0
 	imap.RangeBy(CityIndex, func(key any, vals []*Person) bool {
 		count++
-		exp := imap.indexes[CityIndex].inner[key].Collect()
+		exp := imap.indexes[CityIndex].(*SecondaryIndex[Person]).inner[key].collect()
 		sort.SliceStable(exp, func(i, j int) bool {
 			return exp[i].ID < exp[j].ID
 		})
@@ -134,7 +134,7 @@ func TestIndexMap(t *testing.T) {
 		assert.Equal(t, exp, vals)
 		return true
 	})
-	assert.Equal(t, len(imap.indexes[CityIndex].inner), count)
+	assert.Equal(t, len(imap.indexes[CityIndex].(*SecondaryIndex[Person]).inner), count)
 }
 
 func TestAddExistedIndex(t *testing.T) {
@@ -161,23 +161,88 @@ func TestIndexMap_PrimaryKey(t *testing.T) {
 	assert.Equal(t, p.ID, imap.PrimaryKey(p))
 }
 
-func TestIndexMap_Upate_dirty(t *testing.T) {
+func TestIndexMap_Update_order(t *testing.T) {
 	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
 		return value.ID
 	}))
 	InsertData(imap, GenPersons())
-	// get it once sortet to be not dirty
-	imap.CollectValuesOrdered()
-	assert.False(t, imap.dirty)
+	imap.SetCmpFn(func(value1, Value2 *Person) int {
+		return cmp.Compare(value1.Age, Value2.Age)
+	})
+	assert.Equal(t, int64(1), imap.At(0).ID)
 	imap.Update(1, func(value *Person) (*Person, bool) {
 		return value, false
 	})
-	assert.False(t, imap.dirty)
-	imap.Update(2, func(value *Person) (*Person, bool) {
-		value.City = "Rome"
+	assert.Equal(t, int64(1), imap.At(0).ID)
+	imap.Update(1, func(value *Person) (*Person, bool) {
+		value.Age = 99
 		return value, true
 	})
-	assert.True(t, imap.dirty)
+	assert.Equal(t, int64(0), imap.At(0).ID)
+	assert.Equal(t, int64(1), imap.At(3).ID)
+	assert.Equal(t, 3, imap.Rank(imap.Get(1)))
+}
+
+func TestIndexMap_AtRank(t *testing.T) {
+	imap := CreateTestMap(500)
+	assert.Nil(t, imap.At(0))
+	assert.Equal(t, -1, imap.Rank(imap.Get(0)))
+
+	imap.SetCmpFn(func(value1, Value2 *Person) int {
+		return cmp.Compare(value1.Age, Value2.Age)
+	})
+	values := imap.CollectValuesOrdered()
+	assert.Equal(t, 500, len(values))
+	for i, v := range values {
+		assert.Equal(t, v, imap.At(i))
+		assert.Equal(t, i, imap.Rank(v))
+	}
+	assert.Nil(t, imap.At(-1))
+	assert.Nil(t, imap.At(500))
+	assert.Equal(t, -1, imap.Rank(&Person{ID: 1}))
+
+	imap.Remove(values[0].ID, values[250].ID)
+	assert.Equal(t, values[1], imap.At(0))
+	assert.Equal(t, values[251], imap.At(249))
+	assert.Equal(t, -1, imap.Rank(values[0]))
+
+	imap.Clear()
+	assert.Nil(t, imap.At(0))
+	imap.Insert(values[7])
+	assert.Equal(t, values[7], imap.At(0))
+
+	imap.SetCmpFn(nil)
+	assert.Nil(t, imap.At(0))
+}
+
+func TestIndexMap_RangeOrderedConcurrent(t *testing.T) {
+	imap := CreateTestMap(200)
+	imap.SetCmpFn(func(value1, Value2 *Person) int {
+		return cmp.Compare(value1.Age, Value2.Age)
+	})
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			myRand := rand.New(rand.NewSource(int64(w)))
+			for i := range 200 {
+				if w%2 == 0 {
+					imap.Insert(createRandomPerson(int64(200+w*200+i), myRand))
+					continue
+				}
+				lastValue := -1
+				imap.RangeOrdered(func(key int64, value *Person) bool {
+					assert.LessOrEqual(t, lastValue, value.Age)
+					lastValue = value.Age
+					return true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, imap.Len(), len(imap.CollectValuesOrdered()))
 }
 
 func BenchmarkInsertOnlyPrimaryInt(b *testing.B) {
@@ -362,7 +427,6 @@ func BenchmarkRange(b *testing.B) {
 		imap.Range(func(key int64, value *Person) bool {
 			return true
 		})
-		imap.dirty = true
 	}
 }
 
@@ -372,15 +436,18 @@ func benRangeSorted(b *testing.B, cnt int, modified bool) {
 	imap.SetCmpFn(func(value1, Value2 *Person) int {
 		return cmp.Compare(value1.Age, Value2.Age)
 	})
-	// presort it for the test
-	imap.checkSortedForUpdate()
 	// nothing before should be in the benchmark evaluation
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		imap.RangeOrdered(func(key int64, value *Person) bool {
 			return true
 		})
-		imap.dirty = modified
+		if modified {
+			imap.Update(int64(i%cnt), func(value *Person) (*Person, bool) {
+				value.Age = i % 103
+				return value, true
+			})
+		}
 	}
 }
 
@@ -530,3 +597,230 @@ func TestUpdatePerson(t *testing.T) {
 
 	//	fmt.Println(dd.Dump(likeGroup))
 }
+
+func TestIndexMap_InsertIfAbsent(t *testing.T) {
+	imap := CreateTestMap(10)
+	assert.False(t, imap.InsertIfAbsent(&Person{ID: 1, Name: "Tracer"}))
+	assert.NotEqual(t, "Tracer", imap.Get(1).Name)
+	assert.Empty(t, imap.GetAllBy(NameIndex, "Tracer"))
+
+	assert.True(t, imap.InsertIfAbsent(&Person{ID: 10, Name: "Tracer"}))
+	assert.Equal(t, int64(10), imap.GetBy(NameIndex, "Tracer").ID)
+}
+
+func TestIndexMap_GetOrInsert(t *testing.T) {
+	imap := CreateTestMap(10)
+	existing := imap.Get(3)
+	value, loaded := imap.GetOrInsert(3, func() *Person {
+		assert.Fail(t, "factory must not be called for existing keys")
+		return nil
+	})
+	assert.True(t, loaded)
+	assert.Equal(t, existing, value)
+
+	value, loaded = imap.GetOrInsert(42, func() *Person {
+		return &Person{ID: 42, Name: "Tracer", City: "London"}
+	})
+	assert.False(t, loaded)
+	assert.Equal(t, value, imap.Get(42))
+	assert.Contains(t, imap.GetAllBy(CityIndex, "London"), value)
+
+	value, loaded = imap.GetOrInsert(43, func() *Person { return nil })
+	assert.False(t, loaded)
+	assert.Nil(t, value)
+	assert.False(t, imap.Contains(43))
+
+	// a value with another key is neither stored under it nor under the key
+	for _, id := range []int64{44, 5} {
+		other := imap.Get(id)
+		value, loaded = imap.GetOrInsert(43, func() *Person { return &Person{ID: id} })
+		assert.False(t, loaded)
+		assert.Nil(t, value)
+		assert.False(t, imap.Contains(43))
+		assert.Equal(t, other, imap.Get(id))
+	}
+
+	// concurrent GetOrInsert creates the value only once
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			imap.GetOrInsert(100, func() *Person {
+				created.Add(1)
+				return &Person{ID: 100}
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), created.Load())
+}
+
+func TestIndexMap_Upsert(t *testing.T) {
+	imap := CreateTestMap(10)
+	sumAges := func(old, new *Person) *Person {
+		old.Age += new.Age
+		old.City = new.City
+		return old
+	}
+
+	value := imap.Upsert(&Person{ID: 20, Age: 5, City: "London"}, sumAges)
+	assert.Equal(t, 5, value.Age)
+	assert.Equal(t, value, imap.Get(20))
+
+	value = imap.Upsert(&Person{ID: 20, Age: 7, City: "Paris"}, sumAges)
+	assert.Equal(t, 12, value.Age)
+	assert.Empty(t, imap.GetAllBy(CityIndex, "London"))
+	assert.Equal(t, []*Person{value}, imap.GetAllBy(CityIndex, "Paris"))
+
+	imap.Upsert(&Person{ID: 20, City: "Rome"}, nil)
+	assert.Equal(t, "Rome", imap.Get(20).City)
+
+	assert.Nil(t, imap.Upsert(&Person{ID: 20}, func(old, new *Person) *Person { return nil }))
+	assert.False(t, imap.Contains(20))
+	assert.Empty(t, imap.GetAllBy(CityIndex, "Rome"))
+
+	// merging into the key of another value is rejected
+	one := imap.Get(1)
+	value, err := imap.TryUpsert(&Person{ID: 1}, func(old, new *Person) *Person {
+		old.ID = 2
+		return old
+	})
+	assert.ErrorIs(t, err, ErrKeyConflict)
+	assert.Equal(t, one, value)
+	assert.Equal(t, int64(1), value.ID)
+	assert.Equal(t, value, imap.Upsert(&Person{ID: 1}, func(old, new *Person) *Person {
+		old.ID = 2
+		return old
+	}))
+	assert.Equal(t, one, imap.Get(1))
+}
+
+func TestIndexMap_Compute(t *testing.T) {
+	imap := CreateTestMap(10)
+	count := func(key int64, old *Person) *Person {
+		if old == nil {
+			return &Person{ID: key, Age: 1, City: "Counter"}
+		}
+		old.Age++
+		return old
+	}
+	for range 3 {
+		imap.Compute(30, count)
+	}
+	assert.Equal(t, 3, imap.Get(30).Age)
+	assert.Equal(t, 1, len(imap.GetAllBy(CityIndex, "Counter")))
+
+	old := imap.Get(5)
+	assert.Nil(t, imap.Compute(5, func(key int64, value *Person) *Person {
+		assert.Equal(t, old, value)
+		return nil
+	}))
+	assert.False(t, imap.Contains(5))
+	assert.NotContains(t, imap.GetAllBy(NameIndex, old.Name), old)
+	assert.Equal(t, 10, imap.Len())
+
+	// computing the key of another value is rejected
+	value, err := imap.TryCompute(30, func(key int64, old *Person) *Person {
+		return &Person{ID: 1}
+	})
+	assert.ErrorIs(t, err, ErrKeyConflict)
+	assert.Equal(t, 3, value.Age)
+	assert.Equal(t, value, imap.Get(30))
+	assert.Equal(t, int64(1), imap.Get(1).ID)
+}
+
+func TestIndexMap_UpdateKeyConflict(t *testing.T) {
+	imap := CreateTestMap(10)
+	changes, _ := recordChanges(imap)
+	one, two := imap.Get(1), imap.Get(2)
+	oneName := one.Name
+
+	// renaming to a free key is fine
+	value, err := imap.TryUpdate(1, func(value *Person) (*Person, bool) {
+		value.ID = 11
+		return value, true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, one, value)
+	assert.Nil(t, imap.Get(1))
+	assert.Equal(t, one, imap.Get(11))
+	assert.Equal(t, Change[int64, Person]{Kind: Updated, OldKey: 1, NewKey: 11, Old: one, New: one}, (*changes)[0])
+
+	// renaming to the key of another value is rejected and rolled back
+	value, err = imap.TryUpdate(11, func(value *Person) (*Person, bool) {
+		value.ID = 2
+		value.Name = "Tracer"
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrKeyConflict)
+	assert.Equal(t, one, value)
+	assert.Equal(t, int64(11), one.ID)
+	assert.Equal(t, oneName, one.Name)
+	assert.Equal(t, one, imap.Get(11))
+	assert.Equal(t, two, imap.Get(2))
+	assert.Contains(t, imap.GetAllBy(NameIndex, oneName), one)
+	assert.Empty(t, imap.GetAllBy(NameIndex, "Tracer"))
+	assert.Equal(t, 1, len(*changes))
+
+	// Update keeps the old value as well
+	assert.Equal(t, one, imap.Update(11, func(value *Person) (*Person, bool) {
+		return &Person{ID: 2, Name: "Tracer"}, true
+	}))
+	assert.Equal(t, two, imap.Get(2))
+	assert.Equal(t, 10, imap.Len())
+
+	// unless the policy allows to overwrite
+	imap.SetKeyConflictPolicy(OverwriteKeyConflict)
+	value, err = imap.TryUpdate(11, func(value *Person) (*Person, bool) {
+		value.ID = 2
+		return value, true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, one, imap.Get(2))
+	assert.Equal(t, 9, imap.Len())
+	assert.NotContains(t, imap.GetAllBy(NameIndex, two.Name), two)
+	assert.Equal(t, Change[int64, Person]{Kind: Removed, OldKey: 2, Old: two}, (*changes)[1])
+	assert.Equal(t, Change[int64, Person]{Kind: Updated, OldKey: 11, NewKey: 2, Old: one, New: one}, (*changes)[2])
+}
+
+func TestIndexMap_UpdateByKeyConflict(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}))
+	imap.AddIndex(CityIndex, NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.City}
+	}))
+	persons := GenPersons()
+	InsertData(imap, persons)
+	changes, _ := recordChanges(imap)
+
+	// both values of San Francisco get the same key, everything is rolled back
+	err := imap.TryUpdateBy(CityIndex, "San Francisco", func(value *Person) (*Person, bool) {
+		value.ID = 10
+		value.City = "Paris"
+		return value, true
+	})
+	assert.ErrorIs(t, err, ErrKeyConflict)
+	assert.Empty(t, *changes)
+	assert.Empty(t, imap.GetAllBy(CityIndex, "Paris"))
+	assert.Equal(t, 2, len(imap.GetAllBy(CityIndex, "San Francisco")))
+	for id, person := range persons {
+		assert.Equal(t, person, imap.Get(id))
+		assert.Equal(t, id, person.ID)
+	}
+
+	// swapping the keys within the updated values is fine
+	err = imap.TryUpdateBy(CityIndex, "San Francisco", func(value *Person) (*Person, bool) {
+		value.ID = 1 - value.ID
+		return value, true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, persons[0], imap.Get(1))
+	assert.Equal(t, persons[1], imap.Get(0))
+	assert.Equal(t, 2, len(*changes))
+	for _, change := range *changes {
+		assert.True(t, change.KeyChanged())
+	}
+}
@@ -0,0 +1,188 @@
+package indexmap
+
+import "unsafe"
+
+// MemoryStats describes the approximate memory an IndexMap uses,
+// without the values themselves. The sizes are estimated by the number of entries
+// of the maps, maps that held more entries before still use the memory for those.
+type MemoryStats struct {
+	// Values is the number of values.
+	Values int
+	// Primary is the size of the primary index in bytes,
+	// including the ordinals of the values if there are BitmapIndexes.
+	Primary int
+	// Orderings is the size of the orderings in bytes.
+	Orderings int
+	// Indexes are the statistics of the indexes by name.
+	Indexes map[string]IndexMemoryStats
+	// Bytes is the size of all in bytes.
+	Bytes int
+}
+
+// IndexMemoryStats describes the approximate memory an index uses.
+type IndexMemoryStats struct {
+	// Keys is the number of distinct index keys.
+	Keys int
+	// Entries is the sum of the values of all keys.
+	Entries int
+	// Bytes is the size of the index in bytes.
+	Bytes int
+}
+
+// memoryIndex is an Index estimating its memory.
+type memoryIndex interface {
+	memoryStats() IndexMemoryStats
+}
+
+// MemoryStats returns the approximate memory used by the map and every index.
+func (imap *IndexMap[K, V]) MemoryStats() MemoryStats {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	var key K
+	stats := MemoryStats{
+		Values:  len(imap.primaryIndex.inner),
+		Primary: mapBytes(len(imap.primaryIndex.inner), int(unsafe.Sizeof(key))+pointerSize),
+		Indexes: make(map[string]IndexMemoryStats, len(imap.indexes)),
+	}
+	if imap.ordinals != nil {
+		stats.Primary += imap.ordinals.memoryBytes()
+	}
+	if imap.seqs != nil {
+		stats.Orderings = mapBytes(len(imap.seqs), pointerSize+8)
+		for range imap.orderings {
+			stats.Orderings += len(imap.seqs) * int(unsafe.Sizeof(treeNode[V]{}))
+		}
+	}
+
+	stats.Bytes = stats.Primary + stats.Orderings
+	for name, index := range imap.indexes {
+		var indexStats IndexMemoryStats
+		switch index := index.(type) {
+		case memoryIndex:
+			indexStats = index.memoryStats()
+		case keyedIndex[V]:
+			indexStats = keyedMemoryStats(index)
+		}
+		stats.Indexes[name] = indexStats
+		stats.Bytes += indexStats.Bytes
+	}
+	return stats
+}
+
+const (
+	pointerSize = int(unsafe.Sizeof(uintptr(0)))
+	// the size of an interface like the keys of SecondaryIndex
+	anySize = 2 * pointerSize
+	// the size of the header of a map
+	mapHeaderSize = 48
+)
+
+// mapBytes estimates the size of a map with n entries of the size of a key and value,
+// the slots of the map are 7/8 full at most, with a control byte per slot.
+func mapBytes(n, slotSize int) int {
+	if n == 0 {
+		return mapHeaderSize
+	}
+	slots := 8
+	for slots*7/8 < n {
+		slots *= 2
+	}
+	return mapHeaderSize + slots*(slotSize+1)
+}
+
+// keyedMemoryStats estimates the memory of indexes of a Set by key.
+func keyedMemoryStats[V any](index keyedIndex[V]) IndexMemoryStats {
+	stats := IndexMemoryStats{}
+	index.iterate(func(_ any, elems bucket[V]) bool {
+		stats.Keys++
+		stats.Entries += elems.len()
+		stats.Bytes += elems.memoryBytes()
+		return true
+	})
+	stats.Bytes += mapBytes(stats.Keys, anySize+pointerSize)
+	return stats
+}
+
+// memoryBytes is the memory of the bucket besides the bucket itself.
+func (b bucket[V]) memoryBytes() int {
+	switch {
+	case b.many != nil:
+		return mapBytes(len(b.many), pointerSize)
+	case b.few != nil:
+		return cap(b.few) * pointerSize
+	}
+	return 0
+}
+
+func (index *SecondaryIndex[V]) memoryStats() IndexMemoryStats {
+	stats := IndexMemoryStats{Keys: len(index.inner), Entries: index.entries}
+	stats.Bytes = mapBytes(len(index.inner), anySize+int(unsafe.Sizeof(bucket[V]{})))
+	for _, elems := range index.inner {
+		stats.Bytes += elems.memoryBytes()
+	}
+	return stats
+}
+
+func (index *PartialIndex[V]) memoryStats() IndexMemoryStats {
+	stats := index.inner.memoryStats()
+	stats.Bytes += mapBytes(len(index.covered), pointerSize)
+	return stats
+}
+
+func (index *BitmapIndex[V]) memoryStats() IndexMemoryStats {
+	stats := IndexMemoryStats{Keys: len(index.inner), Entries: index.entries}
+	stats.Bytes = mapBytes(len(index.inner), anySize+pointerSize)
+	for _, b := range index.inner {
+		stats.Bytes += b.memoryBytes()
+	}
+	return stats
+}
+
+func (table *ordinalTable[V]) memoryBytes() int {
+	return mapBytes(len(table.ordinals), pointerSize+4) + cap(table.values)*pointerSize +
+		cap(table.free)*4 + table.live.memoryBytes()
+}
+
+func (b *bitmap) memoryBytes() int {
+	bytes := int(unsafe.Sizeof(*b)) + cap(b.keys)*2 + cap(b.containers)*pointerSize
+	for _, c := range b.containers {
+		bytes += int(unsafe.Sizeof(*c)) + cap(c.array)*2 + cap(c.bitset)*8
+	}
+	return bytes
+}
+
+func (index *TextIndex[V]) memoryStats() IndexMemoryStats {
+	stats := IndexMemoryStats{Keys: len(index.postings)}
+	stats.Bytes = mapBytes(len(index.postings), 2*pointerSize+pointerSize)
+	for term, postings := range index.postings {
+		stats.Entries += len(postings)
+		stats.Bytes += len(term) + mapBytes(len(postings), pointerSize+3*pointerSize)
+		for _, positions := range postings {
+			stats.Bytes += cap(positions) * 8
+		}
+	}
+	stats.Bytes += mapBytes(len(index.docs), pointerSize+int(unsafe.Sizeof(textDoc{})))
+	for _, doc := range index.docs {
+		stats.Bytes += (cap(doc.terms) + cap(doc.words)) * 2 * pointerSize
+	}
+	stats.Bytes += mapBytes(len(index.words), 2*pointerSize+8)
+	for word := range index.words {
+		stats.Bytes += len(word)
+	}
+	return stats
+}
+
+func (index *GeoIndex[V]) memoryStats() IndexMemoryStats {
+	stats := IndexMemoryStats{Keys: len(index.cells)}
+	stats.Bytes = mapBytes(len(index.cells), int(unsafe.Sizeof(geoCell{}))+pointerSize)
+	for _, values := range index.cells {
+		stats.Entries += len(values)
+		stats.Bytes += mapBytes(len(values), pointerSize)
+	}
+	stats.Bytes += mapBytes(len(index.shapes), pointerSize+3*pointerSize) + mapBytes(len(index.large), pointerSize)
+	for _, shapes := range index.shapes {
+		stats.Bytes += cap(shapes) * int(unsafe.Sizeof(Rect{}))
+	}
+	return stats
+}
@@ -0,0 +1,124 @@
+package indexmap
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const IDIndex = "id"
+
+func TestIndexMap_MemoryStats(t *testing.T) {
+	imap := CreateTestMap(1000)
+	imap.AddIndex(IDIndex, NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.ID}
+	}))
+
+	stats := imap.MemoryStats()
+	assert.Equal(t, 1000, stats.Values)
+	assert.Positive(t, stats.Primary)
+	assert.Zero(t, stats.Orderings)
+	assert.Equal(t, IndexMemoryStats{Keys: 1000, Entries: 1000, Bytes: stats.Indexes[IDIndex].Bytes}, stats.Indexes[IDIndex])
+	assert.Equal(t, 1000, stats.Indexes[CityIndex].Entries)
+	total := stats.Primary
+	for _, indexStats := range stats.Indexes {
+		total += indexStats.Bytes
+	}
+	assert.Equal(t, total, stats.Bytes)
+	// the single values of the unique keys are inline instead of a Set per key
+	assert.Less(t, stats.Indexes[IDIndex].Bytes, mapBytes(1000, anySize+pointerSize)+1000*mapBytes(1, pointerSize))
+
+	imap.AddOrdering(AgeOrdering, Ascending(func(value *Person) int {
+		return value.Age
+	}))
+	imap.AddIndex(AgeGroupIndex, NewBitmapIndex(func(value *Person) []any {
+		return []any{value.Age / 10}
+	}))
+	withOrdering := imap.MemoryStats()
+	assert.Positive(t, withOrdering.Orderings)
+	assert.Greater(t, withOrdering.Primary, stats.Primary)
+	assert.Equal(t, 1000, withOrdering.Indexes[AgeGroupIndex].Entries)
+
+	imap.Remove(1)
+	assert.Equal(t, 999, imap.MemoryStats().Indexes[IDIndex].Entries)
+
+	imap.Clear()
+	cleared := imap.MemoryStats()
+	assert.Zero(t, cleared.Values)
+	assert.Zero(t, cleared.Indexes[IDIndex].Keys)
+}
+
+func TestMapBytes(t *testing.T) {
+	assert.Equal(t, mapHeaderSize, mapBytes(0, 8))
+	assert.Equal(t, mapHeaderSize+8*9, mapBytes(7, 8))
+	assert.Equal(t, mapHeaderSize+16*9, mapBytes(8, 8))
+}
+
+// heapBytes returns the bytes allocated by build and still in use.
+func heapBytes(build func() any) (uint64, any) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	result := build()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	return after.HeapAlloc - before.HeapAlloc, result
+}
+
+const memoryBenchmarkValues = 100_000
+
+func benchmarkIndexMemory(b *testing.B, keys int, build func(persons []*Person) any) {
+	persons := make([]*Person, memoryBenchmarkValues)
+	for i := range persons {
+		persons[i] = &Person{ID: int64(i), Age: i % keys}
+	}
+	b.ResetTimer()
+	var bytes uint64
+	for range b.N {
+		var index any
+		bytes, index = heapBytes(func() any { return build(persons) })
+		runtime.KeepAlive(index)
+	}
+	b.ReportMetric(float64(bytes)/memoryBenchmarkValues, "B/value")
+}
+
+func buildSecondaryIndex(persons []*Person) any {
+	index := NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Age}
+	})
+	for _, person := range persons {
+		index.insert(person)
+	}
+	return index
+}
+
+// buildSetIndex builds the index with a Set per key, like SecondaryIndex did before its buckets.
+func buildSetIndex(persons []*Person) any {
+	index := make(map[any]Set[*Person])
+	for _, person := range persons {
+		set, ok := index[person.Age]
+		if !ok {
+			set = make(Set[*Person])
+			index[person.Age] = set
+		}
+		set.Insert(person)
+	}
+	return index
+}
+
+func BenchmarkIndexMemoryUnique(b *testing.B) {
+	benchmarkIndexMemory(b, memoryBenchmarkValues, buildSecondaryIndex)
+}
+
+func BenchmarkIndexMemoryUniqueSets(b *testing.B) {
+	benchmarkIndexMemory(b, memoryBenchmarkValues, buildSetIndex)
+}
+
+func BenchmarkIndexMemoryFew(b *testing.B) {
+	benchmarkIndexMemory(b, memoryBenchmarkValues/4, buildSecondaryIndex)
+}
+
+func BenchmarkIndexMemoryFewSets(b *testing.B) {
+	benchmarkIndexMemory(b, memoryBenchmarkValues/4, buildSetIndex)
+}
@@ -0,0 +1,231 @@
+package indexmap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Option configures an IndexMap created by NewIndexMap or TryNewIndexMap.
+// The options are checked against the types of the map when it is created,
+// so a fully configured map can be a package-level value.
+type Option func(config *mapConfig)
+
+type mapConfig struct {
+	indexes []namedIndex
+	// a func(value1, value2 *V) int, nil without ordering
+	ordering any
+	capacity int
+	stable   bool
+	// the lock by WithLocking or WithLockers
+	lock rwLocker
+	// funcs func(change Change[K, V])
+	hooks []any
+	err   error
+}
+
+type namedIndex struct {
+	name  string
+	index any
+}
+
+// fail records the first invalid option.
+func (config *mapConfig) fail(format string, args ...any) {
+	if config.err == nil {
+		config.err = fmt.Errorf("%w: "+format, append([]any{ErrInvalidOption}, args...)...)
+	}
+}
+
+// WithIndex adds the index like AddIndex.
+func WithIndex[V any](name string, index Index[V]) Option {
+	return func(config *mapConfig) {
+		if index == nil {
+			config.fail("index %s is nil", name)
+			return
+		}
+		config.indexes = append(config.indexes, namedIndex{name: name, index: index})
+	}
+}
+
+// WithOrdering sets the compare function of the default order like SetCmpFn.
+func WithOrdering[V any](cmp func(value1, value2 *V) int) Option {
+	return func(config *mapConfig) {
+		if cmp == nil {
+			config.fail("ordering is nil")
+			return
+		}
+		config.ordering = cmp
+	}
+}
+
+// WithCapacity pre-sizes the primary index and the indexes for n values,
+// that saves growing the maps while inserting them.
+func WithCapacity(n int) Option {
+	return func(config *mapConfig) {
+		if n < 0 {
+			config.fail("negative capacity %d", n)
+			return
+		}
+		config.capacity = n
+	}
+}
+
+// WithStableOrder keeps the order the values are inserted or last updated in
+// even while the map has no ordering, so the values comparing equal by an ordering
+// are always in that order, including the values inserted before the ordering was added.
+// It costs a map entry per value.
+func WithStableOrder() Option {
+	return func(config *mapConfig) {
+		config.stable = true
+	}
+}
+
+// WithLocking sets how the map synchronizes concurrent access,
+// the default is RWMutexLocking.
+func WithLocking(mode LockingMode) Option {
+	return func(config *mapConfig) {
+		if mode < RWMutexLocking || mode > WriterPreferringLocking {
+			config.fail("unknown locking mode %d", mode)
+			return
+		}
+		config.lock = newLocker(mode)
+	}
+}
+
+// WithLockers locks the map by write for modifications and by read for reading,
+// like a sync.RWMutex and its RLocker, or a sync.Mutex for both for strict mutual exclusion.
+// Operations on maps related by foreign keys lock them one after another,
+// so the lockers must not be shared by such maps.
+func WithLockers(write, read sync.Locker) Option {
+	return func(config *mapConfig) {
+		if write == nil || read == nil {
+			config.fail("locker is nil")
+			return
+		}
+		config.lock = lockerPair{write: write, read: read}
+	}
+}
+
+// WithHooks registers the funcs to be called for every change of the map like OnChange.
+func WithHooks[K comparable, V any](fns ...func(change Change[K, V])) Option {
+	return func(config *mapConfig) {
+		for _, fn := range fns {
+			if fn == nil {
+				config.fail("hook is nil")
+				return
+			}
+			config.hooks = append(config.hooks, fn)
+		}
+	}
+}
+
+// TryNewIndexMap is NewIndexMap, but reports invalid options with ErrInvalidOption
+// and duplicate index names with ErrDuplicateName instead of panicking.
+func TryNewIndexMap[K comparable, V any](primaryIndex *PrimaryIndex[K, V], opts ...Option) (*IndexMap[K, V], error) {
+	config := mapConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.err != nil {
+		return nil, config.err
+	}
+
+	// all options are checked before the map is configured
+	indexes := make(map[string]Index[V], len(config.indexes))
+	for _, named := range config.indexes {
+		index, ok := named.index.(Index[V])
+		if !ok {
+			return nil, fmt.Errorf("%w: index %s is a %T", ErrInvalidOption, named.name, named.index)
+		}
+		if _, ok := indexes[named.name]; ok {
+			return nil, fmt.Errorf("%w: index %s", ErrDuplicateName, named.name)
+		}
+		indexes[named.name] = index
+	}
+	var cmp func(value1, value2 *V) int
+	if config.ordering != nil {
+		var ok bool
+		if cmp, ok = config.ordering.(func(value1, value2 *V) int); !ok {
+			return nil, fmt.Errorf("%w: ordering is a %T", ErrInvalidOption, config.ordering)
+		}
+	}
+	hooks := make([]func(change Change[K, V]), len(config.hooks))
+	for i, hook := range config.hooks {
+		var ok bool
+		if hooks[i], ok = hook.(func(change Change[K, V])); !ok {
+			return nil, fmt.Errorf("%w: hook is a %T", ErrInvalidOption, hook)
+		}
+	}
+
+	if config.lock == nil {
+		config.lock = newLocker(RWMutexLocking)
+	}
+	imap := newIndexMap(primaryIndex, config.lock)
+	if config.stable {
+		imap.stableOrder = true
+		imap.seqs = make(map[*V]uint64, max(config.capacity, len(primaryIndex.inner)))
+		imap.primaryIndex.iterate(func(_ K, value *V) {
+			imap.seq++
+			imap.seqs[value] = imap.seq
+		})
+	}
+	if config.capacity > 0 && len(primaryIndex.inner) == 0 {
+		primaryIndex.inner = make(map[K]*V, config.capacity)
+	}
+	for _, named := range config.indexes {
+		index := indexes[named.name]
+		if index, ok := index.(growIndex); ok && config.capacity > 0 {
+			index.grow(config.capacity)
+		}
+		imap.addIndex(named.name, index)
+	}
+	if imap.ordinals != nil && config.capacity > 0 {
+		imap.ordinals.grow(config.capacity)
+	}
+	if cmp != nil {
+		imap.setOrdering(defaultOrdering, cmp)
+		if config.capacity > 0 && len(imap.seqs) == 0 {
+			imap.seqs = make(map[*V]uint64, config.capacity)
+		}
+	}
+	for _, hook := range hooks {
+		imap.OnChange(hook)
+	}
+	return imap, nil
+}
+
+// growIndex is an Index pre-sizing its maps for a capacity.
+type growIndex interface {
+	grow(n int)
+}
+
+func (index *SecondaryIndex[V]) grow(n int) {
+	if len(index.inner) == 0 {
+		index.inner = make(map[any]bucket[V], n)
+	}
+}
+
+func (index *PartialIndex[V]) grow(n int) {
+	if len(index.covered) == 0 {
+		index.covered = make(Set[*V], n)
+	}
+	index.inner.grow(n)
+}
+
+func (index *TextIndex[V]) grow(n int) {
+	if len(index.docs) == 0 {
+		index.docs = make(map[*V]textDoc, n)
+	}
+}
+
+func (index *GeoIndex[V]) grow(n int) {
+	if len(index.shapes) == 0 {
+		index.shapes = make(map[*V][]Rect, n)
+	}
+}
+
+func (table *ordinalTable[V]) grow(n int) {
+	if len(table.values) == 0 {
+		table.ordinals = make(map[*V]uint32, n)
+		table.values = make([]*V, 0, n)
+	}
+}
@@ -0,0 +1,155 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var configuredPersons = NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+	return value.ID
+}),
+	WithIndex(NameIndex, NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Name}
+	})),
+	WithIndex(AgeGroupIndex, NewBitmapIndex(func(value *Person) []any {
+		return []any{value.Age / 10}
+	})),
+	WithOrdering(func(value1, value2 *Person) int {
+		return value1.Age - value2.Age
+	}),
+	WithCapacity(100),
+	WithLocking(RWMutexLocking),
+)
+
+func TestNewIndexMap_Options(t *testing.T) {
+	var changes []Change[int64, Person]
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}),
+		WithIndex(CityIndex, NewSecondaryIndex(func(value *Person) []any {
+			return []any{value.City}
+		})),
+		WithOrdering(func(value1, value2 *Person) int {
+			return value1.Age - value2.Age
+		}),
+		WithCapacity(10),
+		WithHooks(func(change Change[int64, Person]) {
+			changes = append(changes, change)
+		}),
+	)
+	imap.Insert(&Person{ID: 1, Age: 30, City: "Venice"}, &Person{ID: 2, Age: 20, City: "Venice"})
+
+	assert.Len(t, imap.GetAllBy(CityIndex, "Venice"), 2)
+	ordered := imap.CollectValuesOrdered()
+	assert.Equal(t, []int64{2, 1}, []int64{ordered[0].ID, ordered[1].ID})
+	assert.Len(t, changes, 2)
+
+	configuredPersons.Insert(&Person{ID: 1, Name: "Ann", Age: 42})
+	defer configuredPersons.Clear()
+	assert.Len(t, configuredPersons.GetAllBy(NameIndex, "Ann"), 1)
+	count, err := configuredPersons.CountBitmap(BitmapKeys(AgeGroupIndex, 4))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTryNewIndexMap(t *testing.T) {
+	primary := func() *PrimaryIndex[int64, Person] {
+		return NewPrimaryIndex(func(value *Person) int64 {
+			return value.ID
+		})
+	}
+	names := NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Name}
+	})
+
+	tests := []struct {
+		name string
+		opts []Option
+		err  error
+	}{
+		{"negative capacity", []Option{WithCapacity(-1)}, ErrInvalidOption},
+		{"nil index", []Option{WithIndex[Person](NameIndex, nil)}, ErrInvalidOption},
+		{"index type", []Option{WithIndex(NameIndex, NewSecondaryIndex(func(value *Order) []any { return nil }))}, ErrInvalidOption},
+		{"duplicate index", []Option{WithIndex(NameIndex, names), WithIndex(NameIndex, names)}, ErrDuplicateName},
+		{"nil ordering", []Option{WithOrdering[Person](nil)}, ErrInvalidOption},
+		{"ordering type", []Option{WithOrdering(func(value1, value2 *Order) int { return 0 })}, ErrInvalidOption},
+		{"hook type", []Option{WithHooks(func(change Change[string, Person]) {})}, ErrInvalidOption},
+		{"nil hook", []Option{WithHooks[int64, Person](nil)}, ErrInvalidOption},
+		{"locking mode", []Option{WithLocking(LockingMode(-1))}, ErrInvalidOption},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imap, err := TryNewIndexMap(primary(), test.opts...)
+			assert.ErrorIs(t, err, test.err)
+			assert.Nil(t, imap)
+		})
+	}
+
+	assert.Panics(t, func() {
+		NewIndexMap(primary(), WithCapacity(-1))
+	})
+	imap, err := TryNewIndexMap(primary(), WithIndex(NameIndex, names), WithCapacity(1000))
+	assert.NoError(t, err)
+	assert.Same(t, names, imap.indexes[NameIndex])
+}
+
+func benchmarkInsertCapacity(b *testing.B, opts ...Option) {
+	persons := make([]*Person, 100_000)
+	for i := range persons {
+		persons[i] = &Person{ID: int64(i)}
+	}
+	b.ResetTimer()
+	for range b.N {
+		imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+			return value.ID
+		}), append(opts, WithIndex(IDIndex, NewSecondaryIndex(func(value *Person) []any {
+			return []any{value.ID}
+		})))...)
+		imap.Insert(persons...)
+	}
+}
+
+func TestWithStableOrder(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}), WithStableOrder())
+	ids := func() []int64 {
+		var ids []int64
+		for _, value := range imap.CollectOrderedBy("age") {
+			ids = append(ids, value.ID)
+		}
+		return ids
+	}
+	for _, id := range []int64{5, 3, 9, 1, 7} {
+		imap.Insert(&Person{ID: id, Age: 30 + int(id%2)})
+	}
+	imap.Insert(&Person{ID: 2, Age: 10})
+
+	// the values inserted before the ordering are in insertion order
+	imap.AddOrdering("age", Ascending(func(value *Person) int {
+		return value.Age
+	}))
+	assert.Equal(t, []int64{2, 5, 3, 9, 1, 7}, ids())
+
+	imap.Update(3, func(value *Person) (*Person, bool) {
+		return value, true
+	})
+	assert.Equal(t, []int64{2, 5, 9, 1, 7, 3}, ids())
+
+	// the order is kept without orderings
+	assert.True(t, imap.RemoveOrdering("age"))
+	imap.Insert(&Person{ID: 4, Age: 31})
+	imap.AddOrdering("age", Ascending(func(value *Person) int {
+		return value.Age
+	}))
+	assert.Equal(t, []int64{2, 5, 9, 1, 7, 3, 4}, ids())
+}
+
+func BenchmarkInsertWithoutCapacity(b *testing.B) {
+	benchmarkInsertCapacity(b)
+}
+
+func BenchmarkInsertWithCapacity(b *testing.B) {
+	benchmarkInsertCapacity(b, WithCapacity(100_000))
+}
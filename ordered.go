@@ -0,0 +1,243 @@
+package indexmap
+
+// orderedTree keeps values sorted by a compare function.
+// It is an AVL tree augmented with subtree sizes,
+// so inserts, removes and positional lookups are all O(log n).
+// Values the compare function considers equal are ordered by their
+// insertion sequence, that makes every value's position unique.
+type orderedTree[V any] struct {
+	cmp  func(value1, value2 *V) int
+	root *treeNode[V]
+}
+
+type treeNode[V any] struct {
+	value       *V
+	seq         uint64
+	left, right *treeNode[V]
+	height      int
+	size        int
+}
+
+func newOrderedTree[V any](cmp func(value1, value2 *V) int) *orderedTree[V] {
+	return &orderedTree[V]{cmp: cmp}
+}
+
+func (tree *orderedTree[V]) len() int {
+	return tree.root.count()
+}
+
+// compare orders (value, seq) against the node.
+func (tree *orderedTree[V]) compare(value *V, seq uint64, node *treeNode[V]) int {
+	if c := tree.cmp(value, node.value); c != 0 {
+		return c
+	}
+	switch {
+	case seq < node.seq:
+		return -1
+	case seq > node.seq:
+		return 1
+	}
+	return 0
+}
+
+func (tree *orderedTree[V]) insert(value *V, seq uint64) {
+	tree.root = tree.insertAt(tree.root, value, seq)
+}
+
+func (tree *orderedTree[V]) insertAt(node *treeNode[V], value *V, seq uint64) *treeNode[V] {
+	if node == nil {
+		return &treeNode[V]{value: value, seq: seq, height: 1, size: 1}
+	}
+	if tree.compare(value, seq, node) < 0 {
+		node.left = tree.insertAt(node.left, value, seq)
+	} else {
+		node.right = tree.insertAt(node.right, value, seq)
+	}
+	return node.rebalance()
+}
+
+// remove deletes the value inserted with seq,
+// the return value indicates whether it was found.
+func (tree *orderedTree[V]) remove(value *V, seq uint64) bool {
+	var found bool
+	tree.root, found = tree.removeAt(tree.root, value, seq)
+	return found
+}
+
+func (tree *orderedTree[V]) removeAt(node *treeNode[V], value *V, seq uint64) (*treeNode[V], bool) {
+	if node == nil {
+		return nil, false
+	}
+
+	var found bool
+	switch c := tree.compare(value, seq, node); {
+	case c < 0:
+		node.left, found = tree.removeAt(node.left, value, seq)
+	case c > 0:
+		node.right, found = tree.removeAt(node.right, value, seq)
+	default:
+		if node.left == nil {
+			return node.right, true
+		}
+		if node.right == nil {
+			return node.left, true
+		}
+		var min *treeNode[V]
+		node.right, min = node.right.removeMin()
+		min.left, min.right = node.left, node.right
+		return min.rebalance(), true
+	}
+	if !found {
+		return node, false
+	}
+	return node.rebalance(), true
+}
+
+// at returns the value at position i, nil if i is out of range.
+func (tree *orderedTree[V]) at(i int) *V {
+	node := tree.root
+	for node != nil {
+		left := node.left.count()
+		switch {
+		case i < left:
+			node = node.left
+		case i > left:
+			i -= left + 1
+			node = node.right
+		default:
+			return node.value
+		}
+	}
+	return nil
+}
+
+// rank returns the position of the value inserted with seq,
+// -1 if it isn't in the tree.
+func (tree *orderedTree[V]) rank(value *V, seq uint64) int {
+	rank := 0
+	node := tree.root
+	for node != nil {
+		switch c := tree.compare(value, seq, node); {
+		case c < 0:
+			node = node.left
+		case c > 0:
+			rank += node.left.count() + 1
+			node = node.right
+		default:
+			return rank + node.left.count()
+		}
+	}
+	return -1
+}
+
+// collect returns all values in ascending order.
+func (tree *orderedTree[V]) collect() []*V {
+	values := make([]*V, 0, tree.len())
+	tree.ascend(0, func(value *V) bool {
+		values = append(values, value)
+		return true
+	})
+	return values
+}
+
+// ascend calls fn for every value from position start on in ascending order,
+// stops if fn returns false.
+func (tree *orderedTree[V]) ascend(start int, fn func(value *V) bool) {
+	tree.root.ascend(start, fn)
+}
+
+func (node *treeNode[V]) ascend(start int, fn func(value *V) bool) bool {
+	if node == nil {
+		return true
+	}
+	left := node.left.count()
+	if start < left && !node.left.ascend(start, fn) {
+		return false
+	}
+	if start <= left && !fn(node.value) {
+		return false
+	}
+	return node.right.ascend(start-left-1, fn)
+}
+
+func (node *treeNode[V]) count() int {
+	if node == nil {
+		return 0
+	}
+	return node.size
+}
+
+func (node *treeNode[V]) depth() int {
+	if node == nil {
+		return 0
+	}
+	return node.height
+}
+
+func (node *treeNode[V]) update() {
+	node.height = 1 + max(node.left.depth(), node.right.depth())
+	node.size = 1 + node.left.count() + node.right.count()
+}
+
+func (node *treeNode[V]) rotateLeft() *treeNode[V] {
+	right := node.right
+	node.right = right.left
+	right.left = node
+	node.update()
+	right.update()
+	return right
+}
+
+func (node *treeNode[V]) rotateRight() *treeNode[V] {
+	left := node.left
+	node.left = left.right
+	left.right = node
+	node.update()
+	left.update()
+	return left
+}
+
+func (node *treeNode[V]) rebalance() *treeNode[V] {
+	node.update()
+	switch balance := node.left.depth() - node.right.depth(); {
+	case balance > 1:
+		if node.left.left.depth() < node.left.right.depth() {
+			node.left = node.left.rotateLeft()
+		}
+		return node.rotateRight()
+	case balance < -1:
+		if node.right.right.depth() < node.right.left.depth() {
+			node.right = node.right.rotateRight()
+		}
+		return node.rotateLeft()
+	}
+	return node
+}
+
+// removeMin detaches the leftmost node of the subtree.
+func (node *treeNode[V]) removeMin() (*treeNode[V], *treeNode[V]) {
+	if node.left == nil {
+		return node.right, node
+	}
+	var min *treeNode[V]
+	node.left, min = node.left.removeMin()
+	return node.rebalance(), min
+}
+
+// bound returns the number of values ordered before (value, seq),
+// with inclusive it also counts a value equal to it.
+// The value doesn't have to be in the tree.
+func (tree *orderedTree[V]) bound(value *V, seq uint64, inclusive bool) int {
+	count := 0
+	node := tree.root
+	for node != nil {
+		c := tree.compare(value, seq, node)
+		if c > 0 || (c == 0 && inclusive) {
+			count += node.left.count() + 1
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return count
+}
@@ -0,0 +1,58 @@
+package indexmap
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedTree(t *testing.T) {
+	type entry struct {
+		value *Person
+		seq   uint64
+	}
+	byAge := func(value1, value2 *Person) int {
+		return cmp.Compare(value1.Age, value2.Age)
+	}
+	tree := newOrderedTree(byAge)
+	myRand := rand.New(rand.NewSource(123))
+
+	var entries []entry
+	for i := range 1000 {
+		p := createRandomPerson(int64(i), myRand)
+		tree.insert(p, uint64(i))
+		entries = append(entries, entry{p, uint64(i)})
+	}
+	for i := 0; i < 400; i++ {
+		j := myRand.Intn(len(entries))
+		assert.True(t, tree.remove(entries[j].value, entries[j].seq))
+		entries = slices.Delete(entries, j, j+1)
+	}
+	assert.False(t, tree.remove(&Person{}, 5000))
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		if c := byAge(a.value, b.value); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	assert.Equal(t, len(entries), tree.len())
+	for i, e := range entries {
+		assert.Equal(t, e.value, tree.at(i))
+		assert.Equal(t, i, tree.rank(e.value, e.seq))
+	}
+
+	// the tree stays balanced
+	assert.LessOrEqual(t, tree.root.depth(), 14)
+
+	count := 0
+	tree.ascend(100, func(value *Person) bool {
+		assert.Equal(t, entries[100+count].value, value)
+		count++
+		return count < 50
+	})
+	assert.Equal(t, 50, count)
+}
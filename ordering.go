@@ -0,0 +1,208 @@
+package indexmap
+
+import (
+	"cmp"
+	"iter"
+)
+
+// defaultOrdering is the name of the ordering set by SetCmpFn.
+const defaultOrdering = ""
+
+// AddOrdering adds a named ordering maintained by the given compare function,
+// the values already inserted are sorted once, afterwards the order is kept
+// up to date on every Insert/Update/Remove in O(log n).
+// Values comparing equal are ordered by when they entered the orderings:
+// an inserted or updated value comes behind its equals,
+// the values already inserted when the first ordering is added are in no particular order,
+// unless the map was created WithStableOrder.
+// The return value indicates whether succeed to add the ordering,
+// false if the name existed or cmp is nil.
+func (imap *IndexMap[K, V]) AddOrdering(name string, cmp func(value1, value2 *V) int) bool {
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	if _, ok := imap.orderings[name]; ok || cmp == nil {
+		return false
+	}
+	imap.setOrdering(name, cmp)
+	return true
+}
+
+// RemoveOrdering drops the named ordering,
+// false if it doesn't exist.
+func (imap *IndexMap[K, V]) RemoveOrdering(name string) bool {
+	imap.lock.Lock()
+	defer imap.lock.Unlock()
+
+	return imap.removeOrdering(name)
+}
+
+// setOrdering adds or replaces an ordering, the lock must be held.
+func (imap *IndexMap[K, V]) setOrdering(name string, cmp func(value1, value2 *V) int) {
+	if imap.seqs == nil {
+		imap.seqs = make(map[*V]uint64, len(imap.primaryIndex.inner))
+		imap.primaryIndex.iterate(func(_ K, value *V) {
+			imap.seq++
+			imap.seqs[value] = imap.seq
+		})
+	}
+
+	tree := newOrderedTree(cmp)
+	for value, seq := range imap.seqs {
+		tree.insert(value, seq)
+	}
+	imap.orderings[name] = tree
+}
+
+func (imap *IndexMap[K, V]) removeOrdering(name string) bool {
+	if _, ok := imap.orderings[name]; !ok {
+		return false
+	}
+	delete(imap.orderings, name)
+	if len(imap.orderings) == 0 && !imap.stableOrder {
+		imap.seqs = nil
+	}
+	return true
+}
+
+// order adds the value to all orderings.
+func (imap *IndexMap[K, V]) order(value *V) {
+	if imap.seqs == nil {
+		return
+	}
+	imap.seq++
+	imap.seqs[value] = imap.seq
+	for _, tree := range imap.orderings {
+		tree.insert(value, imap.seq)
+	}
+}
+
+// unorder removes the value from all orderings.
+func (imap *IndexMap[K, V]) unorder(value *V) {
+	seq, ok := imap.seqs[value]
+	if !ok {
+		return
+	}
+	delete(imap.seqs, value)
+	for _, tree := range imap.orderings {
+		tree.remove(value, seq)
+	}
+}
+
+// RangeOrderedBy iterates over all the elements in the order of the named ordering,
+// stops iteration if fn returns false,
+// nothing is iterated if the ordering doesn't exist.
+// fn must not attempt modifying the IndexMap, or else it will deadlock
+func (imap *IndexMap[K, V]) RangeOrderedBy(name string, fn func(key K, value *V) bool) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	imap.rangeOrderedLocked(name, fn)
+}
+
+// rangeOrderedLocked returns false if the ordering doesn't exist.
+func (imap *IndexMap[K, V]) rangeOrderedLocked(name string, fn func(key K, value *V) bool) bool {
+	tree, ok := imap.orderings[name]
+	if !ok {
+		return false
+	}
+	tree.ascend(0, func(value *V) bool {
+		return fn(imap.primaryIndex.extractField(value), value)
+	})
+	return true
+}
+
+// CollectOrderedBy returns all the values in the order of the named ordering,
+// nil if the ordering doesn't exist.
+func (imap *IndexMap[K, V]) CollectOrderedBy(name string) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	tree, ok := imap.orderings[name]
+	if !ok {
+		return nil
+	}
+	return tree.collect()
+}
+
+// AtBy returns the value at position i of the named ordering,
+// nil if i is out of range or the ordering doesn't exist.
+func (imap *IndexMap[K, V]) AtBy(name string, i int) *V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	tree, ok := imap.orderings[name]
+	if !ok || i < 0 {
+		return nil
+	}
+	return tree.at(i)
+}
+
+// RankBy returns the position of the value in the named ordering,
+// -1 if the value isn't in the map or the ordering doesn't exist.
+// The value must be the one stored in the map, not a copy of it.
+func (imap *IndexMap[K, V]) RankBy(name string, value *V) int {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	tree, ok := imap.orderings[name]
+	if !ok {
+		return -1
+	}
+	seq, ok := imap.seqs[value]
+	if !ok {
+		return -1
+	}
+	return tree.rank(value, seq)
+}
+
+// Ordered returns an iterator over the elements in the order set by SetCmpFn,
+// like RangeOrdered the map is read locked while iterating.
+func (imap *IndexMap[K, V]) Ordered() iter.Seq2[K, *V] {
+	return imap.RangeOrdered
+}
+
+// OrderedBy returns an iterator over the elements in the order of the named ordering,
+// like RangeOrderedBy the map is read locked while iterating.
+func (imap *IndexMap[K, V]) OrderedBy(name string) iter.Seq2[K, *V] {
+	return func(yield func(key K, value *V) bool) {
+		imap.RangeOrderedBy(name, yield)
+	}
+}
+
+// Ascending returns a compare function ordering the values by the extracted key.
+func Ascending[V any, T cmp.Ordered](key func(value *V) T) func(value1, value2 *V) int {
+	return func(value1, value2 *V) int {
+		return cmp.Compare(key(value1), key(value2))
+	}
+}
+
+// Descending returns a compare function ordering the values by the extracted key,
+// largest first.
+func Descending[V any, T cmp.Ordered](key func(value *V) T) func(value1, value2 *V) int {
+	return func(value1, value2 *V) int {
+		return cmp.Compare(key(value2), key(value1))
+	}
+}
+
+// Reverse returns a compare function with the opposite order of cmp.
+func Reverse[V any](cmp func(value1, value2 *V) int) func(value1, value2 *V) int {
+	return func(value1, value2 *V) int {
+		return cmp(value2, value1)
+	}
+}
+
+// ThenBy combines compare functions, the values are ordered by the first one,
+// the following ones break the ties of the previous ones, i.e.
+//
+//	ThenBy(Ascending(byCity), Descending(byAge))
+func ThenBy[V any](cmps ...func(value1, value2 *V) int) func(value1, value2 *V) int {
+	return func(value1, value2 *V) int {
+		for _, cmp := range cmps {
+			if c := cmp(value1, value2); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
@@ -0,0 +1,133 @@
+package indexmap
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	AgeOrdering  = "age"
+	NameOrdering = "name"
+)
+
+func TestIndexMap_AddOrdering(t *testing.T) {
+	imap := CreateTestMap(300)
+
+	assert.True(t, imap.AddOrdering(AgeOrdering, Ascending(func(value *Person) int {
+		return value.Age
+	})))
+	assert.False(t, imap.AddOrdering(AgeOrdering, Ascending(func(value *Person) string {
+		return value.Name
+	})))
+	assert.False(t, imap.AddOrdering("nil", nil))
+	assert.True(t, imap.AddOrdering(NameOrdering, ThenBy(
+		Ascending(func(value *Person) string { return value.Name }),
+		Descending(func(value *Person) int { return value.Age }),
+	)))
+
+	// Insert after adding the orderings
+	InsertRandomDataFrom(imap, 300, 200)
+
+	byAge := imap.CollectOrderedBy(AgeOrdering)
+	assert.Equal(t, 500, len(byAge))
+	assert.True(t, slices.IsSortedFunc(byAge, func(p1, p2 *Person) int {
+		return p1.Age - p2.Age
+	}))
+
+	byName := imap.CollectOrderedBy(NameOrdering)
+	assert.Equal(t, 500, len(byName))
+	for i := 1; i < len(byName); i++ {
+		assert.LessOrEqual(t, byName[i-1].Name, byName[i].Name)
+		if byName[i-1].Name == byName[i].Name {
+			assert.GreaterOrEqual(t, byName[i-1].Age, byName[i].Age)
+		}
+	}
+
+	// Update moves the value in every ordering
+	imap.Update(byAge[0].ID, func(value *Person) (*Person, bool) {
+		value.Age = 200
+		value.Name = "AAA"
+		return value, true
+	})
+	assert.Equal(t, 499, imap.RankBy(AgeOrdering, byAge[0]))
+	assert.Equal(t, byAge[0], imap.AtBy(NameOrdering, 0))
+
+	// Remove
+	imap.Remove(byAge[0].ID)
+	assert.Equal(t, -1, imap.RankBy(AgeOrdering, byAge[0]))
+	assert.Equal(t, 499, len(imap.CollectOrderedBy(NameOrdering)))
+
+	// Unknown orderings
+	assert.Nil(t, imap.CollectOrderedBy("invalid"))
+	assert.Nil(t, imap.AtBy("invalid", 0))
+	assert.Equal(t, -1, imap.RankBy("invalid", byAge[1]))
+	imap.RangeOrderedBy("invalid", func(key int64, value *Person) bool {
+		assert.Fail(t, "an unknown ordering must not be iterated")
+		return true
+	})
+
+	assert.True(t, imap.RemoveOrdering(NameOrdering))
+	assert.False(t, imap.RemoveOrdering(NameOrdering))
+	assert.Nil(t, imap.CollectOrderedBy(NameOrdering))
+	assert.Equal(t, 499, len(imap.CollectOrderedBy(AgeOrdering)))
+}
+
+func TestIndexMap_OrderingStable(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}))
+	imap.AddOrdering(AgeOrdering, Ascending(func(value *Person) int {
+		return value.Age
+	}))
+	for i := range 10 {
+		imap.Insert(&Person{ID: int64(i), Age: i % 2})
+	}
+	ids := []int64{}
+	imap.RangeOrderedBy(AgeOrdering, func(key int64, value *Person) bool {
+		ids = append(ids, key)
+		return true
+	})
+	assert.Equal(t, []int64{0, 2, 4, 6, 8, 1, 3, 5, 7, 9}, ids)
+
+	// an updated value moves behind its equals
+	imap.Insert(&Person{ID: 2, Age: 0})
+	ids = ids[:0]
+	imap.RangeOrderedBy(AgeOrdering, func(key int64, value *Person) bool {
+		ids = append(ids, key)
+		return true
+	})
+	assert.Equal(t, []int64{0, 4, 6, 8, 2, 1, 3, 5, 7, 9}, ids)
+}
+
+func TestIndexMap_OrderedIterators(t *testing.T) {
+	imap := CreateTestMap(100)
+	imap.SetCmpFn(Descending(func(value *Person) int {
+		return value.Age
+	}))
+	imap.AddOrdering(NameOrdering, Ascending(func(value *Person) string {
+		return value.Name
+	}))
+
+	var ages []int
+	for key, value := range imap.Ordered() {
+		assert.Equal(t, key, value.ID)
+		ages = append(ages, value.Age)
+	}
+	assert.Equal(t, 100, len(ages))
+	assert.True(t, slices.IsSortedFunc(ages, func(a, b int) int { return b - a }))
+
+	var names []string
+	for _, value := range imap.OrderedBy(NameOrdering) {
+		names = append(names, value.Name)
+		if len(names) == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, len(names))
+	assert.True(t, slices.IsSorted(names))
+
+	reversed := Reverse(Ascending(func(value *Person) int { return value.Age }))
+	assert.Equal(t, 1, reversed(&Person{Age: 1}, &Person{Age: 2}))
+}
@@ -0,0 +1,442 @@
+package indexmap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Cursor is an opaque position in an ordering or index as returned by Page,
+// it is a plain string that can be handed out to clients and stored.
+// A cursor remembers the sort key of the last seen value instead of an offset,
+// so it stays valid while values are inserted and removed concurrently,
+// the last seen value included: paging resumes right after (or before) the
+// position the value had. The sort key of an ordering consists of the fields
+// of the value the ordering compares, of an index of the index key and the primary key.
+type Cursor string
+
+// EndCursor starts paging backward from the end of an ordering or index.
+const EndCursor Cursor = "end"
+
+// Page is a part of an ordering or index as returned by IndexMap.Page.
+type Page[V any] struct {
+	// Items are in ascending order, also when paging backward.
+	Items []*V
+	// Next continues after the last item,
+	// empty if there are no more items.
+	Next Cursor
+	// Prev continues backward before the first item,
+	// empty if there are no items before.
+	Prev Cursor
+}
+
+// cursorPos is the decoded Cursor,
+// Fields and Seq are set for orderings, Key and Primary for indexes.
+type cursorPos struct {
+	Backward bool `json:"b,omitempty"`
+	// the compared fields of the last seen value by name,
+	// the whole value under the empty name if it's no struct
+	Fields map[string]json.RawMessage `json:"f,omitempty"`
+	// the seq of the last seen value breaking the ties, seqs start at 1
+	Seq     uint64   `json:"q,omitempty"`
+	Key     *sortKey `json:"k,omitempty"`
+	Primary *sortKey `json:"p,omitempty"`
+}
+
+func (pos *cursorPos) encode() (Cursor, error) {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return "", err
+	}
+	return Cursor(base64.RawURLEncoding.EncodeToString(data)), nil
+}
+
+// decodeCursor returns nil for the empty cursor.
+func decodeCursor(cursor Cursor) (*cursorPos, error) {
+	switch cursor {
+	case "":
+		return nil, nil
+	case EndCursor:
+		return &cursorPos{Backward: true}, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(string(cursor))
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	pos := &cursorPos{}
+	if err := json.Unmarshal(data, pos); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return pos, nil
+}
+
+// Page returns up to limit values of the named ordering or index,
+// starting after the cursor. The empty cursor starts at the beginning,
+// EndCursor pages backward from the end, Page.Next and Page.Prev
+// continue forward and backward.
+// The default ordering set by SetCmpFn has the empty name.
+//
+// Paging an ordering costs O(log n + limit). The cursor contains the exported
+// fields of the last seen value the ordering compares, found by comparing the value
+// to copies with one of the fields zeroed. They must be serializable as JSON,
+// orderings comparing unexported fields can't be paged beyond the first page.
+// Paging an index walks the entries ordered by index key, values of the same
+// key are ordered by their primary key; a value appears once per index key.
+// Keys are ordered by type name first, then by value, non basic types by
+// their fmt representation. The sorted keys are kept until the map is modified,
+// the first call after a modification sorts them in O(k log k) for k keys,
+// the others cost O(log k + limit) plus sorting the values of the walked keys.
+func (imap *IndexMap[K, V]) Page(name string, cursor Cursor, limit int) (Page[V], error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	pos, err := decodeCursor(cursor)
+	if err != nil {
+		return Page[V]{}, err
+	}
+
+	if tree, ok := imap.orderings[name]; ok {
+		return imap.pageOrdering(tree, pos, limit)
+	}
+	if index, ok := imap.indexes[name].(keyedIndex[V]); ok {
+		return imap.pageIndex(name, index, pos, limit)
+	}
+	return Page[V]{}, ErrUnknownName
+}
+
+func (imap *IndexMap[K, V]) pageOrdering(tree *orderedTree[V], pos *cursorPos, limit int) (Page[V], error) {
+	if pos != nil && pos.Key != nil {
+		return Page[V]{}, ErrInvalidCursor
+	}
+
+	n := tree.len()
+	limit = max(limit, 0)
+	var start, end int
+	switch {
+	case pos == nil:
+		start, end = 0, min(limit, n)
+	case pos.Seq == 0:
+		if !pos.Backward {
+			return Page[V]{}, ErrInvalidCursor
+		}
+		start, end = max(n-limit, 0), n
+	default:
+		// the value may be gone, a probe with its sort key takes its position
+		value, err := decodeSortFields[V](pos.Fields)
+		if err != nil {
+			return Page[V]{}, err
+		}
+		if pos.Backward {
+			end = tree.bound(value, pos.Seq, false)
+			start = max(end-limit, 0)
+		} else {
+			start = tree.bound(value, pos.Seq, true)
+			end = min(start+limit, n)
+		}
+	}
+
+	page := Page[V]{Items: make([]*V, 0, end-start)}
+	if start == end {
+		return page, nil
+	}
+	tree.ascend(start, func(value *V) bool {
+		page.Items = append(page.Items, value)
+		return len(page.Items) < end-start
+	})
+
+	var err error
+	if end < n {
+		page.Next, err = imap.orderingCursor(tree, page.Items[len(page.Items)-1], false)
+		if err != nil {
+			return Page[V]{}, err
+		}
+	}
+	if start > 0 {
+		page.Prev, err = imap.orderingCursor(tree, page.Items[0], true)
+		if err != nil {
+			return Page[V]{}, err
+		}
+	}
+	return page, nil
+}
+
+func (imap *IndexMap[K, V]) orderingCursor(tree *orderedTree[V], value *V, backward bool) (Cursor, error) {
+	fields, err := sortFields(tree.cmp, value)
+	if err != nil {
+		return "", err
+	}
+	pos := cursorPos{Backward: backward, Fields: fields, Seq: imap.seqs[value]}
+	return pos.encode()
+}
+
+// sortFields returns the exported fields of the value cmp compares, encoded as JSON.
+// A field is compared if zeroing it changes the order of the value,
+// the fields are completed until a probe with them compares equal to the value.
+func sortFields[V any](cmp func(value1, value2 *V) int, value *V) (map[string]json.RawMessage, error) {
+	rv := reflect.ValueOf(value).Elem()
+	if rv.Kind() != reflect.Struct {
+		data, err := json.Marshal(value)
+		return map[string]json.RawMessage{"": data}, err
+	}
+
+	typ := rv.Type()
+	probe := reflect.New(typ)
+	trial := reflect.New(typ)
+	var fields []int
+	for i := range typ.NumField() {
+		if !typ.Field(i).IsExported() {
+			continue
+		}
+		trial.Elem().Set(rv)
+		trial.Elem().Field(i).SetZero()
+		if compareProbe(cmp, value, trial.Interface().(*V)) != 0 {
+			fields = append(fields, i)
+			probe.Elem().Field(i).Set(rv.Field(i))
+		}
+	}
+	for i := 0; compareProbe(cmp, probe.Interface().(*V), value) != 0; i++ {
+		if i == typ.NumField() {
+			return nil, fmt.Errorf("%w: the ordering compares unexported fields of %s", ErrInvalidCursor, typ)
+		}
+		if typ.Field(i).IsExported() && !slices.Contains(fields, i) {
+			fields = append(fields, i)
+			probe.Elem().Field(i).Set(rv.Field(i))
+		}
+	}
+
+	encoded := make(map[string]json.RawMessage, len(fields))
+	for _, i := range fields {
+		data, err := json.Marshal(rv.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		encoded[typ.Field(i).Name] = data
+	}
+	return encoded, nil
+}
+
+// compareProbe is cmp, a cmp panicking for zeroed fields sees them as different.
+func compareProbe[V any](cmp func(value1, value2 *V) int, value1, value2 *V) (c int) {
+	defer func() {
+		if recover() != nil {
+			c = 1
+		}
+	}()
+	return cmp(value1, value2)
+}
+
+// decodeSortFields returns a probe value holding the fields of sortFields.
+func decodeSortFields[V any](fields map[string]json.RawMessage) (*V, error) {
+	value := new(V)
+	rv := reflect.ValueOf(value).Elem()
+	if rv.Kind() != reflect.Struct {
+		if err := json.Unmarshal(fields[""], value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	}
+	for name, data := range fields {
+		field, ok := rv.Type().FieldByName(name)
+		if !ok || !field.IsExported() || len(field.Index) != 1 {
+			return nil, ErrInvalidCursor
+		}
+		if err := json.Unmarshal(data, rv.Field(field.Index[0]).Addr().Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return value, nil
+}
+
+// indexEntry is a value as seen under one of its index keys.
+type indexEntry[V any] struct {
+	key     sortKey
+	primary sortKey
+	value   *V
+}
+
+type indexGroup[V any] struct {
+	key    sortKey
+	values bucket[V]
+}
+
+// pageKeys are the groups of an index sorted by key,
+// valid as long as the version of the map doesn't change.
+type pageKeys[V any] struct {
+	index   Index[V]
+	version uint64
+	groups  []indexGroup[V]
+}
+
+// sortedGroups returns the groups of the index sorted by key,
+// they are sorted once for all pages until the map is modified.
+// The caller holds the read lock of the map.
+func (imap *IndexMap[K, V]) sortedGroups(name string, index keyedIndex[V]) []indexGroup[V] {
+	imap.pageMu.Lock()
+	defer imap.pageMu.Unlock()
+
+	if keys, ok := imap.pageKeys[name]; ok && keys.index == index && keys.version == imap.version {
+		return keys.groups
+	}
+	var groups []indexGroup[V]
+	index.iterate(func(key any, values bucket[V]) bool {
+		groups = append(groups, indexGroup[V]{key: sortKeyOf(key), values: values})
+		return true
+	})
+	slices.SortFunc(groups, func(g1, g2 indexGroup[V]) int {
+		return g1.key.compare(g2.key)
+	})
+	if imap.pageKeys == nil {
+		imap.pageKeys = make(map[string]*pageKeys[V])
+	}
+	imap.pageKeys[name] = &pageKeys[V]{index: index, version: imap.version, groups: groups}
+	return groups
+}
+
+func (imap *IndexMap[K, V]) pageIndex(name string, index keyedIndex[V], pos *cursorPos, limit int) (Page[V], error) {
+	var from *indexEntry[V]
+	backward := false
+	if pos != nil {
+		if pos.Seq != 0 {
+			return Page[V]{}, ErrInvalidCursor
+		}
+		backward = pos.Backward
+		if pos.Key != nil {
+			if pos.Primary == nil {
+				return Page[V]{}, ErrInvalidCursor
+			}
+			from = &indexEntry[V]{key: *pos.Key, primary: *pos.Primary}
+		} else if !backward {
+			return Page[V]{}, ErrInvalidCursor
+		}
+	}
+
+	groups := imap.sortedGroups(name, index)
+
+	// one more than requested tells whether there is a further page
+	limit = max(limit, 0)
+	entries := make([]indexEntry[V], 0, limit+1)
+	imap.walkIndex(groups, from, backward, func(entry indexEntry[V]) bool {
+		entries = append(entries, entry)
+		return len(entries) <= limit
+	})
+
+	more := len(entries) > limit
+	entries = entries[:min(len(entries), limit)]
+	if backward {
+		slices.Reverse(entries)
+	}
+
+	page := Page[V]{Items: make([]*V, len(entries))}
+	for i := range entries {
+		page.Items[i] = entries[i].value
+	}
+	if len(entries) == 0 {
+		return page, nil
+	}
+
+	first, last := &entries[0], &entries[len(entries)-1]
+	hasNext, hasPrev := more, more
+	if backward {
+		hasNext = imap.hasIndexEntry(groups, last, false)
+	} else {
+		hasPrev = imap.hasIndexEntry(groups, first, true)
+	}
+
+	var err error
+	if hasNext {
+		pos := cursorPos{Key: &last.key, Primary: &last.primary}
+		if page.Next, err = pos.encode(); err != nil {
+			return Page[V]{}, err
+		}
+	}
+	if hasPrev {
+		pos := cursorPos{Backward: true, Key: &first.key, Primary: &first.primary}
+		if page.Prev, err = pos.encode(); err != nil {
+			return Page[V]{}, err
+		}
+	}
+	return page, nil
+}
+
+func (imap *IndexMap[K, V]) hasIndexEntry(groups []indexGroup[V], from *indexEntry[V], backward bool) bool {
+	found := false
+	imap.walkIndex(groups, from, backward, func(indexEntry[V]) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// walkIndex calls fn for the index entries after from, or before it if backward,
+// from nil walks from the beginning, or the end if backward.
+func (imap *IndexMap[K, V]) walkIndex(groups []indexGroup[V], from *indexEntry[V], backward bool, fn func(entry indexEntry[V]) bool) {
+	compareEntries := func(e1, e2 indexEntry[V]) int {
+		return e1.primary.compare(e2.primary)
+	}
+
+	i, found := 0, false
+	if from != nil {
+		i, found = slices.BinarySearchFunc(groups, from.key, func(group indexGroup[V], key sortKey) int {
+			return group.key.compare(key)
+		})
+	}
+	if backward {
+		if from == nil {
+			i = len(groups)
+		}
+		if found {
+			i++
+		}
+	}
+
+	for n := 0; ; n++ {
+		if backward {
+			i--
+		}
+		if i < 0 || i >= len(groups) {
+			return
+		}
+
+		entries := make([]indexEntry[V], 0, groups[i].values.len())
+		for value := range groups[i].values.all() {
+			entries = append(entries, indexEntry[V]{
+				key:     groups[i].key,
+				primary: sortKeyOf(imap.primaryIndex.extractField(value)),
+				value:   value,
+			})
+		}
+		slices.SortFunc(entries, compareEntries)
+
+		// only the group of the cursor is partially walked
+		partial := n == 0 && found
+		if backward {
+			j := len(entries)
+			if partial {
+				j, _ = slices.BinarySearchFunc(entries, *from, compareEntries)
+			}
+			for j--; j >= 0; j-- {
+				if !fn(entries[j]) {
+					return
+				}
+			}
+		} else {
+			j := 0
+			if partial {
+				var exact bool
+				j, exact = slices.BinarySearchFunc(entries, *from, compareEntries)
+				if exact {
+					j++
+				}
+			}
+			for ; j < len(entries); j++ {
+				if !fn(entries[j]) {
+					return
+				}
+			}
+			i++
+		}
+	}
+}
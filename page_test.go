@@ -0,0 +1,185 @@
+package indexmap
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectPages(t *testing.T, imap *IndexMap[int64, Person], name string, cursor Cursor, limit int, backward bool) []*Person {
+	var all []*Person
+	for {
+		page, err := imap.Page(name, cursor, limit)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Items), limit)
+		if backward {
+			all = append(page.Items, all...)
+			cursor = page.Prev
+		} else {
+			all = append(all, page.Items...)
+			cursor = page.Next
+		}
+		if cursor == "" {
+			return all
+		}
+	}
+}
+
+func TestIndexMap_PageOrdering(t *testing.T) {
+	imap := CreateTestMap(250)
+	imap.SetCmpFn(Ascending(func(value *Person) int {
+		return value.Age
+	}))
+	imap.AddOrdering(NameOrdering, Ascending(func(value *Person) string {
+		return value.Name
+	}))
+
+	assert.Equal(t, imap.CollectValuesOrdered(), collectPages(t, imap, "", "", 20, false))
+	assert.Equal(t, imap.CollectValuesOrdered(), collectPages(t, imap, "", EndCursor, 20, true))
+	assert.Equal(t, imap.CollectOrderedBy(NameOrdering), collectPages(t, imap, NameOrdering, "", 7, false))
+
+	first, err := imap.Page("", "", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, first.Prev)
+	second, err := imap.Page("", first.Next, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, imap.CollectValuesOrdered()[10:20], second.Items)
+	back, err := imap.Page("", second.Prev, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Items, back.Items)
+	assert.Empty(t, back.Prev)
+
+	// the cursor holds only the compared fields of the last seen value, it resumes
+	// after them even if the value got removed and other values were inserted before it
+	last := second.Items[9]
+	pos, err := decodeCursor(second.Next)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{"Age": json.RawMessage(strconv.Itoa(last.Age))}, pos.Fields)
+	imap.Remove(last.ID)
+	imap.Insert(&Person{ID: 1000, Name: "Young", Age: -1})
+	third, err := imap.Page("", second.Next, 10)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, third.Items[0].Age, last.Age)
+	assert.Equal(t, imap.CollectValuesOrdered()[20:30], third.Items)
+	back, err = imap.Page("", third.Prev, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, imap.CollectValuesOrdered()[10:20], back.Items)
+
+	end, err := imap.Page("", EndCursor, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, end.Next)
+	assert.Equal(t, imap.CollectValuesOrdered()[240:], end.Items)
+
+	// orderings of several fields
+	imap.AddOrdering("cityAge", ThenBy(Ascending(func(value *Person) string {
+		return value.City
+	}), Descending(func(value *Person) int {
+		return value.Age
+	})))
+	assert.Equal(t, imap.CollectOrderedBy("cityAge"), collectPages(t, imap, "cityAge", "", 9, false))
+	page, err := imap.Page("cityAge", "", 100)
+	assert.NoError(t, err)
+	pos, err = decodeCursor(page.Next)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"City", "Age"}, slices.Collect(maps.Keys(pos.Fields)))
+}
+
+type secretScore struct {
+	Name  string
+	score int
+}
+
+func TestIndexMap_PageUnexportedOrdering(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *secretScore) string {
+		return value.Name
+	}), WithOrdering(func(value1, value2 *secretScore) int {
+		return value1.score - value2.score
+	}))
+	imap.Insert(&secretScore{"a", 2}, &secretScore{"b", 1})
+	_, err := imap.Page("", "", 1)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestIndexMap_PageIndex(t *testing.T) {
+	imap := CreateTestMap(250)
+	imap.AddIndex(LikeIndex, NewSecondaryIndex(func(value *Person) []any {
+		like := make([]any, 0, len(value.Like))
+		for i := range value.Like {
+			like = append(like, value.Like[i])
+		}
+		return like
+	}))
+
+	forward := collectPages(t, imap, CityIndex, "", 13, false)
+	assert.Equal(t, 250, len(forward))
+	for i := 1; i < len(forward); i++ {
+		assert.LessOrEqual(t, forward[i-1].City, forward[i].City)
+		if forward[i-1].City == forward[i].City {
+			assert.Less(t, forward[i-1].ID, forward[i].ID)
+		}
+	}
+	assert.Equal(t, forward, collectPages(t, imap, CityIndex, EndCursor, 13, true))
+
+	entries := 0
+	imap.RangeBy(LikeIndex, func(key any, values []*Person) bool {
+		entries += len(values)
+		return true
+	})
+	likes := collectPages(t, imap, LikeIndex, "", 50, false)
+	assert.Equal(t, entries, len(likes))
+
+	page, err := imap.Page(CityIndex, "", 5)
+	assert.NoError(t, err)
+	next, err := imap.Page(CityIndex, page.Next, 5)
+	assert.NoError(t, err)
+	prev, err := imap.Page(CityIndex, next.Prev, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, page.Items, prev.Items)
+	assert.Empty(t, prev.Prev)
+	assert.Equal(t, page.Next, prev.Next)
+
+	// the sorted keys are kept for the next pages
+	assert.Equal(t, imap.version, imap.pageKeys[CityIndex].version)
+
+	// inserting a value before the cursor doesn't shift the next page
+	imap.Insert(&Person{ID: 1000, City: "AAA"})
+	again, err := imap.Page(CityIndex, page.Next, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, next.Items, again.Items)
+}
+
+func TestIndexMap_PageErrors(t *testing.T) {
+	imap := CreateTestMap(10)
+	imap.SetCmpFn(Ascending(func(value *Person) int {
+		return value.Age
+	}))
+
+	_, err := imap.Page(InvalidIndex, "", 5)
+	assert.ErrorIs(t, err, ErrUnknownName)
+	_, err = imap.Page("", "not a cursor", 5)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	page, err := imap.Page(CityIndex, "", 5)
+	assert.NoError(t, err)
+	_, err = imap.Page("", page.Next, 5)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	page, err = imap.Page("", "", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, page.Items)
+	assert.Empty(t, page.Next)
+}
+
+func TestSortKey(t *testing.T) {
+	assert.Equal(t, -1, sortKeyOf(-2.5).compare(sortKeyOf(1.0)))
+	assert.Equal(t, -1, sortKeyOf(-3.0).compare(sortKeyOf(-2.5)))
+	assert.Equal(t, 1, sortKeyOf(10).compare(sortKeyOf(9)))
+	assert.Equal(t, 0, sortKeyOf("a").compare(sortKeyOf("a")))
+	assert.Equal(t, -1, sortKeyOf(false).compare(sortKeyOf(true)))
+	assert.NotEqual(t, 0, sortKeyOf(int64(1)).compare(sortKeyOf(1)))
+	assert.Equal(t, -1, sortKeyOf(nil).compare(sortKeyOf(struct{}{})))
+}
@@ -0,0 +1,190 @@
+package indexmap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelChunk is the number of values a worker of a parallel scan takes at once,
+// smaller maps and bulk inserts are processed serially.
+const parallelChunk = 1024
+
+// ParallelOption configures ParallelFilter.
+type ParallelOption func(config *parallelConfig)
+
+type parallelConfig struct {
+	workers int
+	ordered bool
+}
+
+// WithWorkers sets the number of goroutines,
+// the default, also for n <= 0, is runtime.GOMAXPROCS(0).
+func WithWorkers(n int) ParallelOption {
+	return func(config *parallelConfig) {
+		config.workers = n
+	}
+}
+
+// WithOrderedOutput returns the values in the order of CollectValuesOrdered,
+// otherwise the order is undefined.
+func WithOrderedOutput() ParallelOption {
+	return func(config *parallelConfig) {
+		config.ordered = true
+	}
+}
+
+// ParallelRange calls fn for all the elements concurrently on the number of workers,
+// runtime.GOMAXPROCS(0) for workers <= 0, no any guarantee to the order.
+// The map is read locked until all calls returned, so they see a consistent snapshot.
+// If fn returns false the iteration stops, the calls already running still complete.
+// fn must be safe for concurrent use, and must not attempt modifying the IndexMap,
+// or else it will deadlock.
+func (imap *IndexMap[K, V]) ParallelRange(workers int, fn func(key K, value *V) bool) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	imap.scanParallel(workers, false, func(_ int, keys []K, values []*V) bool {
+		for i := range values {
+			if !fn(keys[i], values[i]) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// ParallelFilter returns the values pred holds for, pred is evaluated concurrently,
+// see ParallelOption for the number of workers and the order of the result.
+// The map is read locked until all calls returned, so they see a consistent snapshot.
+// pred must be safe for concurrent use, and must not attempt modifying the IndexMap,
+// or else it will deadlock.
+func (imap *IndexMap[K, V]) ParallelFilter(pred func(value *V) bool, opts ...ParallelOption) []*V {
+	config := parallelConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	// every chunk is filtered into its own slot, so they're concatenated in order
+	matched := make([][]*V, (len(imap.primaryIndex.inner)+parallelChunk-1)/parallelChunk)
+	imap.scanParallel(config.workers, config.ordered, func(n int, _ []K, values []*V) bool {
+		for _, value := range values {
+			if pred(value) {
+				matched[n] = append(matched[n], value)
+			}
+		}
+		return true
+	})
+
+	count := 0
+	for _, values := range matched {
+		count += len(values)
+	}
+	result := make([]*V, 0, count)
+	for _, values := range matched {
+		result = append(result, values...)
+	}
+	return result
+}
+
+// scanParallel calls fn for the chunks of the values on the workers, n numbers the chunks
+// in the order of the scan, that's the order of the default ordering if ordered is true,
+// keys are nil then. It stops if fn returns false and returns after all calls returned.
+// The caller holds the lock of the map.
+func (imap *IndexMap[K, V]) scanParallel(workers int, ordered bool, fn func(n int, keys []K, values []*V) bool) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if len(imap.primaryIndex.inner) <= parallelChunk || workers == 1 {
+		workers = 0
+	}
+
+	type chunk struct {
+		n      int
+		keys   []K
+		values []*V
+	}
+	chunks := make(chan chunk, workers)
+	var stopped atomic.Bool
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				if !stopped.Load() && !fn(c.n, c.keys, c.values) {
+					stopped.Store(true)
+				}
+			}
+		}()
+	}
+	// without workers the chunks are processed serially
+	send := func(c chunk) bool {
+		if workers == 0 {
+			if !fn(c.n, c.keys, c.values) {
+				stopped.Store(true)
+			}
+		} else {
+			chunks <- c
+		}
+		return !stopped.Load()
+	}
+
+	if tree, ok := imap.orderings[defaultOrdering]; ok && ordered {
+		values := tree.collect()
+		for n := 0; n*parallelChunk < len(values); n++ {
+			if !send(chunk{n: n, values: values[n*parallelChunk : min((n+1)*parallelChunk, len(values))]}) {
+				break
+			}
+		}
+	} else {
+		current := chunk{keys: make([]K, 0, parallelChunk), values: make([]*V, 0, parallelChunk)}
+		for key, value := range imap.primaryIndex.inner {
+			current.keys = append(current.keys, key)
+			current.values = append(current.values, value)
+			if len(current.values) < parallelChunk {
+				continue
+			}
+			if !send(current) {
+				break
+			}
+			current = chunk{n: current.n + 1, keys: make([]K, 0, parallelChunk), values: make([]*V, 0, parallelChunk)}
+		}
+		if len(current.values) > 0 && !stopped.Load() {
+			send(current)
+		}
+	}
+	close(chunks)
+	wg.Wait()
+}
+
+// BulkInsert is Insert for many values, the indexes are updated in parallel,
+// every index on its own goroutine, so the extractField funcs of the indexes
+// must be safe for concurrent use.
+// Values with the same primary key overwrite each other in order like Insert.
+func (imap *IndexMap[K, V]) BulkInsert(values ...*V) {
+	imap.mustWrite()
+	_ = imap.TryBulkInsert(values...)
+}
+
+// TryBulkInsert is BulkInsert, but reports values referencing missing values of
+// foreign keys with ErrForeignKey, nothing is inserted then.
+func (imap *IndexMap[K, V]) TryBulkInsert(values ...*V) error {
+	if err := imap.checkWrite(); err != nil {
+		return err
+	}
+	defer imap.writeLock()()
+
+	return imap.bulkInsert(values)
+}
+
+// bulkInsert is the lock free version of TryBulkInsert
+func (imap *IndexMap[K, V]) bulkInsert(values []*V) error {
+	if len(values) < parallelChunk || len(imap.indexes) < 2 {
+		return imap.insert(values...)
+	}
+	return imap.bulkLoad(values, OverwriteDuplicates, true)
+}
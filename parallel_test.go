@@ -0,0 +1,146 @@
+package indexmap
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexMap_ParallelRange(t *testing.T) {
+	imap := CreateTestMap(10000)
+
+	var count, sum atomic.Int64
+	imap.ParallelRange(4, func(key int64, value *Person) bool {
+		assert.Equal(t, key, value.ID)
+		count.Add(1)
+		sum.Add(key)
+		return true
+	})
+	assert.EqualValues(t, 10000, count.Load())
+	assert.EqualValues(t, 10000*9999/2, sum.Load())
+
+	count.Store(0)
+	imap.ParallelRange(0, func(key int64, value *Person) bool {
+		count.Add(1)
+		return false
+	})
+	// every worker stops after its first call
+	assert.Less(t, count.Load(), int64(10000))
+	assert.Greater(t, count.Load(), int64(0))
+}
+
+func TestIndexMap_ParallelFilter(t *testing.T) {
+	imap := CreateTestMap(10000)
+	pred := func(value *Person) bool {
+		return value.Age >= 30 && value.City != "Venice"
+	}
+
+	byID := func(values []*Person) []*Person {
+		return slices.SortedFunc(slices.Values(values), func(value1, value2 *Person) int {
+			return cmp.Compare(value1.ID, value2.ID)
+		})
+	}
+	expected := byID(filterPersons(imap, pred))
+	assert.Equal(t, expected, byID(imap.ParallelFilter(pred)))
+	assert.Equal(t, expected, byID(imap.ParallelFilter(pred, WithWorkers(1))))
+	assert.Empty(t, imap.ParallelFilter(func(value *Person) bool { return false }, WithWorkers(3)))
+
+	imap.SetCmpFn(func(value1, value2 *Person) int {
+		return cmp.Compare(value1.Age, value2.Age)
+	})
+	expected = slices.DeleteFunc(imap.CollectValuesOrdered(), func(value *Person) bool {
+		return !pred(value)
+	})
+	assert.Equal(t, expected, imap.ParallelFilter(pred, WithOrderedOutput(), WithWorkers(8)))
+
+	small := CreateTestMap(10)
+	assert.ElementsMatch(t, filterPersons(small, pred), small.ParallelFilter(pred))
+}
+
+func TestIndexMap_BulkInsert(t *testing.T) {
+	serial := CreateTestMap(0)
+	bulk := CreateTestMap(0)
+	for _, imap := range []*IndexMap[int64, Person]{serial, bulk} {
+		imap.AddIndex(LikeIndex, NewSecondaryIndex(func(value *Person) []any {
+			keys := make([]any, len(value.Like))
+			for i := range value.Like {
+				keys[i] = value.Like[i]
+			}
+			return keys
+		}))
+		imap.SetCmpFn(func(value1, value2 *Person) int {
+			return cmp.Compare(value1.Age, value2.Age)
+		})
+		InsertRandomData(imap, 500)
+	}
+	var serialChanges, bulkChanges []Change[int64, Person]
+	serial.OnChange(func(change Change[int64, Person]) {
+		serialChanges = append(serialChanges, change)
+	})
+	bulk.OnChange(func(change Change[int64, Person]) {
+		bulkChanges = append(bulkChanges, change)
+	})
+
+	values := make([]*Person, 0, 5000)
+	for i := range 5000 {
+		// overwrites the values from 250, and some of its own
+		id := int64(250 + i%4000)
+		values = append(values, &Person{ID: id, Name: names[i%len(names)], Age: i % 100, City: cities[i%len(cities)], Like: []string{names[i%7]}})
+	}
+	serial.Insert(values...)
+	bulk.BulkInsert(values...)
+
+	assert.Equal(t, 4250, bulk.Len())
+	assert.Equal(t, serial.CollectValuesOrdered(), bulk.CollectValuesOrdered())
+	for _, index := range []string{NameIndex, CityIndex, LikeIndex} {
+		for _, key := range append(names, cities...) {
+			assert.ElementsMatch(t, serial.GetAllBy(index, key), bulk.GetAllBy(index, key), index, key)
+		}
+	}
+	assert.Equal(t, len(serialChanges), len(bulkChanges))
+	assert.Equal(t, serialChanges, bulkChanges)
+}
+
+var parallelCount = 1000000
+
+func BenchmarkFilter(b *testing.B) {
+	imap := CreateTestMap(parallelCount)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterPersons(imap, func(value *Person) bool {
+			return value.Age >= 30
+		})
+	}
+}
+
+func BenchmarkParallelFilter(b *testing.B) {
+	imap := CreateTestMap(parallelCount)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		imap.ParallelFilter(func(value *Person) bool {
+			return value.Age >= 30
+		})
+	}
+}
+
+func benchmarkInsert(b *testing.B, insert func(imap *IndexMap[int64, Person], values ...*Person)) {
+	values := make([]*Person, 0, 100000)
+	for i := range 100000 {
+		values = append(values, &Person{ID: int64(i), Name: names[i%len(names)], Age: i % 100, City: cities[i%len(cities)], Like: []string{names[i%7]}})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		insert(CreateTestMap(0), values...)
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	benchmarkInsert(b, (*IndexMap[int64, Person]).Insert)
+}
+
+func BenchmarkBulkInsert(b *testing.B) {
+	benchmarkInsert(b, (*IndexMap[int64, Person]).BulkInsert)
+}
@@ -0,0 +1,100 @@
+package indexmap
+
+// PartialIndex is a secondary index only of the values the predicate holds for,
+// i.e. only active orders by customer, saving the memory for the others.
+// Updates move values in and out of the index as their predicate result changes.
+type PartialIndex[V any] struct {
+	predicate func(value *V) bool
+	inner     *SecondaryIndex[V]
+
+	// the values in the index
+	covered Set[*V]
+}
+
+// Create a partial index,
+// the extractField func returns the keys for seeking the value like for NewSecondaryIndex,
+// it's called only for values the predicate holds for.
+func NewPartialIndex[V any](predicate func(value *V) bool, extractField func(value *V) []any) *PartialIndex[V] {
+	return &PartialIndex[V]{
+		predicate: predicate,
+		inner:     NewSecondaryIndex(extractField),
+		covered:   make(Set[*V]),
+	}
+}
+
+func (index *PartialIndex[V]) insert(elem *V) {
+	if !index.predicate(elem) {
+		return
+	}
+	index.covered.Insert(elem)
+	index.inner.insert(elem)
+}
+
+func (index *PartialIndex[V]) remove(elem *V) {
+	// the predicate may not hold any more for a modified value
+	if !index.covered.Contain(elem) {
+		return
+	}
+	index.covered.Remove(elem)
+	index.inner.remove(elem)
+}
+
+func (index *PartialIndex[V]) clear() {
+	index.covered = make(Set[*V])
+	index.inner.clear()
+}
+
+func (index *PartialIndex[V]) get(key any) bucket[V] {
+	return index.inner.get(key)
+}
+
+func (index *PartialIndex[V]) iterate(fn func(key any, elems bucket[V]) bool) {
+	index.inner.iterate(fn)
+}
+
+func (index *PartialIndex[V]) counts() (keys, entries int) {
+	return index.inner.counts()
+}
+
+// IndexStats describes the coverage of an index.
+type IndexStats struct {
+	// Keys is the number of distinct index keys.
+	Keys int
+	// Covered is the number of values in the index.
+	Covered int
+	// Total is the number of values in the IndexMap.
+	Total int
+}
+
+// IndexStats returns the statistics of the named index,
+// it fails with ErrUnknownName unless that is a keyed index like
+// SecondaryIndex or PartialIndex.
+// Counting the covered values of other than partial indexes costs O(n).
+func (imap *IndexMap[K, V]) IndexStats(indexName string) (IndexStats, error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(keyedIndex[V])
+	if !ok {
+		return IndexStats{}, ErrUnknownName
+	}
+
+	stats := IndexStats{Total: len(imap.primaryIndex.inner)}
+	var covered Set[*V]
+	if partial, ok := index.(*PartialIndex[V]); ok {
+		stats.Covered = len(partial.covered)
+	} else {
+		covered = make(Set[*V])
+	}
+	index.iterate(func(_ any, elems bucket[V]) bool {
+		stats.Keys++
+		if covered != nil {
+			elems.addTo(covered)
+		}
+		return true
+	})
+	if covered != nil {
+		stats.Covered = len(covered)
+	}
+	return stats, nil
+}
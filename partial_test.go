@@ -0,0 +1,121 @@
+package indexmap
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const AdultCityIndex = "adult_city"
+
+func isAdult(value *Person) bool {
+	return value.Age >= 18
+}
+
+func addPartialIndex(imap *IndexMap[int64, Person]) {
+	imap.AddIndex(AdultCityIndex, NewPartialIndex(isAdult, func(value *Person) []any {
+		return []any{value.City}
+	}))
+}
+
+func checkPartialIndex(t *testing.T, imap *IndexMap[int64, Person]) {
+	adults := 0
+	for _, city := range cities {
+		var expected []*Person
+		for _, person := range imap.GetAllBy(CityIndex, city) {
+			if isAdult(person) {
+				expected = append(expected, person)
+			}
+		}
+		adults += len(expected)
+		assert.ElementsMatch(t, expected, imap.GetAllBy(AdultCityIndex, city), city)
+	}
+
+	stats, err := imap.IndexStats(AdultCityIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, adults, stats.Covered)
+	assert.Equal(t, imap.Len(), stats.Total)
+}
+
+func TestPartialIndex(t *testing.T) {
+	imap := CreateTestMap(1000)
+	addPartialIndex(imap)
+	checkPartialIndex(t, imap)
+
+	myRand := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		id := int64(myRand.Intn(1000))
+		switch myRand.Intn(3) {
+		case 0:
+			imap.Remove(id)
+		case 1:
+			// moves in and out of the index
+			imap.Update(id, func(value *Person) (*Person, bool) {
+				if value == nil {
+					return nil, false
+				}
+				value.Age = myRand.Intn(40)
+				return value, true
+			})
+		default:
+			InsertRandomDataFrom(imap, int(id), 1)
+		}
+	}
+	checkPartialIndex(t, imap)
+
+	imap.UpdateBy(AdultCityIndex, cities[0], func(value *Person) (*Person, bool) {
+		value.Age = 10
+		return value, true
+	})
+	assert.Empty(t, imap.GetAllBy(AdultCityIndex, cities[0]))
+	checkPartialIndex(t, imap)
+
+	imap.Clear()
+	stats, err := imap.IndexStats(AdultCityIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, IndexStats{}, stats)
+}
+
+func TestIndexStats(t *testing.T) {
+	imap := CreateTestMap(100)
+	addPartialIndex(imap)
+
+	stats, err := imap.IndexStats(CityIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, IndexStats{Keys: len(imap.indexes[CityIndex].(*SecondaryIndex[Person]).inner), Covered: 100, Total: 100}, stats)
+
+	imap.Insert(&Person{ID: 1000, Name: "Kid", Age: 5, City: "Nowhere"})
+	stats, err = imap.IndexStats(AdultCityIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, 101, stats.Total)
+	assert.Less(t, stats.Covered, stats.Total)
+	assert.Nil(t, imap.GetAllBy(AdultCityIndex, "Nowhere"))
+
+	_, err = imap.IndexStats("nothing")
+	assert.ErrorIs(t, err, ErrUnknownName)
+}
+
+func TestPartialIndex_NamedLikeField(t *testing.T) {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Person) int64 {
+		return value.ID
+	}), WithIndex("city", NewPartialIndex(func(value *Person) bool {
+		return value.Age >= 50
+	}, func(value *Person) []any {
+		return []any{value.City}
+	})))
+	imap.Insert(&Person{ID: 1, City: "Rome", Age: 20}, &Person{ID: 2, City: "Rome", Age: 30},
+		&Person{ID: 3, City: "Rome", Age: 60}, &Person{ID: 4, City: "Venice", Age: 70})
+
+	// the field is compared, the index doesn't hold all values
+	result, err := imap.Query(`city = "Rome"`)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	plan, err := imap.Explain(`city = "Rome"`)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "IndexLookup", plan.Op)
+	result, err = imap.Where("City", Eq, "Rome")
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	assert.Len(t, imap.GetAllBy("city", "Rome"), 1)
+}
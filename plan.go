@@ -0,0 +1,459 @@
+package indexmap
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// QueryPlan is a step of the plan of a query, see IndexMap.Explain.
+type QueryPlan struct {
+	// Op is the kind of the step:
+	//   - IndexLookup looks the keys of a condition up by the index
+	//   - IndexScan compares all keys of the index
+	//   - FullScan visits all values
+	//   - Union takes the values of any input, Intersect the values of all inputs
+	//   - Filter compares the fields of the values of the input
+	//   - Sort and Limit apply ORDER BY and LIMIT
+	Op string
+	// Detail is the condition, the index or the order of the step.
+	Detail string
+	// Cost is the estimated number of keys and values visited by the step and its inputs.
+	Cost int
+	// Estimated is the estimated number of values of the step,
+	// Actual the number of the run.
+	Estimated int
+	Actual    int
+	Inputs    []*QueryPlan
+}
+
+// String formats the plan as indented tree, one step per line.
+func (plan *QueryPlan) String() string {
+	var sb strings.Builder
+	plan.format(&sb, "")
+	return sb.String()
+}
+
+func (plan *QueryPlan) format(sb *strings.Builder, indent string) {
+	sb.WriteString(indent)
+	sb.WriteString(plan.Op)
+	if plan.Detail != "" {
+		sb.WriteString(" ")
+		sb.WriteString(plan.Detail)
+	}
+	fmt.Fprintf(sb, " (cost %d, estimated %d, actual %d)\n", plan.Cost, plan.Estimated, plan.Actual)
+	for _, input := range plan.Inputs {
+		input.format(sb, indent+"  ")
+	}
+}
+
+// Explain runs the query like Query, and returns the chosen plan
+// with the estimated and the actual number of values of every step.
+//
+// The planner estimates the values of conditions on indexes by their sizes,
+// IndexLookup by the exact sizes of the looked up keys, IndexScan by the number
+// of keys and values, or exactly for indexes with few keys,
+// and conditions on fields by fixed selectivities.
+// Conditions combined by AND are driven by the cheapest lookup,
+// or by a full scan if that's cheaper, the others filter its values,
+// the most selective first.
+func (imap *IndexMap[K, V]) Explain(query string) (*QueryPlan, error) {
+	parsed, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	compiled, err := compileQuery(imap, parsed)
+	if err != nil {
+		return nil, err
+	}
+	plan, _ := compiled.run()
+	return plan, nil
+}
+
+// queryStep is a planned step, run returns its values and sets plan.Actual.
+type queryStep[V any] struct {
+	plan *QueryPlan
+	// the estimated values and cost, as plan rounds them
+	estimated float64
+	cost      float64
+	run       func() Set[*V]
+}
+
+func newQueryStep[V any](op, detail string, estimated, cost float64, inputs []*queryStep[V], run func() Set[*V]) *queryStep[V] {
+	step := &queryStep[V]{
+		plan:      &QueryPlan{Op: op, Detail: detail, Estimated: int(math.Round(estimated)), Cost: int(math.Round(cost))},
+		estimated: estimated,
+		cost:      cost,
+	}
+	for _, input := range inputs {
+		step.plan.Inputs = append(step.plan.Inputs, input.plan)
+	}
+	step.run = func() Set[*V] {
+		values := run()
+		step.plan.Actual = len(values)
+		return values
+	}
+	return step
+}
+
+// queryPlanner plans the conditions of a query,
+// the caller holds the lock of the map.
+type queryPlanner[K comparable, V any] struct {
+	imap  *IndexMap[K, V]
+	total float64
+}
+
+// run plans and evaluates the query.
+func (query *compiledQuery[K, V]) run() (*QueryPlan, []*V) {
+	planner := queryPlanner[K, V]{imap: query.imap, total: float64(len(query.imap.primaryIndex.inner))}
+
+	var step *queryStep[V]
+	switch {
+	case query.where == nil:
+		step = planner.fullScan()
+	case query.where.op == queryAnd:
+		step = planner.conjunction(query.where.children, true)
+	default:
+		step = planner.conjunction([]*queryCond[V]{query.where}, true)
+	}
+	plan := step.plan
+	result := step.run().Collect()
+
+	if len(query.orderBy) > 0 {
+		slices.SortStableFunc(result, func(value1, value2 *V) int {
+			for _, compare := range query.orderBy {
+				if c := compare(value1, value2); c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+		n := float64(len(result))
+		plan = &QueryPlan{Op: "Sort", Detail: strings.Join(query.orderText, ", "),
+			Cost: plan.Cost + int(math.Round(n*math.Log2(n+1))), Estimated: plan.Estimated, Actual: len(result), Inputs: []*QueryPlan{plan}}
+	}
+
+	if query.limit >= 0 || query.offset > 0 {
+		detail := fmt.Sprintf("%d", query.limit)
+		estimated := max(plan.Estimated-query.offset, 0)
+		if query.limit >= 0 {
+			estimated = min(estimated, query.limit)
+		} else {
+			detail = "all"
+		}
+		if query.offset > 0 {
+			detail += fmt.Sprintf(" OFFSET %d", query.offset)
+		}
+		plan = &QueryPlan{Op: "Limit", Detail: detail, Cost: plan.Cost, Estimated: estimated, Inputs: []*QueryPlan{plan}}
+
+		if query.offset >= len(result) {
+			result = result[:0]
+		} else {
+			result = result[query.offset:]
+		}
+		if query.limit >= 0 && query.limit < len(result) {
+			result = result[:query.limit]
+		}
+		plan.Actual = len(result)
+	}
+	return plan, result
+}
+
+func (planner *queryPlanner[K, V]) fullScan() *queryStep[V] {
+	return newQueryStep("FullScan", "", planner.total, planner.total, nil, func() Set[*V] {
+		values := make(Set[*V], len(planner.imap.primaryIndex.inner))
+		for _, value := range planner.imap.primaryIndex.inner {
+			values.Insert(value)
+		}
+		return values
+	})
+}
+
+// maxCountedKeys is the number of keys of an index up to which the planner counts
+// the values matching a comparison exactly.
+const maxCountedKeys = 256
+
+// selectivity estimates the share of values matching a comparison on a field.
+func selectivity(compare string, literals int) float64 {
+	switch compare {
+	case "!=":
+		return 0.9
+	case "<", "<=", ">", ">=":
+		return 1.0 / 3
+	case "CONTAINS", "REGEX":
+		return 0.5
+	}
+	return min(0.1*float64(literals), 1)
+}
+
+// estimate returns the estimated number of values matching the condition.
+func (planner *queryPlanner[K, V]) estimate(cond *queryCond[V]) float64 {
+	switch cond.op {
+	case queryAnd:
+		estimated := planner.total
+		for _, child := range cond.children {
+			if planner.total > 0 {
+				estimated *= planner.estimate(child) / planner.total
+			}
+		}
+		return estimated
+	case queryOr:
+		estimated := 0.0
+		for _, child := range cond.children {
+			estimated += planner.estimate(child)
+		}
+		return min(estimated, planner.total)
+	case queryNot:
+		return planner.total - planner.estimate(cond.children[0])
+	}
+	if cond.index != nil {
+		estimated, _ := planner.indexCost(cond)
+		return estimated
+	}
+	return planner.total * selectivity(cond.compare, len(cond.literals))
+}
+
+// indexCost estimates the values and the cost of the lookup of a condition on an index.
+func (planner *queryPlanner[K, V]) indexCost(cond *queryCond[V]) (estimated, cost float64) {
+	if cond.isEqual() {
+		// the exact bucket sizes
+		keyType := sampleKeyType(cond.index)
+		for _, literal := range cond.literals {
+			if key, ok := convertKey(literal, keyType); ok {
+				estimated += float64(cond.index.get(key).len())
+			}
+		}
+		return estimated, float64(len(cond.literals)) + estimated
+	}
+
+	keys, entries := planner.total, planner.total
+	if counted, ok := cond.index.(countedIndex); ok {
+		k, e := counted.counts()
+		keys, entries = float64(k), float64(e)
+		if k <= maxCountedKeys {
+			// few keys, those are compared to count the values exactly
+			test := comparison(cond.compare)
+			cond.index.iterate(func(key any, elems bucket[V]) bool {
+				for _, literal := range cond.literals {
+					if c, ok := compareLiteral(reflect.ValueOf(key), literal); ok && test(c) {
+						estimated += float64(elems.len())
+						break
+					}
+				}
+				return true
+			})
+			return min(estimated, planner.total), keys + estimated
+		}
+	}
+	estimated = min(entries*selectivity(cond.compare, len(cond.literals)), planner.total)
+	return estimated, keys + estimated
+}
+
+// lookup plans the values of the condition by indexes,
+// nil if a condition on a field requires scanning the values.
+func (planner *queryPlanner[K, V]) lookup(cond *queryCond[V]) *queryStep[V] {
+	switch cond.op {
+	case queryAnd:
+		return planner.conjunction(cond.children, false)
+	case queryOr:
+		var inputs []*queryStep[V]
+		cost, estimated := 0.0, 0.0
+		for _, child := range cond.children {
+			input := planner.lookup(child)
+			if input == nil {
+				return nil
+			}
+			inputs = append(inputs, input)
+			cost += input.cost + input.estimated
+			estimated += input.estimated
+		}
+		return newQueryStep("Union", "", min(estimated, planner.total), cost, inputs, func() Set[*V] {
+			values := make(Set[*V])
+			for _, input := range inputs {
+				addAll(values, input.run())
+			}
+			return values
+		})
+	case queryNot:
+		return nil
+	}
+	if cond.index == nil {
+		return nil
+	}
+
+	op := "IndexScan"
+	if cond.isEqual() {
+		op = "IndexLookup"
+	}
+	estimated, cost := planner.indexCost(cond)
+	return newQueryStep(op, cond.text, estimated, cost, nil, cond.lookupSet)
+}
+
+// conjunction plans the conditions combined by AND. The values are taken from the
+// cheapest lookup, or from a full scan if that's cheaper or there is no lookup and scan is set.
+// The other conditions on indexes without field intersect the values, the rest filters them.
+// It returns nil if there is no lookup, unless scan is set.
+func (planner *queryPlanner[K, V]) conjunction(conds []*queryCond[V], scan bool) *queryStep[V] {
+	// conditions on indexes without field are looked up by every plan
+	isMember := func(i int) bool {
+		return conds[i].index != nil && conds[i].match == nil
+	}
+	lookups := make([]*queryStep[V], len(conds))
+	memberCost := 0.0
+	for i, cond := range conds {
+		if lookups[i] = planner.lookup(cond); lookups[i] != nil && isMember(i) {
+			memberCost += lookups[i].cost
+		}
+	}
+
+	driver := -1
+	var driverCost float64
+	for i := range conds {
+		if lookups[i] == nil {
+			continue
+		}
+		cost := lookups[i].cost + lookups[i].estimated*float64(len(conds)-1) + memberCost
+		if isMember(i) {
+			cost -= lookups[i].cost
+		}
+		if driver < 0 || cost < driverCost {
+			driver, driverCost = i, cost
+		}
+	}
+
+	var source *queryStep[V]
+	scanCost := planner.total*float64(len(conds)) + memberCost
+	switch {
+	case driver >= 0 && (!scan || driverCost <= scanCost):
+		source = lookups[driver]
+	case scan:
+		source, driver = planner.fullScan(), -1
+	default:
+		return nil
+	}
+
+	var members []*queryStep[V]
+	var filters []*queryCond[V]
+	for i, cond := range conds {
+		switch {
+		case i == driver:
+		case isMember(i):
+			members = append(members, lookups[i])
+		default:
+			filters = append(filters, cond)
+		}
+	}
+
+	step := source
+	if len(members) > 0 {
+		slices.SortFunc(members, func(member1, member2 *queryStep[V]) int {
+			return cmp.Compare(member1.estimated, member2.estimated)
+		})
+		input := step
+		inputs := append([]*queryStep[V]{input}, members...)
+		estimated, cost := input.estimated, input.cost
+		for _, member := range members {
+			if planner.total > 0 {
+				estimated *= member.estimated / planner.total
+			}
+			cost += member.cost + input.estimated
+		}
+		step = newQueryStep("Intersect", "", estimated, cost, inputs, func() Set[*V] {
+			values := input.run()
+			sets := make([]Set[*V], len(members))
+			for i, member := range members {
+				sets[i] = member.run()
+			}
+			result := make(Set[*V])
+		values:
+			for value := range values {
+				for _, set := range sets {
+					if !set.Contain(value) {
+						continue values
+					}
+				}
+				result.Insert(value)
+			}
+			return result
+		})
+	}
+
+	if len(filters) > 0 {
+		estimates := make(map[*queryCond[V]]float64, len(filters))
+		for _, filter := range filters {
+			estimates[filter] = planner.estimate(filter)
+		}
+		// the most selective first, to reject values early
+		slices.SortStableFunc(filters, func(filter1, filter2 *queryCond[V]) int {
+			return cmp.Compare(estimates[filter1], estimates[filter2])
+		})
+		texts := make([]string, len(filters))
+		input := step
+		estimated := input.estimated
+		for i, filter := range filters {
+			texts[i] = filter.text
+			if planner.total > 0 {
+				estimated *= estimates[filter] / planner.total
+			}
+		}
+		step = newQueryStep("Filter", strings.Join(texts, " AND "), estimated, input.cost+input.estimated*float64(len(filters)), []*queryStep[V]{input}, func() Set[*V] {
+			result := make(Set[*V])
+		values:
+			for value := range input.run() {
+				for _, filter := range filters {
+					if !filter.matches(value) {
+						continue values
+					}
+				}
+				result.Insert(value)
+			}
+			return result
+		})
+	}
+	return step
+}
+
+func (cond *queryCond[V]) isEqual() bool {
+	return cond.op == queryIn || cond.compare == "="
+}
+
+// lookupSet returns the values matching the condition on an index, it's looked up once.
+func (cond *queryCond[V]) lookupSet() Set[*V] {
+	if cond.looked == nil {
+		cond.looked = lookupKeys(cond.index, cond.literals, comparison(cond.compare), cond.isEqual())
+	}
+	return cond.looked
+}
+
+// matches reports whether the value matches the condition.
+func (cond *queryCond[V]) matches(value *V) bool {
+	switch cond.op {
+	case queryAnd:
+		for _, child := range cond.children {
+			if !child.matches(value) {
+				return false
+			}
+		}
+		return true
+	case queryOr:
+		for _, child := range cond.children {
+			if child.matches(value) {
+				return true
+			}
+		}
+		return false
+	case queryNot:
+		return !cond.children[0].matches(value)
+	}
+	if cond.match != nil {
+		return cond.match(value)
+	}
+	return cond.lookupSet().Contain(value)
+}
@@ -0,0 +1,106 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createPlanTestMap() *IndexMap[int64, Person] {
+	imap := CreateTestMap(1000)
+	imap.AddIndex("age", NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Age}
+	}))
+	imap.AddIndex("id", NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.ID}
+	}))
+	// not named like a field, so it's evaluated by lookups only
+	imap.AddIndex("first_like", NewSecondaryIndex(func(value *Person) []any {
+		if len(value.Like) == 0 {
+			return nil
+		}
+		return []any{value.Like[0]}
+	}))
+	imap.AddIndex("town", NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.City}
+	}))
+	return imap
+}
+
+func explain(t *testing.T, imap *IndexMap[int64, Person], query string) *QueryPlan {
+	plan, err := imap.Explain(query)
+	assert.NoError(t, err, query)
+	result, err := imap.Query(query)
+	assert.NoError(t, err, query)
+	assert.Equal(t, len(result), plan.Actual, query)
+	return plan
+}
+
+func TestIndexMap_Explain(t *testing.T) {
+	imap := createPlanTestMap()
+	city := imap.Get(1).City
+	inCity := len(imap.GetAllBy(CityIndex, city))
+
+	// the small bucket drives, the field of the index age filters
+	plan := explain(t, imap, `age >= 30 AND city = "`+city+`"`)
+	assert.Equal(t, "Filter", plan.Op)
+	assert.Equal(t, "age >= 30", plan.Detail)
+	assert.Equal(t, "IndexLookup", plan.Inputs[0].Op)
+	assert.Equal(t, `city = "`+city+`"`, plan.Inputs[0].Detail)
+	assert.Equal(t, inCity, plan.Inputs[0].Estimated)
+	assert.Equal(t, inCity, plan.Inputs[0].Actual)
+
+	// few keys, the index is cheaper than a scan
+	plan = explain(t, imap, `age >= 30`)
+	assert.Equal(t, "IndexScan", plan.Op)
+	// unique keys, the scan is cheaper than comparing all keys
+	plan = explain(t, imap, `id >= 30`)
+	assert.Equal(t, "Filter", plan.Op)
+	assert.Equal(t, "FullScan", plan.Inputs[0].Op)
+	assert.Equal(t, 1000, plan.Inputs[0].Actual)
+
+	// conditions on indexes without fields intersect
+	plan = explain(t, imap, `first_like = "Mary" AND town IN ("`+city+`", "`+cities[0]+`")`)
+	assert.Equal(t, "Intersect", plan.Op)
+	assert.Equal(t, "IndexLookup", plan.Inputs[0].Op)
+	assert.Equal(t, "IndexLookup", plan.Inputs[1].Op)
+	assert.Less(t, plan.Inputs[0].Estimated, plan.Inputs[1].Estimated)
+
+	// the most selective filter first
+	plan = explain(t, imap, `ID != 5 AND like = "Mary" AND NOT name = "James"`)
+	assert.Equal(t, "Filter", plan.Op)
+	assert.Equal(t, `like = "Mary" AND ID != 5 AND NOT name = "James"`, plan.Detail)
+	assert.Equal(t, "FullScan", plan.Inputs[0].Op)
+
+	plan = explain(t, imap, `city = "`+city+`" OR (first_like = "Mary" AND age < 30)`)
+	assert.Equal(t, "Union", plan.Op)
+	assert.Equal(t, "IndexLookup", plan.Inputs[0].Op)
+	assert.Equal(t, "Filter", plan.Inputs[1].Op)
+	assert.Equal(t, "IndexLookup", plan.Inputs[1].Inputs[0].Op)
+
+	plan = explain(t, imap, `city = "`+city+`" OR like = "Mary"`)
+	assert.Equal(t, "Filter", plan.Op)
+	assert.Equal(t, "FullScan", plan.Inputs[0].Op)
+
+	plan = explain(t, imap, `city = "`+city+`" ORDER BY name DESC LIMIT 2 OFFSET 1`)
+	assert.Equal(t, "Limit", plan.Op)
+	assert.Equal(t, "2 OFFSET 1", plan.Detail)
+	assert.Equal(t, min(2, inCity-1), plan.Actual)
+	assert.Equal(t, "Sort", plan.Inputs[0].Op)
+	assert.Equal(t, "name DESC", plan.Inputs[0].Detail)
+	assert.Equal(t, inCity, plan.Inputs[0].Actual)
+
+	_, err := imap.Explain(`city =`)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestQueryPlan_String(t *testing.T) {
+	imap := CreateTestMap(0)
+	imap.Insert(&Person{ID: 1, Name: "Ashe", Age: 38}, &Person{ID: 2, Name: "Bob", Age: 18})
+
+	plan := explain(t, imap, `name = "Ashe" AND age > 20 LIMIT 1`)
+	assert.Equal(t, `Limit 1 (cost 3, estimated 0, actual 1)
+  Filter age > 20 (cost 3, estimated 0, actual 1)
+    IndexLookup name = "Ashe" (cost 2, estimated 1, actual 1)
+`, plan.String())
+}
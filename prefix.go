@@ -0,0 +1,298 @@
+package indexmap
+
+import (
+	"slices"
+	"strings"
+)
+
+// PrefixIndex is a secondary index of string keys stored in a radix tree,
+// so beside seeking by key it finds values by key prefix
+// without scanning all keys, i.e. for autocompletion or routing tables.
+// Keys are compared byte wise, lowercase them in the extractField func
+// for case insensitive lookups.
+type PrefixIndex[V any] struct {
+	extractField func(value *V) []string
+
+	root *radixNode[V]
+}
+
+type radixNode[V any] struct {
+	// the part of the key between the parent and this node
+	prefix   string
+	children []*radixNode[V] // ordered by the first byte of their prefix
+	values   Set[*V]         // nil if no key ends here
+	// the number of values of this node and all nodes below
+	count int
+}
+
+// Create a prefix index,
+// the extractField func returns the keys for seeking the value,
+// It's OK that the same key seeks more than one values.
+func NewPrefixIndex[V any](extractField func(value *V) []string) *PrefixIndex[V] {
+	return &PrefixIndex[V]{
+		extractField: extractField,
+		root:         &radixNode[V]{},
+	}
+}
+
+func (index *PrefixIndex[V]) insert(elem *V) {
+	for _, key := range index.extractField(elem) {
+		index.root.insert(key, elem)
+	}
+}
+
+func (index *PrefixIndex[V]) remove(elem *V) {
+	for _, key := range index.extractField(elem) {
+		index.root.remove(key, elem)
+	}
+}
+
+func (index *PrefixIndex[V]) clear() {
+	index.root = &radixNode[V]{}
+}
+
+func (index *PrefixIndex[V]) get(key any) bucket[V] {
+	s, ok := key.(string)
+	if !ok {
+		return bucket[V]{}
+	}
+	node, path := index.root.find(s)
+	if node == nil || path != s {
+		return bucket[V]{}
+	}
+	return setBucket(node.values)
+}
+
+func (index *PrefixIndex[V]) iterate(fn func(key any, elems bucket[V]) bool) {
+	index.root.walk("", func(key string, elems Set[*V]) bool {
+		return fn(key, setBucket(elems))
+	})
+}
+
+// child returns the position of the child starting with b,
+// and whether it exists.
+func (node *radixNode[V]) child(b byte) (int, bool) {
+	return slices.BinarySearchFunc(node.children, b, func(child *radixNode[V], b byte) int {
+		return int(child.prefix[0]) - int(b)
+	})
+}
+
+func (node *radixNode[V]) insert(key string, value *V) bool {
+	if key == "" {
+		if node.values == nil {
+			node.values = make(Set[*V])
+		}
+		if node.values.Contain(value) {
+			return false
+		}
+		node.values.Insert(value)
+		node.count++
+		return true
+	}
+
+	i, found := node.child(key[0])
+	if !found {
+		leaf := &radixNode[V]{prefix: key, values: Set[*V]{value: {}}, count: 1}
+		node.children = slices.Insert(node.children, i, leaf)
+		node.count++
+		return true
+	}
+
+	child := node.children[i]
+	common := commonPrefixLen(key, child.prefix)
+	if common < len(child.prefix) {
+		split := &radixNode[V]{prefix: child.prefix[:common], children: []*radixNode[V]{child}, count: child.count}
+		child.prefix = child.prefix[common:]
+		node.children[i] = split
+		child = split
+	}
+	if !child.insert(key[common:], value) {
+		return false
+	}
+	node.count++
+	return true
+}
+
+func (node *radixNode[V]) remove(key string, value *V) bool {
+	if key == "" {
+		if !node.values.Contain(value) {
+			return false
+		}
+		node.values.Remove(value)
+		if len(node.values) == 0 {
+			node.values = nil
+		}
+		node.count--
+		return true
+	}
+
+	i, found := node.child(key[0])
+	if !found {
+		return false
+	}
+	child := node.children[i]
+	rest, ok := strings.CutPrefix(key, child.prefix)
+	if !ok || !child.remove(rest, value) {
+		return false
+	}
+	node.count--
+
+	switch {
+	case child.count == 0:
+		node.children = slices.Delete(node.children, i, i+1)
+	case child.values == nil && len(child.children) == 1:
+		// merge the child into its only child
+		grandchild := child.children[0]
+		grandchild.prefix = child.prefix + grandchild.prefix
+		node.children[i] = grandchild
+	}
+	return true
+}
+
+// find returns the topmost node with all keys starting with prefix,
+// and the key of that node, nil if there is no such key.
+func (node *radixNode[V]) find(prefix string) (*radixNode[V], string) {
+	path := ""
+	for {
+		if prefix == "" {
+			return node, path
+		}
+		i, found := node.child(prefix[0])
+		if !found {
+			return nil, ""
+		}
+		child := node.children[i]
+		if strings.HasPrefix(child.prefix, prefix) {
+			return child, path + child.prefix
+		}
+		rest, ok := strings.CutPrefix(prefix, child.prefix)
+		if !ok {
+			return nil, ""
+		}
+		path += child.prefix
+		prefix = rest
+		node = child
+	}
+}
+
+// walk calls fn for all keys below the node in ascending order,
+// stops if fn returns false.
+func (node *radixNode[V]) walk(path string, fn func(key string, values Set[*V]) bool) bool {
+	if node.values != nil && !fn(path, node.values) {
+		return false
+	}
+	for _, child := range node.children {
+		if !child.walk(path+child.prefix, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefixLen(s1, s2 string) int {
+	n := min(len(s1), len(s2))
+	for i := 0; i < n; i++ {
+		if s1[i] != s2[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// GetByPrefix returns the values of the named PrefixIndex with a key starting with prefix,
+// every value once even if several of its keys match,
+// nil if the index doesn't exist or nothing matches.
+func (imap *IndexMap[K, V]) GetByPrefix(indexName string, prefix string) []*V {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*PrefixIndex[V])
+	if !ok {
+		return nil
+	}
+	node, path := index.root.find(prefix)
+	if node == nil {
+		return nil
+	}
+
+	values := make(Set[*V], node.count)
+	node.walk(path, func(_ string, elems Set[*V]) bool {
+		for elem := range elems {
+			values.Insert(elem)
+		}
+		return true
+	})
+	return values.Collect()
+}
+
+// CountByPrefix returns the number of values of the named PrefixIndex with a key starting with prefix,
+// in O(len(prefix)). A value with several matching keys counts once per key.
+func (imap *IndexMap[K, V]) CountByPrefix(indexName string, prefix string) int {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*PrefixIndex[V])
+	if !ok {
+		return 0
+	}
+	node, _ := index.root.find(prefix)
+	if node == nil {
+		return 0
+	}
+	return node.count
+}
+
+// RangePrefix iterates over the keys of the named PrefixIndex starting with prefix
+// in ascending order, stops iteration if fn returns false.
+// fn must not attempt modifying the IndexMap, or else it will deadlock
+func (imap *IndexMap[K, V]) RangePrefix(indexName string, prefix string, fn func(key string, values []*V) bool) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*PrefixIndex[V])
+	if !ok {
+		return
+	}
+	node, path := index.root.find(prefix)
+	if node == nil {
+		return
+	}
+	node.walk(path, func(key string, values Set[*V]) bool {
+		return fn(key, values.Collect())
+	})
+}
+
+// LongestPrefixMatch returns the longest key of the named PrefixIndex that s starts with,
+// together with its values, like a routing table lookup.
+// ok is false if there is no such key.
+func (imap *IndexMap[K, V]) LongestPrefixMatch(indexName string, s string) (key string, values []*V, ok bool) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, isPrefix := imap.indexes[indexName].(*PrefixIndex[V])
+	if !isPrefix {
+		return "", nil, false
+	}
+
+	node, path := index.root, ""
+	var match Set[*V]
+	for {
+		if node.values != nil {
+			key, match = path, node.values
+		}
+		if len(s) == len(path) {
+			break
+		}
+		i, found := node.child(s[len(path)])
+		if !found || !strings.HasPrefix(s[len(path):], node.children[i].prefix) {
+			break
+		}
+		node = node.children[i]
+		path += node.prefix
+	}
+
+	if match == nil {
+		return "", nil, false
+	}
+	return key, match.Collect(), true
+}
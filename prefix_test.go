@@ -0,0 +1,149 @@
+package indexmap
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const PrefixIndexName = "prefix"
+
+func addPrefixIndex(imap *IndexMap[int64, Person]) {
+	imap.AddIndex(PrefixIndexName, NewPrefixIndex(func(value *Person) []string {
+		return []string{value.Name}
+	}))
+}
+
+func TestPrefixIndex(t *testing.T) {
+	imap := CreateTestMap(1000)
+	addPrefixIndex(imap)
+
+	for _, prefix := range []string{"", "J", "Ja", "Jam", "James", "Jamesx", "Ca", "x"} {
+		var expected []*Person
+		imap.Range(func(key int64, value *Person) bool {
+			if strings.HasPrefix(value.Name, prefix) {
+				expected = append(expected, value)
+			}
+			return true
+		})
+		assert.ElementsMatch(t, expected, imap.GetByPrefix(PrefixIndexName, prefix), prefix)
+		assert.Equal(t, len(expected), imap.CountByPrefix(PrefixIndexName, prefix), prefix)
+	}
+
+	// exact keys
+	james := imap.GetAllBy(PrefixIndexName, "James")
+	assert.NotEmpty(t, james)
+	assert.ElementsMatch(t, imap.GetAllBy(NameIndex, "James"), james)
+	assert.Nil(t, imap.GetAllBy(PrefixIndexName, "Jam"))
+
+	// keys are iterated in order
+	var keys []string
+	imap.RangePrefix(PrefixIndexName, "", func(key string, values []*Person) bool {
+		keys = append(keys, key)
+		assert.ElementsMatch(t, imap.GetAllBy(NameIndex, key), values)
+		return true
+	})
+	assert.True(t, slices.IsSorted(keys))
+	assert.Equal(t, len(imap.indexes[NameIndex].(*SecondaryIndex[Person]).inner), len(keys))
+
+	keys = keys[:0]
+	imap.RangePrefix(PrefixIndexName, "Ma", func(key string, values []*Person) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	assert.Equal(t, []string{"Madison", "Margaret", "Maria"}, keys)
+
+	// Update and remove
+	myRand := rand.New(rand.NewSource(1))
+	for i := range 500 {
+		imap.Update(int64(i), func(value *Person) (*Person, bool) {
+			value.Name = names[myRand.Intn(len(names))] + "x"
+			return value, true
+		})
+	}
+	for i := 500; i < 1000; i += 2 {
+		imap.Remove(int64(i))
+	}
+	assert.Equal(t, 750, imap.CountByPrefix(PrefixIndexName, ""))
+	assert.Equal(t, imap.Len(), len(imap.GetByPrefix(PrefixIndexName, "")))
+	imap.Range(func(key int64, value *Person) bool {
+		assert.Contains(t, imap.GetAllBy(PrefixIndexName, value.Name), value)
+		return true
+	})
+
+	imap.Clear()
+	assert.Zero(t, imap.CountByPrefix(PrefixIndexName, ""))
+	assert.Nil(t, imap.GetByPrefix(InvalidIndex, ""))
+	assert.Zero(t, imap.CountByPrefix(InvalidIndex, ""))
+}
+
+type Route struct {
+	Prefix  string
+	Gateway string
+}
+
+func TestPrefixIndex_LongestPrefixMatch(t *testing.T) {
+	routes := NewIndexMap(NewPrimaryIndex(func(value *Route) string {
+		return value.Prefix
+	}))
+	routes.AddIndex(PrefixIndexName, NewPrefixIndex(func(value *Route) []string {
+		return []string{value.Prefix}
+	}))
+	routes.Insert(
+		&Route{"10.", "a"},
+		&Route{"10.1.", "b"},
+		&Route{"10.1.2.", "c"},
+		&Route{"192.168.", "d"},
+	)
+
+	for address, expected := range map[string]string{
+		"10.1.2.3":    "10.1.2.",
+		"10.1.3.4":    "10.1.",
+		"10.2.3.4":    "10.",
+		"10.1.":       "10.1.",
+		"192.168.1.1": "192.168.",
+	} {
+		key, values, ok := routes.LongestPrefixMatch(PrefixIndexName, address)
+		assert.True(t, ok, address)
+		assert.Equal(t, expected, key, address)
+		assert.Equal(t, expected, values[0].Prefix, address)
+	}
+
+	_, _, ok := routes.LongestPrefixMatch(PrefixIndexName, "172.16.0.1")
+	assert.False(t, ok)
+	_, _, ok = routes.LongestPrefixMatch(PrefixIndexName, "1")
+	assert.False(t, ok)
+	_, _, ok = routes.LongestPrefixMatch(InvalidIndex, "10.1.2.3")
+	assert.False(t, ok)
+
+	routes.Remove("10.1.")
+	key, _, _ := routes.LongestPrefixMatch(PrefixIndexName, "10.1.3.4")
+	assert.Equal(t, "10.", key)
+	key, _, _ = routes.LongestPrefixMatch(PrefixIndexName, "10.1.2.3")
+	assert.Equal(t, "10.1.2.", key)
+}
+
+func TestRadixNode(t *testing.T) {
+	root := &radixNode[Person]{}
+	p1, p2 := &Person{ID: 1}, &Person{ID: 2}
+	assert.True(t, root.insert("romane", p1))
+	assert.True(t, root.insert("romanus", p1))
+	assert.True(t, root.insert("romulus", p2))
+	assert.True(t, root.insert("rom", p2))
+	assert.False(t, root.insert("rom", p2))
+	assert.Equal(t, 4, root.count)
+
+	assert.False(t, root.remove("roma", p1))
+	assert.False(t, root.remove("romane", p2))
+	assert.True(t, root.remove("rom", p2))
+	assert.True(t, root.remove("romulus", p2))
+	assert.Equal(t, 2, root.count)
+
+	// the tree is compacted again
+	assert.Equal(t, 1, len(root.children))
+	assert.Equal(t, "roman", root.children[0].prefix)
+	assert.Equal(t, 2, len(root.children[0].children))
+}
@@ -0,0 +1,719 @@
+package indexmap
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query returns the values matching a query like
+//
+//	city = "Shanghai" AND age >= 30 ORDER BY name DESC LIMIT 10 OFFSET 20
+//
+// The syntax is:
+//
+//	query      = [condition] ["ORDER BY" order {"," order}] ["LIMIT" number ["OFFSET" number]]
+//	condition  = and {"OR" and}
+//	and        = not {"AND" not}
+//	not        = "NOT" not | "(" condition ")" | comparison
+//	comparison = identifier ("=" | "!=" | "<" | "<=" | ">" | ">=") literal
+//	           | identifier ["NOT"] "IN" "(" literal {"," literal} ")"
+//	order      = identifier ["ASC" | "DESC"]
+//	literal    = "string" | number | true | false | null
+//
+// Keywords are case-insensitive, identifiers with other characters than letters, digits,
+// '_' and '.' are quoted by backticks like `first-name`.
+//
+// An identifier names a keyed index like SecondaryIndex, it compares the keys of the index then,
+// and the values are looked up by the index. Otherwise it names an exported field
+// of the values, matched case-insensitively, nested fields are separated by dots like address.city.
+// Those are compared by scanning the values, so conditions on indexes are much faster.
+// An index named like a field is expected to index that field, the planner chooses between
+// looking the values up by the index and comparing the field then, see Explain.
+// Slices match if any element matches, null matches nil pointers.
+// Strings compare to time.Time fields in the formats time.RFC3339, time.DateTime and time.DateOnly.
+//
+// ORDER BY takes orderings by name, or fields. Without it the order is undefined.
+//
+// Errors of the syntax and unknown identifiers are reported with ErrInvalidQuery
+// and the position in the query.
+func (imap *IndexMap[K, V]) Query(query string) ([]*V, error) {
+	parsed, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	compiled, err := compileQuery(imap, parsed)
+	if err != nil {
+		return nil, err
+	}
+	_, result := compiled.run()
+	return result, nil
+}
+
+type queryOp int
+
+const (
+	queryAnd queryOp = iota + 1
+	queryOr
+	queryNot
+	queryCompare
+	queryIn
+)
+
+// queryExpr is the syntax tree of a condition.
+type queryExpr struct {
+	op       queryOp
+	children []*queryExpr
+	// the position in the query, for errors
+	pos int
+	// the source of the condition, for Explain
+	text string
+
+	// comparisons only
+	ident    string
+	compare  string
+	literals []any
+}
+
+type queryOrder struct {
+	ident string
+	desc  bool
+	pos   int
+}
+
+func (order queryOrder) String() string {
+	if order.desc {
+		return order.ident + " DESC"
+	}
+	return order.ident
+}
+
+type parsedQuery struct {
+	where   *queryExpr
+	orderBy []queryOrder
+	limit   int
+	offset  int
+}
+
+// parseQuery parses the query syntax described at IndexMap.Query.
+func parseQuery(query string) (*parsedQuery, error) {
+	parser := queryParser{input: []rune(query)}
+	if err := parser.next(); err != nil {
+		return nil, err
+	}
+
+	parsed := &parsedQuery{limit: -1}
+	var err error
+	if !parser.isKeyword("ORDER") && !parser.isKeyword("LIMIT") && parser.token.kind != tokenEnd {
+		if parsed.where, err = parser.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+	if parser.isKeyword("ORDER") {
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		if err := parser.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			if parser.token.kind != tokenIdent {
+				return nil, parser.errorf("expected identifier to order by, got %s", parser.token)
+			}
+			order := queryOrder{ident: parser.token.text, pos: parser.token.pos}
+			if err := parser.next(); err != nil {
+				return nil, err
+			}
+			if parser.isKeyword("DESC") || parser.isKeyword("ASC") {
+				order.desc = parser.isKeyword("DESC")
+				if err := parser.next(); err != nil {
+					return nil, err
+				}
+			}
+			parsed.orderBy = append(parsed.orderBy, order)
+			if parser.token.kind != tokenComma {
+				break
+			}
+			if err := parser.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if parser.isKeyword("LIMIT") {
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		if parsed.limit, err = parser.parseCount("LIMIT"); err != nil {
+			return nil, err
+		}
+		if parser.isKeyword("OFFSET") {
+			if err := parser.next(); err != nil {
+				return nil, err
+			}
+			if parsed.offset, err = parser.parseCount("OFFSET"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if parser.token.kind != tokenEnd {
+		return nil, parser.errorf("unexpected %s", parser.token)
+	}
+	return parsed, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+	// quoted identifiers aren't keywords
+	quoted bool
+}
+
+func (token queryToken) String() string {
+	switch token.kind {
+	case tokenEnd:
+		return "end of query"
+	case tokenString:
+		return token.text
+	}
+	return strconv.Quote(token.text)
+}
+
+type queryParser struct {
+	input []rune
+	pos   int
+	token queryToken
+	// the end of the previous token
+	end int
+}
+
+func (parser *queryParser) errorf(format string, args ...any) error {
+	return parser.errorAt(parser.token.pos, format, args...)
+}
+
+func (parser *queryParser) errorAt(pos int, format string, args ...any) error {
+	return fmt.Errorf("%w: query at %d: %s", ErrInvalidQuery, pos, fmt.Sprintf(format, args...))
+}
+
+// next scans the next token.
+func (parser *queryParser) next() error {
+	parser.end = parser.pos
+	for parser.pos < len(parser.input) && unicode.IsSpace(parser.input[parser.pos]) {
+		parser.pos++
+	}
+	start := parser.pos
+	parser.token = queryToken{pos: start}
+	if start == len(parser.input) {
+		return nil
+	}
+
+	r := parser.input[start]
+	parser.pos++
+	switch {
+	case r == '(':
+		parser.token.kind = tokenLParen
+	case r == ')':
+		parser.token.kind = tokenRParen
+	case r == ',':
+		parser.token.kind = tokenComma
+	case r == '=' || r == '<' || r == '>' || r == '!':
+		if parser.pos < len(parser.input) && parser.input[parser.pos] == '=' {
+			parser.pos++
+		} else if r == '!' {
+			return parser.errorAt(start, "expected \"!=\"")
+		}
+		parser.token.kind = tokenOperator
+	case r == '"':
+		for escaped := false; ; parser.pos++ {
+			if parser.pos == len(parser.input) {
+				return parser.errorAt(start, "unterminated string")
+			}
+			c := parser.input[parser.pos]
+			if c == '"' && !escaped {
+				parser.pos++
+				break
+			}
+			escaped = c == '\\' && !escaped
+		}
+		parser.token.kind = tokenString
+	case r == '`':
+		end := slices.Index(parser.input[parser.pos:], '`')
+		if end < 0 {
+			return parser.errorAt(start, "unterminated identifier")
+		}
+		parser.token = queryToken{kind: tokenIdent, text: string(parser.input[parser.pos : parser.pos+end]), pos: start, quoted: true}
+		parser.pos += end + 1
+		return nil
+	case r == '-' || r == '.' || unicode.IsDigit(r):
+		for parser.pos < len(parser.input) && isNumberRune(parser.input[parser.pos-1], parser.input[parser.pos]) {
+			parser.pos++
+		}
+		parser.token.kind = tokenNumber
+	case r == '_' || unicode.IsLetter(r):
+		for parser.pos < len(parser.input) && isIdentRune(parser.input[parser.pos]) {
+			parser.pos++
+		}
+		parser.token.kind = tokenIdent
+	default:
+		return parser.errorAt(start, "unexpected %q", r)
+	}
+	parser.token.text = string(parser.input[start:parser.pos])
+	return nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isNumberRune(previous, r rune) bool {
+	return r == '.' || r == 'e' || r == 'E' || unicode.IsDigit(r) ||
+		(r == '-' || r == '+') && (previous == 'e' || previous == 'E')
+}
+
+func (parser *queryParser) isKeyword(keyword string) bool {
+	return parser.token.kind == tokenIdent && !parser.token.quoted && strings.EqualFold(parser.token.text, keyword)
+}
+
+func (parser *queryParser) expectKeyword(keyword string) error {
+	if !parser.isKeyword(keyword) {
+		return parser.errorf("expected %s, got %s", keyword, parser.token)
+	}
+	return parser.next()
+}
+
+func (parser *queryParser) parseCount(keyword string) (int, error) {
+	if parser.token.kind != tokenNumber {
+		return 0, parser.errorf("expected number after %s, got %s", keyword, parser.token)
+	}
+	n, err := strconv.Atoi(parser.token.text)
+	if err != nil || n < 0 {
+		return 0, parser.errorf("%s %s isn't a count", keyword, parser.token.text)
+	}
+	return n, parser.next()
+}
+
+// textFrom returns the query from pos to the end of the previous token.
+func (parser *queryParser) textFrom(pos int) string {
+	return string(parser.input[pos:parser.end])
+}
+
+func (parser *queryParser) parseOr() (*queryExpr, error) {
+	return parser.parseChain("OR", queryOr, parser.parseAnd)
+}
+
+func (parser *queryParser) parseAnd() (*queryExpr, error) {
+	return parser.parseChain("AND", queryAnd, parser.parseNot)
+}
+
+// parseChain parses operands separated by the keyword.
+func (parser *queryParser) parseChain(keyword string, op queryOp, parseOperand func() (*queryExpr, error)) (*queryExpr, error) {
+	pos := parser.token.pos
+	expr, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	children := []*queryExpr{expr}
+	for parser.isKeyword(keyword) {
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		expr, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, expr)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &queryExpr{op: op, children: children, pos: pos, text: parser.textFrom(pos)}, nil
+}
+
+func (parser *queryParser) parseNot() (*queryExpr, error) {
+	pos := parser.token.pos
+	switch {
+	case parser.isKeyword("NOT"):
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		expr, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &queryExpr{op: queryNot, children: []*queryExpr{expr}, pos: pos, text: parser.textFrom(pos)}, nil
+	case parser.token.kind == tokenLParen:
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		expr, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if parser.token.kind != tokenRParen {
+			return nil, parser.errorf("expected \")\" to close \"(\" at %d, got %s", pos, parser.token)
+		}
+		return expr, parser.next()
+	}
+	return parser.parseComparison()
+}
+
+func (parser *queryParser) parseComparison() (*queryExpr, error) {
+	if parser.token.kind != tokenIdent || parser.isKeyword("AND") || parser.isKeyword("OR") {
+		return nil, parser.errorf("expected condition, got %s", parser.token)
+	}
+	expr := &queryExpr{op: queryCompare, ident: parser.token.text, pos: parser.token.pos}
+	if err := parser.next(); err != nil {
+		return nil, err
+	}
+
+	not := parser.isKeyword("NOT")
+	if not {
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+	}
+	if parser.isKeyword("IN") {
+		expr.op = queryIn
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		if parser.token.kind != tokenLParen {
+			return nil, parser.errorf("expected \"(\" after IN, got %s", parser.token)
+		}
+		for {
+			if err := parser.next(); err != nil {
+				return nil, err
+			}
+			literal, err := parser.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			expr.literals = append(expr.literals, literal)
+			if parser.token.kind == tokenRParen {
+				break
+			}
+			if parser.token.kind != tokenComma {
+				return nil, parser.errorf("expected \",\" or \")\" in IN list, got %s", parser.token)
+			}
+		}
+		if err := parser.next(); err != nil {
+			return nil, err
+		}
+		expr.text = parser.textFrom(expr.pos)
+		if not {
+			return &queryExpr{op: queryNot, children: []*queryExpr{expr}, pos: expr.pos, text: expr.text}, nil
+		}
+		return expr, nil
+	}
+	if not {
+		return nil, parser.errorf("expected IN after NOT, got %s", parser.token)
+	}
+
+	if parser.token.kind != tokenOperator {
+		return nil, parser.errorf("expected comparison operator after %s, got %s", strconv.Quote(expr.ident), parser.token)
+	}
+	expr.compare = parser.token.text
+	if err := parser.next(); err != nil {
+		return nil, err
+	}
+	literal, err := parser.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	expr.literals = []any{literal}
+	expr.text = parser.textFrom(expr.pos)
+	return expr, nil
+}
+
+// parseLiteral parses a literal to string, int64, float64, bool or nil.
+func (parser *queryParser) parseLiteral() (any, error) {
+	token := parser.token
+	var literal any
+	switch {
+	case token.kind == tokenString:
+		s, err := strconv.Unquote(token.text)
+		if err != nil {
+			return nil, parser.errorf("invalid string %s", token.text)
+		}
+		literal = s
+	case token.kind == tokenNumber:
+		if i, err := strconv.ParseInt(token.text, 10, 64); err == nil {
+			literal = i
+		} else if f, err := strconv.ParseFloat(token.text, 64); err == nil {
+			literal = f
+		} else {
+			return nil, parser.errorf("invalid number %s", token.text)
+		}
+	case parser.isKeyword("true"):
+		literal = true
+	case parser.isKeyword("false"):
+		literal = false
+	case parser.isKeyword("null"):
+		literal = nil
+	default:
+		return nil, parser.errorf("expected value, got %s", token)
+	}
+	return literal, parser.next()
+}
+
+// queryCond is a condition of a query compiled for an IndexMap,
+// the caller holds the lock of the map.
+type queryCond[V any] struct {
+	op       queryOp
+	children []*queryCond[V]
+	text     string
+
+	// comparisons only
+	literals []any
+	compare  string
+
+	// conditions on indexes
+	index keyedIndex[V]
+	// the result of lookup, once it's called
+	looked Set[*V]
+
+	// match reports whether the value matches a condition on a field,
+	// it's set for indexes as well if they are named like a field
+	match func(value *V) bool
+}
+
+type compiledQuery[K comparable, V any] struct {
+	imap    *IndexMap[K, V]
+	where   *queryCond[V]
+	orderBy []func(value1, value2 *V) int
+	// the source of ORDER BY, for Explain
+	orderText []string
+	limit     int
+	offset    int
+}
+
+// compileQuery resolves the identifiers of the query,
+// the caller holds the lock of the map.
+func compileQuery[K comparable, V any](imap *IndexMap[K, V], parsed *parsedQuery) (*compiledQuery[K, V], error) {
+	compiled := &compiledQuery[K, V]{imap: imap, limit: parsed.limit, offset: parsed.offset}
+	valueType := reflect.TypeOf((*V)(nil)).Elem()
+
+	if parsed.where != nil {
+		var err error
+		if compiled.where, err = compileCond(imap, valueType, parsed.where); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, order := range parsed.orderBy {
+		var cmp func(value1, value2 *V) int
+		if tree, ok := imap.orderings[order.ident]; ok {
+			cmp = tree.cmp
+		} else {
+			accessor, err := accessorOf(valueType, order.ident)
+			if err != nil {
+				return nil, fmt.Errorf("%w: query at %d: unknown ordering or field %s: %s", ErrInvalidQuery, order.pos, strconv.Quote(order.ident), err)
+			}
+			cmp = func(value1, value2 *V) int {
+				field1, _ := accessor.get(reflect.ValueOf(value1).Elem())
+				field2, _ := accessor.get(reflect.ValueOf(value2).Elem())
+				return compareValues(field1, field2)
+			}
+		}
+		if order.desc {
+			asc := cmp
+			cmp = func(value1, value2 *V) int {
+				return asc(value2, value1)
+			}
+		}
+		compiled.orderBy = append(compiled.orderBy, cmp)
+		compiled.orderText = append(compiled.orderText, order.String())
+	}
+	return compiled, nil
+}
+
+func compileCond[K comparable, V any](imap *IndexMap[K, V], valueType reflect.Type, expr *queryExpr) (*queryCond[V], error) {
+	cond := &queryCond[V]{op: expr.op, text: expr.text, literals: expr.literals, compare: expr.compare}
+	if expr.op == queryAnd || expr.op == queryOr || expr.op == queryNot {
+		for _, child := range expr.children {
+			compiled, err := compileCond(imap, valueType, child)
+			if err != nil {
+				return nil, err
+			}
+			cond.children = append(cond.children, compiled)
+		}
+		return cond, nil
+	}
+
+	index, isIndex := imap.indexes[expr.ident].(keyedIndex[V])
+	if isIndex {
+		cond.index = index
+	}
+
+	accessor, err := accessorOf(valueType, expr.ident)
+	if err != nil {
+		if isIndex {
+			return cond, nil
+		}
+		return nil, fmt.Errorf("%w: query at %d: unknown index or field %s: %s", ErrInvalidQuery, expr.pos, strconv.Quote(expr.ident), err)
+	}
+	literals := make([]any, len(expr.literals))
+	for i, literal := range expr.literals {
+		if literals[i], err = literalFor(accessor.typ, literal); err != nil {
+			if isIndex {
+				return cond, nil
+			}
+			return nil, fmt.Errorf("%w: query at %d: %s: %s", ErrInvalidQuery, expr.pos, expr.ident, err)
+		}
+	}
+	cond.match = fieldMatch[V](accessor, literals, comparison(expr.compare))
+	// only a SecondaryIndex stands in for the field it is named like, like fieldIndex in Where,
+	// other indexes don't hold all values or don't key them by the field
+	if _, ok := index.(*SecondaryIndex[V]); !ok {
+		cond.index = nil
+	}
+	return cond, nil
+}
+
+// fieldMatch returns the match of a field by the literals converted by literalFor.
+func fieldMatch[V any](accessor *fieldAccessor, literals []any, test func(c int) bool) func(value *V) bool {
+	return func(value *V) bool {
+		field, ok := accessor.get(reflect.ValueOf(value).Elem())
+		if !ok {
+			return matchNull(literals, test)
+		}
+		return matchField(field, literals, test)
+	}
+}
+
+// comparison returns the test of the compare result for the operator,
+// IN tests for equality.
+func comparison(operator string) func(c int) bool {
+	switch operator {
+	case "!=":
+		return func(c int) bool { return c != 0 }
+	case "<":
+		return func(c int) bool { return c < 0 }
+	case "<=":
+		return func(c int) bool { return c <= 0 }
+	case ">":
+		return func(c int) bool { return c > 0 }
+	case ">=":
+		return func(c int) bool { return c >= 0 }
+	}
+	return func(c int) bool { return c == 0 }
+}
+
+// matchNull matches missing fields, i.e. behind nil pointers.
+func matchNull(literals []any, test func(c int) bool) bool {
+	for _, literal := range literals {
+		if literal == nil && test(0) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchField(field reflect.Value, literals []any, test func(c int) bool) bool {
+	kind := field.Kind()
+	switch {
+	case (kind == reflect.Pointer || kind == reflect.Interface || kind == reflect.Slice || kind == reflect.Map) && field.IsNil():
+		return matchNull(literals, test)
+	case (kind == reflect.Slice || kind == reflect.Array) && field.Type().Elem().Kind() != reflect.Uint8:
+		for i := 0; i < field.Len(); i++ {
+			if matchField(field.Index(i), literals, test) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, literal := range literals {
+		if literal == nil {
+			if test(1) {
+				// not null
+				return true
+			}
+			continue
+		}
+		if c, ok := compareLiteral(field, literal); ok && test(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupKeys returns the values of the index keys matching the literals,
+// equal lookups use get, the others compare all keys.
+func lookupKeys[V any](index keyedIndex[V], literals []any, test func(c int) bool, equal bool) Set[*V] {
+	result := make(Set[*V])
+	if equal {
+		keyType := sampleKeyType(index)
+		for _, literal := range literals {
+			if key, ok := convertKey(literal, keyType); ok {
+				index.get(key).addTo(result)
+			}
+		}
+		return result
+	}
+
+	index.iterate(func(key any, elems bucket[V]) bool {
+		for _, literal := range literals {
+			if c, ok := compareLiteral(reflect.ValueOf(key), literal); ok && test(c) {
+				elems.addTo(result)
+				break
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// sampleKeyType returns the type of a key of the index, nil if it's empty.
+func sampleKeyType[V any](index keyedIndex[V]) reflect.Type {
+	var keyType reflect.Type
+	index.iterate(func(key any, _ bucket[V]) bool {
+		if key == nil {
+			return true
+		}
+		keyType = reflect.TypeOf(key)
+		return false
+	})
+	return keyType
+}
+
+// convertKey converts the literal to the key type of an index,
+// false if it isn't representable. nil never matches.
+func convertKey(literal any, keyType reflect.Type) (any, bool) {
+	if literal == nil {
+		return nil, false
+	}
+	value := reflect.ValueOf(literal)
+	if keyType == nil || value.Type() == keyType {
+		return literal, true
+	}
+	if !(isNumber(value.Kind()) && isNumber(keyType.Kind())) && !(value.Kind() == reflect.String && keyType.Kind() == reflect.String) {
+		return literal, true
+	}
+	converted := value.Convert(keyType)
+	// lossless only, 1.5 doesn't match the int key 1
+	if !converted.Convert(value.Type()).Equal(value) {
+		return nil, false
+	}
+	return converted.Interface(), true
+}
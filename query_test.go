@@ -0,0 +1,187 @@
+package indexmap
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func filterPersons(imap *IndexMap[int64, Person], filter func(value *Person) bool) []*Person {
+	var result []*Person
+	imap.Range(func(_ int64, value *Person) bool {
+		if filter(value) {
+			result = append(result, value)
+		}
+		return true
+	})
+	return result
+}
+
+func TestIndexMap_Query(t *testing.T) {
+	imap := CreateTestMap(1000)
+	imap.AddIndex("age", NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.Age}
+	}))
+	city := imap.Get(1).City
+
+	tests := []struct {
+		query  string
+		filter func(value *Person) bool
+	}{
+		{`city = "` + city + `"`, func(value *Person) bool { return value.City == city }},
+		{`city = "` + city + `" AND age >= 30`, func(value *Person) bool { return value.City == city && value.Age >= 30 }},
+		{`city = "` + city + `" and Name != "James"`, func(value *Person) bool { return value.City == city && value.Name != "James" }},
+		{`age < 10 OR age > 90`, func(value *Person) bool { return value.Age < 10 || value.Age > 90 }},
+		{`age = 10.0 OR id <= 5`, func(value *Person) bool { return value.Age == 10 || value.ID <= 5 }},
+		{`age = 10.5`, func(value *Person) bool { return false }},
+		{`NOT (age >= 10 AND age <= 90) AND id > 500`, func(value *Person) bool { return (value.Age < 10 || value.Age > 90) && value.ID > 500 }},
+		{`name IN ("James", "Mary") AND NOT city = "` + city + `"`, func(value *Person) bool {
+			return (value.Name == "James" || value.Name == "Mary") && value.City != city
+		}},
+		{`age NOT IN (1, 2, 3)`, func(value *Person) bool { return value.Age > 3 || value.Age < 1 }},
+		{`like = "Mary"`, func(value *Person) bool { return slices.Contains(value.Like, "Mary") }},
+		{`like = null`, func(value *Person) bool { return value.Like == nil }},
+		{`like != null AND ID < 100`, func(value *Person) bool { return value.Like != nil && value.ID < 100 }},
+		{`name >= "X"`, func(value *Person) bool { return value.Name >= "X" }},
+		{``, func(value *Person) bool { return true }},
+	}
+	for _, test := range tests {
+		result, err := imap.Query(test.query)
+		assert.NoError(t, err, test.query)
+		assert.ElementsMatch(t, filterPersons(imap, test.filter), result, test.query)
+	}
+}
+
+func TestIndexMap_QueryOrderBy(t *testing.T) {
+	imap := CreateTestMap(1000)
+	imap.AddOrdering("by_age", func(value1, value2 *Person) int {
+		return value1.Age - value2.Age
+	})
+
+	result, err := imap.Query(`age >= 30 ORDER BY name, id DESC LIMIT 10`)
+	assert.NoError(t, err)
+	expected := filterPersons(imap, func(value *Person) bool { return value.Age >= 30 })
+	slices.SortFunc(expected, func(value1, value2 *Person) int {
+		if c := strings.Compare(value1.Name, value2.Name); c != 0 {
+			return c
+		}
+		return int(value2.ID - value1.ID)
+	})
+	assert.Equal(t, expected[:10], result)
+
+	result, err = imap.Query(`ORDER BY by_age DESC LIMIT 5 OFFSET 10`)
+	assert.NoError(t, err)
+	assert.Len(t, result, 5)
+	assert.True(t, slices.IsSortedFunc(result, func(value1, value2 *Person) int {
+		return value2.Age - value1.Age
+	}))
+	assert.Equal(t, 102, result[0].Age)
+
+	result, err = imap.Query(`LIMIT 5 OFFSET 998`)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	result, err = imap.Query(`city = "Nowhere" LIMIT 5 OFFSET 10`)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+type Address struct {
+	Street string
+	City   string
+}
+
+type Customer struct {
+	ID      int64
+	Since   time.Time
+	Address *Address
+	Tags    []string
+	Score   float64
+	Active  bool
+}
+
+func createCustomers() *IndexMap[int64, Customer] {
+	customers := NewIndexMap(NewPrimaryIndex(func(value *Customer) int64 {
+		return value.ID
+	}))
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		customer := &Customer{ID: int64(i), Since: since.AddDate(0, i, 0), Score: float64(i) / 10, Active: i%2 == 0}
+		if i%10 != 0 {
+			customer.Address = &Address{Street: "Main", City: cities[i%5]}
+		}
+		if i%3 == 0 {
+			customer.Tags = []string{"vip", cities[i%5]}
+		}
+		customers.Insert(customer)
+	}
+	return customers
+}
+
+func TestIndexMap_QueryFields(t *testing.T) {
+	customers := createCustomers()
+	count := func(query string) int {
+		result, err := customers.Query(query)
+		assert.NoError(t, err, query)
+		return len(result)
+	}
+
+	assert.Equal(t, 20, count(`address.city = "`+cities[1]+`"`))
+	assert.Equal(t, 10, count(`Address = null`))
+	assert.Equal(t, 10, count(`address.city = null`))
+	assert.Equal(t, 90, count(`address.city != null`))
+	assert.Equal(t, 12, count(`since >= "2024-01-01" AND since < "2025-01-01T00:00:00Z"`))
+	assert.Equal(t, 34, count(`tags = "vip"`))
+	assert.Equal(t, 50, count(`active = true`))
+	assert.Equal(t, 4, count(`score > 9.5`))
+	assert.Equal(t, 0, count(`score > 1e10`))
+	assert.Equal(t, 100, count(`score >= -1`))
+
+	result, err := customers.Query(`address.city != null ORDER BY address.city DESC, id LIMIT 1`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result[0].ID)
+}
+
+func TestIndexMap_QueryErrors(t *testing.T) {
+	customers := createCustomers()
+	customers.AddIndex("first-tag", NewSecondaryIndex(func(value *Customer) []any {
+		if len(value.Tags) == 0 {
+			return nil
+		}
+		return []any{value.Tags[0]}
+	}))
+	result, err := customers.Query("`first-tag` = \"vip\"")
+	assert.NoError(t, err)
+	assert.Len(t, result, 34)
+
+	tests := map[string]string{
+		`age = 1`:                     `query at 0: unknown index or field "age"`,
+		`id = "x"`:                    `query at 0: id: can't compare int64 with "x"`,
+		`since > "yesterday"`:         `query at 0: since: "yesterday" is no time`,
+		`id = `:                       `query at 5: expected value, got end of query`,
+		`id 1`:                        `query at 3: expected comparison operator after "id", got "1"`,
+		`id = 1 AND`:                  `query at 10: expected condition, got end of query`,
+		`(id = 1 OR id = 2`:           `query at 17: expected ")" to close "(" at 0, got end of query`,
+		`id IN (1, 2`:                 `query at 11: expected "," or ")" in IN list, got end of query`,
+		`id ! 1`:                      `query at 3: expected "!="`,
+		`name = "x`:                   `query at 7: unterminated string`,
+		`id = 1 LIMIT x`:              `query at 13: expected number after LIMIT, got "x"`,
+		`id = 1 ORDER id`:             `query at 13: expected BY, got "id"`,
+		`ORDER BY nothing`:            `query at 9: unknown ordering or field "nothing"`,
+		`id = 1 id = 2`:               `query at 7: unexpected "id"`,
+		`id = 1 # comment`:            `query at 7: unexpected '#'`,
+		`id NOT = 1`:                  `query at 7: expected IN after NOT, got "="`,
+		"`first-tag = 1":              `query at 0: unterminated identifier`,
+		`id = 1 LIMIT 10 OFFSET -1`:   `query at 23: OFFSET -1 isn't a count`,
+		`id = 1 ORDER BY id ASC DESC`: `query at 23: unexpected "DESC"`,
+	}
+	for query, message := range tests {
+		_, err := customers.Query(query)
+		assert.ErrorIs(t, err, ErrInvalidQuery, query)
+		if err != nil {
+			assert.Contains(t, err.Error(), message, query)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package indexmap
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// bitmap is a compressed set of uint32 like a roaring bitmap,
+// the numbers are partitioned by their high 16 bits into containers
+// holding the low 16 bits, sparse containers as sorted arrays, dense ones as bitsets.
+// The operations And, Or and AndNot don't modify the bitmaps, their results
+// may share containers with them, so results must not be modified.
+type bitmap struct {
+	// the high bits of the containers in ascending order
+	keys       []uint16
+	containers []*container
+}
+
+// arrayMax is the size up to which a container is an array,
+// above it the bitset of 8 KiB is smaller.
+const arrayMax = 4096
+
+const bitsetWords = 1 << 16 / 64
+
+type container struct {
+	// sorted, nil for bitsets
+	array []uint16
+	// bitsetWords words, nil for arrays
+	bitset []uint64
+	n      int
+}
+
+func split(x uint32) (high, low uint16) {
+	return uint16(x >> 16), uint16(x)
+}
+
+func (b *bitmap) find(high uint16) (int, bool) {
+	return slices.BinarySearch(b.keys, high)
+}
+
+// add returns whether x wasn't in the bitmap.
+func (b *bitmap) add(x uint32) bool {
+	high, low := split(x)
+	i, ok := b.find(high)
+	if !ok {
+		b.keys = slices.Insert(b.keys, i, high)
+		b.containers = slices.Insert(b.containers, i, &container{})
+	}
+	return b.containers[i].add(low)
+}
+
+// remove returns whether x was in the bitmap.
+func (b *bitmap) remove(x uint32) bool {
+	high, low := split(x)
+	i, ok := b.find(high)
+	if !ok || !b.containers[i].remove(low) {
+		return false
+	}
+	if b.containers[i].n == 0 {
+		b.keys = slices.Delete(b.keys, i, i+1)
+		b.containers = slices.Delete(b.containers, i, i+1)
+	}
+	return true
+}
+
+func (b *bitmap) contains(x uint32) bool {
+	high, low := split(x)
+	i, ok := b.find(high)
+	return ok && b.containers[i].contains(low)
+}
+
+func (b *bitmap) cardinality() int {
+	n := 0
+	for _, c := range b.containers {
+		n += c.n
+	}
+	return n
+}
+
+// iterate calls fn for the numbers in ascending order, until it returns false.
+func (b *bitmap) iterate(fn func(x uint32) bool) {
+	for i, c := range b.containers {
+		high := uint32(b.keys[i]) << 16
+		if !c.iterate(func(low uint16) bool {
+			return fn(high | uint32(low))
+		}) {
+			return
+		}
+	}
+}
+
+// and returns the intersection of the bitmaps.
+func (b *bitmap) and(other *bitmap) *bitmap {
+	result := &bitmap{}
+	for i, j := 0, 0; i < len(b.keys) && j < len(other.keys); {
+		switch {
+		case b.keys[i] < other.keys[j]:
+			i++
+		case b.keys[i] > other.keys[j]:
+			j++
+		default:
+			if c := b.containers[i].and(other.containers[j]); c != nil {
+				result.keys = append(result.keys, b.keys[i])
+				result.containers = append(result.containers, c)
+			}
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// or returns the union of the bitmaps.
+func (b *bitmap) or(other *bitmap) *bitmap {
+	result := &bitmap{}
+	i, j := 0, 0
+	for i < len(b.keys) && j < len(other.keys) {
+		switch {
+		case b.keys[i] < other.keys[j]:
+			result.keys = append(result.keys, b.keys[i])
+			result.containers = append(result.containers, b.containers[i])
+			i++
+		case b.keys[i] > other.keys[j]:
+			result.keys = append(result.keys, other.keys[j])
+			result.containers = append(result.containers, other.containers[j])
+			j++
+		default:
+			result.keys = append(result.keys, b.keys[i])
+			result.containers = append(result.containers, b.containers[i].or(other.containers[j]))
+			i++
+			j++
+		}
+	}
+	result.keys = append(append(result.keys, b.keys[i:]...), other.keys[j:]...)
+	result.containers = append(append(result.containers, b.containers[i:]...), other.containers[j:]...)
+	return result
+}
+
+// andNot returns the numbers of b not in other.
+func (b *bitmap) andNot(other *bitmap) *bitmap {
+	result := &bitmap{}
+	for i, j := 0, 0; i < len(b.keys); i++ {
+		for j < len(other.keys) && other.keys[j] < b.keys[i] {
+			j++
+		}
+		c := b.containers[i]
+		if j < len(other.keys) && other.keys[j] == b.keys[i] {
+			if c = c.andNot(other.containers[j]); c == nil {
+				continue
+			}
+		}
+		result.keys = append(result.keys, b.keys[i])
+		result.containers = append(result.containers, c)
+	}
+	return result
+}
+
+func (c *container) contains(x uint16) bool {
+	if c.bitset != nil {
+		return c.bitset[x/64]&(1<<(x%64)) != 0
+	}
+	_, ok := slices.BinarySearch(c.array, x)
+	return ok
+}
+
+func (c *container) add(x uint16) bool {
+	if c.bitset != nil {
+		if c.bitset[x/64]&(1<<(x%64)) != 0 {
+			return false
+		}
+		c.bitset[x/64] |= 1 << (x % 64)
+		c.n++
+		return true
+	}
+	i, ok := slices.BinarySearch(c.array, x)
+	if ok {
+		return false
+	}
+	c.array = slices.Insert(c.array, i, x)
+	c.n++
+	if c.n > arrayMax {
+		c.bitset, c.array = arrayToBitset(c.array), nil
+	}
+	return true
+}
+
+func (c *container) remove(x uint16) bool {
+	if c.bitset != nil {
+		if c.bitset[x/64]&(1<<(x%64)) == 0 {
+			return false
+		}
+		c.bitset[x/64] &^= 1 << (x % 64)
+		c.n--
+		// half of arrayMax, so alternating adds and removes don't convert every time
+		if c.n <= arrayMax/2 {
+			c.array, c.bitset = bitsetToArray(c.bitset, c.n), nil
+		}
+		return true
+	}
+	i, ok := slices.BinarySearch(c.array, x)
+	if !ok {
+		return false
+	}
+	c.array = slices.Delete(c.array, i, i+1)
+	c.n--
+	return true
+}
+
+func (c *container) iterate(fn func(x uint16) bool) bool {
+	if c.bitset == nil {
+		for _, x := range c.array {
+			if !fn(x) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, word := range c.bitset {
+		for word != 0 {
+			t := bits.TrailingZeros64(word)
+			if !fn(uint16(i*64 + t)) {
+				return false
+			}
+			word &= word - 1
+		}
+	}
+	return true
+}
+
+// and returns the intersection, nil if it's empty.
+func (c *container) and(other *container) *container {
+	switch {
+	case c.bitset != nil && other.bitset != nil:
+		bitset := make([]uint64, bitsetWords)
+		n := 0
+		for i := range bitset {
+			bitset[i] = c.bitset[i] & other.bitset[i]
+			n += bits.OnesCount64(bitset[i])
+		}
+		return newBitsetContainer(bitset, n)
+	case c.bitset != nil:
+		return other.and(c)
+	}
+
+	array := make([]uint16, 0, min(c.n, other.n))
+	if other.bitset != nil {
+		for _, x := range c.array {
+			if other.contains(x) {
+				array = append(array, x)
+			}
+		}
+	} else {
+		for i, j := 0, 0; i < len(c.array) && j < len(other.array); {
+			switch {
+			case c.array[i] < other.array[j]:
+				i++
+			case c.array[i] > other.array[j]:
+				j++
+			default:
+				array = append(array, c.array[i])
+				i++
+				j++
+			}
+		}
+	}
+	if len(array) == 0 {
+		return nil
+	}
+	return &container{array: array, n: len(array)}
+}
+
+// or returns the union.
+func (c *container) or(other *container) *container {
+	if c.bitset == nil && other.bitset == nil && c.n+other.n <= arrayMax {
+		array := make([]uint16, 0, c.n+other.n)
+		i, j := 0, 0
+		for i < len(c.array) && j < len(other.array) {
+			switch {
+			case c.array[i] < other.array[j]:
+				array = append(array, c.array[i])
+				i++
+			case c.array[i] > other.array[j]:
+				array = append(array, other.array[j])
+				j++
+			default:
+				array = append(array, c.array[i])
+				i++
+				j++
+			}
+		}
+		array = append(append(array, c.array[i:]...), other.array[j:]...)
+		return &container{array: array, n: len(array)}
+	}
+
+	bitset := c.toBitset()
+	if other.bitset != nil {
+		for i := range bitset {
+			bitset[i] |= other.bitset[i]
+		}
+	} else {
+		for _, x := range other.array {
+			bitset[x/64] |= 1 << (x % 64)
+		}
+	}
+	n := 0
+	for _, word := range bitset {
+		n += bits.OnesCount64(word)
+	}
+	return newBitsetContainer(bitset, n)
+}
+
+// andNot returns the numbers of c not in other, nil if there are none.
+func (c *container) andNot(other *container) *container {
+	if c.bitset == nil {
+		array := make([]uint16, 0, c.n)
+		for _, x := range c.array {
+			if !other.contains(x) {
+				array = append(array, x)
+			}
+		}
+		if len(array) == 0 {
+			return nil
+		}
+		return &container{array: array, n: len(array)}
+	}
+
+	bitset := c.toBitset()
+	if other.bitset != nil {
+		for i := range bitset {
+			bitset[i] &^= other.bitset[i]
+		}
+	} else {
+		for _, x := range other.array {
+			bitset[x/64] &^= 1 << (x % 64)
+		}
+	}
+	n := 0
+	for _, word := range bitset {
+		n += bits.OnesCount64(word)
+	}
+	return newBitsetContainer(bitset, n)
+}
+
+// toBitset returns a copy of the container as bitset.
+func (c *container) toBitset() []uint64 {
+	if c.bitset != nil {
+		return slices.Clone(c.bitset)
+	}
+	return arrayToBitset(c.array)
+}
+
+// newBitsetContainer converts small bitsets to arrays, nil if it's empty.
+func newBitsetContainer(bitset []uint64, n int) *container {
+	switch {
+	case n == 0:
+		return nil
+	case n <= arrayMax:
+		return &container{array: bitsetToArray(bitset, n), n: n}
+	}
+	return &container{bitset: bitset, n: n}
+}
+
+func arrayToBitset(array []uint16) []uint64 {
+	bitset := make([]uint64, bitsetWords)
+	for _, x := range array {
+		bitset[x/64] |= 1 << (x % 64)
+	}
+	return bitset
+}
+
+func bitsetToArray(bitset []uint64, n int) []uint16 {
+	array := make([]uint16, 0, n)
+	(&container{bitset: bitset}).iterate(func(x uint16) bool {
+		array = append(array, x)
+		return true
+	})
+	return array
+}
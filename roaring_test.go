@@ -0,0 +1,106 @@
+package indexmap
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bitmapOf(xs ...uint32) *bitmap {
+	b := &bitmap{}
+	for _, x := range xs {
+		b.add(x)
+	}
+	return b
+}
+
+func bitmapValues(b *bitmap) []uint32 {
+	var xs []uint32
+	b.iterate(func(x uint32) bool {
+		xs = append(xs, x)
+		return true
+	})
+	return xs
+}
+
+// randomNumbers returns sparse numbers in several containers, and dense ones in the container 1.
+func randomNumbers(myRand *rand.Rand, sparse, dense int) map[uint32]bool {
+	xs := make(map[uint32]bool)
+	for range sparse {
+		xs[uint32(myRand.Intn(4<<16))] = true
+	}
+	for range dense {
+		xs[1<<16|uint32(myRand.Intn(1<<16))] = true
+	}
+	return xs
+}
+
+func sortedNumbers(xs map[uint32]bool) []uint32 {
+	var sorted []uint32
+	for x := range xs {
+		sorted = append(sorted, x)
+	}
+	slices.Sort(sorted)
+	return sorted
+}
+
+func TestBitmap_AddRemove(t *testing.T) {
+	myRand := rand.New(rand.NewSource(123))
+	b := &bitmap{}
+	model := make(map[uint32]bool)
+	for i := range 50000 {
+		x := uint32(myRand.Intn(3 << 16))
+		if i%3 == 0 {
+			assert.Equal(t, model[x], b.remove(x))
+			delete(model, x)
+		} else {
+			assert.Equal(t, !model[x], b.add(x))
+			model[x] = true
+		}
+	}
+	assert.Equal(t, len(model), b.cardinality())
+	assert.Equal(t, sortedNumbers(model), bitmapValues(b))
+	assert.True(t, slices.ContainsFunc(b.containers, func(c *container) bool { return c.bitset != nil }))
+	for x := range uint32(1000) {
+		assert.Equal(t, model[x], b.contains(x))
+	}
+
+	for x := range model {
+		assert.True(t, b.remove(x))
+	}
+	assert.Equal(t, 0, b.cardinality())
+	assert.Empty(t, b.keys)
+}
+
+func TestBitmap_Operations(t *testing.T) {
+	myRand := rand.New(rand.NewSource(123))
+	for _, sizes := range [][4]int{{100, 0, 100, 0}, {100, 10000, 100, 0}, {1000, 10000, 1000, 20000}, {0, 0, 100, 100}} {
+		xs := randomNumbers(myRand, sizes[0], sizes[1])
+		ys := randomNumbers(myRand, sizes[2], sizes[3])
+		b1, b2 := bitmapOf(sortedNumbers(xs)...), bitmapOf(sortedNumbers(ys)...)
+
+		and, or, andNot := make(map[uint32]bool), make(map[uint32]bool), make(map[uint32]bool)
+		for x := range xs {
+			or[x] = true
+			if ys[x] {
+				and[x] = true
+			} else {
+				andNot[x] = true
+			}
+		}
+		for y := range ys {
+			or[y] = true
+		}
+
+		assert.Equal(t, sortedNumbers(and), bitmapValues(b1.and(b2)), sizes)
+		assert.Equal(t, sortedNumbers(and), bitmapValues(b2.and(b1)), sizes)
+		assert.Equal(t, sortedNumbers(or), bitmapValues(b1.or(b2)), sizes)
+		assert.Equal(t, sortedNumbers(andNot), bitmapValues(b1.andNot(b2)), sizes)
+		assert.Equal(t, len(or), b2.or(b1).cardinality(), sizes)
+		// the operands are kept
+		assert.Equal(t, sortedNumbers(xs), bitmapValues(b1), sizes)
+		assert.Equal(t, sortedNumbers(ys), bitmapValues(b2), sizes)
+	}
+}
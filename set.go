@@ -37,3 +37,24 @@ func (set Set[T]) Collect() []T {
 func (set Set[T]) Len() int {
 	return len(set)
 }
+
+// Intersect returns the values contained in all results in the order of the first one,
+// to combine lookups of different indexes, i.e. the nearest values with a given name.
+func Intersect[V any](first []*V, others ...[]*V) []*V {
+	counts := make(map[*V]int, len(first))
+	for _, values := range others {
+		seen := make(Set[*V], len(values))
+		seen.Insert(values...)
+		for value := range seen {
+			counts[value]++
+		}
+	}
+
+	result := make([]*V, 0, len(first))
+	for _, value := range first {
+		if counts[value] == len(others) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
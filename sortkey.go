@@ -0,0 +1,65 @@
+package indexmap
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// sortKey gives index keys of any type a total order, so they can be paged.
+// Keys are ordered by their type name first, then numbers by value,
+// strings lexically and all other types by their fmt representation.
+// It is serializable, that makes it usable in cursors.
+type sortKey struct {
+	Type string `json:"t"`
+	Int  int64  `json:"i,omitempty"`
+	Uint uint64 `json:"u,omitempty"`
+	Str  string `json:"s,omitempty"`
+}
+
+func sortKeyOf(key any) sortKey {
+	if key == nil {
+		return sortKey{Type: "nil"}
+	}
+
+	rv := reflect.ValueOf(key)
+	sk := sortKey{Type: rv.Type().String()}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sk.Int = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		sk.Uint = rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		// order preserving mapping of the IEEE 754 bits
+		bits := math.Float64bits(rv.Float())
+		if bits>>63 == 1 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		sk.Uint = bits
+	case reflect.Bool:
+		if rv.Bool() {
+			sk.Int = 1
+		}
+	case reflect.String:
+		sk.Str = rv.String()
+	default:
+		sk.Str = fmt.Sprint(key)
+	}
+	return sk
+}
+
+func (sk sortKey) compare(other sortKey) int {
+	if c := cmp.Compare(sk.Type, other.Type); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(sk.Int, other.Int); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(sk.Uint, other.Uint); c != 0 {
+		return c
+	}
+	return cmp.Compare(sk.Str, other.Str)
+}
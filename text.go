@@ -0,0 +1,546 @@
+package indexmap
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// fieldGap separates the positions of the texts of a value,
+// so phrases don't match across them.
+const fieldGap = 100
+
+// TextIndex is an inverted index for full-text search,
+// the texts of a value are split into terms by an Analyzer.
+// Added by AddIndex it is searched by IndexMap.Search and IndexMap.SearchRanked,
+// GetBy, GetAllBy and RangeBy see it as an index of its terms.
+type TextIndex[V any] struct {
+	extractField func(value *V) []string
+	analyzer     *Analyzer
+
+	// term -> value -> positions of the term in the value's texts
+	postings map[string]map[*V][]int
+	// value -> distinct terms and number of terms
+	docs map[*V]textDoc
+	// word before stemming -> number of values containing it,
+	// prefix terms match the words, filled only if the analyzer stems
+	words    map[string]int
+	totalLen int
+}
+
+type textDoc struct {
+	terms  []string
+	words  []string
+	length int
+}
+
+// Create a full-text index,
+// the extractField func returns the texts to index,
+// a nil analyzer uses the DefaultAnalyzer.
+func NewTextIndex[V any](extractField func(value *V) []string, analyzer *Analyzer) *TextIndex[V] {
+	if analyzer == nil {
+		analyzer = DefaultAnalyzer()
+	}
+	return &TextIndex[V]{
+		extractField: extractField,
+		analyzer:     analyzer,
+		postings:     make(map[string]map[*V][]int),
+		docs:         make(map[*V]textDoc),
+		words:        make(map[string]int),
+	}
+}
+
+func (index *TextIndex[V]) insert(elem *V) {
+	doc := textDoc{}
+	pos := 0
+	stem := index.analyzer.Stem
+	var words Set[string]
+	if stem != nil {
+		words = make(Set[string])
+	}
+	for _, text := range index.extractField(elem) {
+		for _, word := range index.analyzer.words(text) {
+			term := word
+			if stem != nil {
+				term = stem(word)
+				if !words.Contain(word) {
+					words.Insert(word)
+					doc.words = append(doc.words, word)
+					index.words[word]++
+				}
+			}
+			docs, ok := index.postings[term]
+			if !ok {
+				docs = make(map[*V][]int)
+				index.postings[term] = docs
+			}
+			if _, ok := docs[elem]; !ok {
+				doc.terms = append(doc.terms, term)
+			}
+			docs[elem] = append(docs[elem], pos)
+			pos++
+			doc.length++
+		}
+		pos += fieldGap
+	}
+	index.docs[elem] = doc
+	index.totalLen += doc.length
+}
+
+func (index *TextIndex[V]) remove(elem *V) {
+	doc, ok := index.docs[elem]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		docs := index.postings[term]
+		delete(docs, elem)
+		if len(docs) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	for _, word := range doc.words {
+		if index.words[word]--; index.words[word] == 0 {
+			delete(index.words, word)
+		}
+	}
+	delete(index.docs, elem)
+	index.totalLen -= doc.length
+}
+
+func (index *TextIndex[V]) clear() {
+	index.postings = make(map[string]map[*V][]int)
+	index.docs = make(map[*V]textDoc)
+	index.words = make(map[string]int)
+	index.totalLen = 0
+}
+
+// get returns the values containing the term, the key is analyzed like a query term.
+func (index *TextIndex[V]) get(key any) bucket[V] {
+	text, ok := key.(string)
+	if !ok {
+		return bucket[V]{}
+	}
+	terms := index.analyzer.Analyze(text)
+	if len(terms) != 1 {
+		return bucket[V]{}
+	}
+	return setBucket(index.term(terms[0]))
+}
+
+func (index *TextIndex[V]) iterate(fn func(key any, elems bucket[V]) bool) {
+	for term := range index.postings {
+		if !fn(term, setBucket(index.term(term))) {
+			return
+		}
+	}
+}
+
+func (index *TextIndex[V]) term(term string) Set[*V] {
+	docs, ok := index.postings[term]
+	if !ok {
+		return nil
+	}
+	result := make(Set[*V], len(docs))
+	for doc := range docs {
+		result.Insert(doc)
+	}
+	return result
+}
+
+// Search returns the values of the named TextIndex matching the query.
+//
+// The query consists of terms, all of them must match.
+// Terms are combined by OR instead, AND is allowed for readability,
+// parentheses group terms. A term ending with * matches all terms
+// with that prefix, terms in double quotes match a phrase, i.e.
+//
+//	san fran*
+//	"san francisco" OR (shanghai AND china)
+//
+// The terms are analyzed like the indexed texts, so they are i.e. lowercased.
+// The order of the result is undefined, SearchRanked orders by relevance.
+func (imap *IndexMap[K, V]) Search(indexName string, query string) ([]*V, error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*TextIndex[V])
+	if !ok {
+		return nil, ErrUnknownName
+	}
+	node, err := parseTextQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return index.match(node).Collect(), nil
+}
+
+// Scoring selects the relevance function of SearchRanked.
+type Scoring int
+
+const (
+	// BM25 is Okapi BM25 with k1=1.2 and b=0.75.
+	BM25 Scoring = iota
+	// TFIDF is the plain term frequency times inverse document frequency.
+	TFIDF
+)
+
+// ScoredValue is a search hit with its relevance.
+type ScoredValue[V any] struct {
+	Value *V
+	Score float64
+}
+
+// SearchRanked returns the values matching the query like Search,
+// ordered by descending relevance.
+// The score sums up the relevance of the terms of the query, prefix terms
+// count every term with the prefix.
+func (imap *IndexMap[K, V]) SearchRanked(indexName string, query string, scoring Scoring) ([]ScoredValue[V], error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	index, ok := imap.indexes[indexName].(*TextIndex[V])
+	if !ok {
+		return nil, ErrUnknownName
+	}
+	node, err := parseTextQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := index.match(node)
+	terms := index.queryTerms(node)
+	hits := make([]ScoredValue[V], 0, len(matches))
+	for value := range matches {
+		hits = append(hits, ScoredValue[V]{Value: value, Score: index.score(value, terms, scoring)})
+	}
+	slices.SortStableFunc(hits, func(hit1, hit2 ScoredValue[V]) int {
+		switch {
+		case hit1.Score > hit2.Score:
+			return -1
+		case hit1.Score < hit2.Score:
+			return 1
+		}
+		return 0
+	})
+	return hits, nil
+}
+
+func (index *TextIndex[V]) score(value *V, terms []string, scoring Scoring) float64 {
+	const k1, b = 1.2, 0.75
+
+	n := float64(len(index.docs))
+	avgLen := float64(index.totalLen) / max(n, 1)
+	docLen := float64(index.docs[value].length)
+	score := 0.0
+	for _, term := range terms {
+		docs := index.postings[term]
+		tf := float64(len(docs[value]))
+		if tf == 0 {
+			continue
+		}
+		df := float64(len(docs))
+		switch scoring {
+		case TFIDF:
+			score += tf * math.Log(n/df)
+		default:
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*docLen/avgLen))
+		}
+	}
+	return score
+}
+
+// textQuery is a node of a parsed search query.
+type textQuery struct {
+	op       textOp
+	text     string // the term, prefix or phrase as written
+	children []*textQuery
+}
+
+type textOp int
+
+const (
+	textTerm textOp = iota
+	textPrefix
+	textPhrase
+	textAnd
+	textOr
+)
+
+func (index *TextIndex[V]) match(node *textQuery) Set[*V] {
+	switch node.op {
+	case textAnd, textOr:
+		var result Set[*V]
+		for _, child := range node.children {
+			matches := index.match(child)
+			switch {
+			case matches == nil:
+				// a query term consisting of stop words only, it doesn't restrict
+			case result == nil:
+				result = matches
+			case node.op == textAnd:
+				for value := range result {
+					if !matches.Contain(value) {
+						result.Remove(value)
+					}
+				}
+			default:
+				for value := range matches {
+					result.Insert(value)
+				}
+			}
+		}
+		if result == nil {
+			result = make(Set[*V])
+		}
+		return result
+	case textPrefix:
+		terms, ok := index.prefixTerms(node.text)
+		if !ok {
+			return nil
+		}
+		result := make(Set[*V])
+		for _, term := range terms {
+			for value := range index.postings[term] {
+				result.Insert(value)
+			}
+		}
+		return result
+	default:
+		terms := index.analyzer.Analyze(node.text)
+		if len(terms) == 0 {
+			return nil
+		}
+		result := index.term(terms[0])
+		if result == nil {
+			result = make(Set[*V])
+		}
+		for value := range result {
+			if !index.matchTerms(value, terms, node.op == textPhrase) {
+				result.Remove(value)
+			}
+		}
+		return result
+	}
+}
+
+// matchTerms reports whether the value contains all terms,
+// in a row if phrase is set.
+func (index *TextIndex[V]) matchTerms(value *V, terms []string, phrase bool) bool {
+	if !phrase {
+		for _, term := range terms[1:] {
+			if _, ok := index.postings[term][value]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, start := range index.postings[terms[0]][value] {
+		found := true
+		for i, term := range terms[1:] {
+			if _, ok := slices.BinarySearch(index.postings[term][value], start+i+1); !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// queryTerms returns the analyzed terms of the query relevant for scoring,
+// prefixes are expanded.
+func (index *TextIndex[V]) queryTerms(node *textQuery) []string {
+	switch node.op {
+	case textAnd, textOr:
+		var terms []string
+		for _, child := range node.children {
+			terms = append(terms, index.queryTerms(child)...)
+		}
+		return terms
+	case textPrefix:
+		terms, _ := index.prefixTerms(node.text)
+		return terms
+	default:
+		return index.analyzer.Analyze(node.text)
+	}
+}
+
+// prefixTerms returns the terms of the words starting with the prefix,
+// false if the prefix is no word, like a stop word.
+// The prefix isn't stemmed, it matches the words before stemming.
+func (index *TextIndex[V]) prefixTerms(text string) ([]string, bool) {
+	prefix := index.analyzer.words(text)
+	if len(prefix) == 0 {
+		return nil, false
+	}
+
+	var terms []string
+	if index.analyzer.Stem == nil {
+		for term := range index.postings {
+			if strings.HasPrefix(term, prefix[0]) {
+				terms = append(terms, term)
+			}
+		}
+		return terms, true
+	}
+	seen := make(Set[string])
+	for word := range index.words {
+		if !strings.HasPrefix(word, prefix[0]) {
+			continue
+		}
+		if term := index.analyzer.Stem(word); !seen.Contain(term) {
+			seen.Insert(term)
+			terms = append(terms, term)
+		}
+	}
+	return terms, true
+}
+
+// parseTextQuery parses the search query syntax described at IndexMap.Search.
+func parseTextQuery(query string) (*textQuery, error) {
+	parser := textQueryParser{input: []rune(query)}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.skipSpace(); parser.pos < len(parser.input) {
+		return nil, parser.errorf("unexpected %q", parser.input[parser.pos])
+	}
+	return node, nil
+}
+
+type textQueryParser struct {
+	input []rune
+	pos   int
+}
+
+func (parser *textQueryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: search query at %d: %s", ErrInvalidQuery, parser.pos, fmt.Sprintf(format, args...))
+}
+
+func (parser *textQueryParser) skipSpace() {
+	for parser.pos < len(parser.input) && unicode.IsSpace(parser.input[parser.pos]) {
+		parser.pos++
+	}
+}
+
+// keyword consumes the keyword if it is next.
+func (parser *textQueryParser) keyword(keyword string) bool {
+	parser.skipSpace()
+	end := parser.pos + len(keyword)
+	if end > len(parser.input) || string(parser.input[parser.pos:end]) != keyword {
+		return false
+	}
+	if end < len(parser.input) && !unicode.IsSpace(parser.input[end]) && parser.input[end] != '(' && parser.input[end] != '"' {
+		return false
+	}
+	parser.pos = end
+	return true
+}
+
+func (parser *textQueryParser) parseOr() (*textQuery, error) {
+	node, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []*textQuery{node}
+	for parser.keyword("OR") {
+		node, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &textQuery{op: textOr, children: children}, nil
+}
+
+func (parser *textQueryParser) parseAnd() (*textQuery, error) {
+	var children []*textQuery
+	for {
+		parser.skipSpace()
+		if parser.pos >= len(parser.input) || parser.input[parser.pos] == ')' {
+			break
+		}
+		if len(children) > 0 && parser.keyword("AND") {
+			continue
+		}
+		if parser.peekKeyword("OR") {
+			break
+		}
+		node, err := parser.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, parser.errorf("term expected")
+	case 1:
+		return children[0], nil
+	}
+	return &textQuery{op: textAnd, children: children}, nil
+}
+
+func (parser *textQueryParser) peekKeyword(keyword string) bool {
+	pos := parser.pos
+	found := parser.keyword(keyword)
+	parser.pos = pos
+	return found
+}
+
+func (parser *textQueryParser) parseTerm() (*textQuery, error) {
+	switch parser.input[parser.pos] {
+	case '(':
+		parser.pos++
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if parser.skipSpace(); parser.pos >= len(parser.input) || parser.input[parser.pos] != ')' {
+			return nil, parser.errorf("missing )")
+		}
+		parser.pos++
+		return node, nil
+	case '"':
+		parser.pos++
+		start := parser.pos
+		for parser.pos < len(parser.input) && parser.input[parser.pos] != '"' {
+			parser.pos++
+		}
+		if parser.pos >= len(parser.input) {
+			return nil, parser.errorf("missing closing quote")
+		}
+		text := string(parser.input[start:parser.pos])
+		parser.pos++
+		return &textQuery{op: textPhrase, text: text}, nil
+	}
+
+	start := parser.pos
+	for parser.pos < len(parser.input) {
+		r := parser.input[parser.pos]
+		if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+			break
+		}
+		parser.pos++
+	}
+	text := string(parser.input[start:parser.pos])
+	if prefix, ok := strings.CutSuffix(text, "*"); ok {
+		if prefix == "" {
+			return nil, parser.errorf("empty prefix")
+		}
+		return &textQuery{op: textPrefix, text: prefix}, nil
+	}
+	return &textQuery{op: textTerm, text: text}, nil
+}
@@ -0,0 +1,170 @@
+package indexmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const TextIndexName = "text"
+
+type Place struct {
+	ID          int64
+	Name        string
+	Description string
+}
+
+func createPlaces() *IndexMap[int64, Place] {
+	imap := NewIndexMap(NewPrimaryIndex(func(value *Place) int64 {
+		return value.ID
+	}))
+	imap.Insert(
+		&Place{1, "San Francisco", "A city in California, famous for the Golden Gate bridge"},
+		&Place{2, "San Jose", "The largest city of the Silicon Valley"},
+		&Place{3, "Shanghai", "The largest city of China, on the Yangtze river delta"},
+		&Place{4, "Francistown", "The second largest city of Botswana"},
+		&Place{5, "Golden", "A city in Colorado, the gate to the Rocky Mountains"},
+	)
+	imap.AddIndex(TextIndexName, NewTextIndex(func(value *Place) []string {
+		return []string{value.Name, value.Description}
+	}, EnglishAnalyzer()))
+	return imap
+}
+
+func searchIDs(t *testing.T, imap *IndexMap[int64, Place], query string) []int64 {
+	values, err := imap.Search(TextIndexName, query)
+	assert.NoError(t, err, query)
+	ids := make([]int64, 0, len(values))
+	for _, value := range values {
+		ids = append(ids, value.ID)
+	}
+	return ids
+}
+
+func TestTextIndex_Search(t *testing.T) {
+	imap := createPlaces()
+
+	for query, expected := range map[string][]int64{
+		"san":                              {1, 2},
+		"SAN fran*":                        {1},
+		"fran*":                            {1, 4},
+		"largest city":                     {2, 3, 4},
+		"largest AND city":                 {2, 3, 4},
+		"china OR botswana":                {3, 4},
+		"largest (china OR botswana)":      {3, 4},
+		`"golden gate"`:                    {1},
+		"golden gate":                      {1, 5},
+		`"the largest city"`:               {2, 3, 4},
+		`"francisco a"`:                    {1},
+		"rivers":                           {3},
+		"the":                              {},
+		"the san":                          {1, 2},
+		"mountain OR (silicon valley)":     {2, 5},
+		`("san jose" OR shanghai) largest`: {2, 3},
+	} {
+		assert.ElementsMatch(t, expected, searchIDs(t, imap, query), query)
+	}
+
+	// phrases don't match across fields
+	assert.Empty(t, searchIDs(t, imap, `"francisco city"`))
+	assert.Equal(t, []int64{1}, searchIDs(t, imap, `"san francisco"`))
+
+	// GetAllBy sees the terms
+	assert.Equal(t, 2, len(imap.GetAllBy(TextIndexName, "San")))
+	assert.Nil(t, imap.GetAllBy(TextIndexName, 7))
+}
+
+func TestTextIndex_Update(t *testing.T) {
+	imap := createPlaces()
+
+	imap.Update(3, func(value *Place) (*Place, bool) {
+		value.Description = "The largest city of China, a financial hub"
+		return value, true
+	})
+	assert.Empty(t, searchIDs(t, imap, "river"))
+	assert.Equal(t, []int64{3}, searchIDs(t, imap, "financial"))
+
+	imap.Remove(1)
+	assert.Equal(t, []int64{2}, searchIDs(t, imap, "san"))
+	assert.Equal(t, []int64{5}, searchIDs(t, imap, "golden"))
+
+	imap.Insert(&Place{6, "Golden Gate Park", "A park in San Francisco"})
+	assert.ElementsMatch(t, []int64{5, 6}, searchIDs(t, imap, "golden"))
+
+	imap.Clear()
+	assert.Empty(t, searchIDs(t, imap, "golden"))
+	index := imap.indexes[TextIndexName].(*TextIndex[Place])
+	assert.Empty(t, index.postings)
+	assert.Zero(t, index.totalLen)
+}
+
+func TestTextIndex_PrefixNotStemmed(t *testing.T) {
+	imap := createPlaces()
+	imap.Insert(
+		&Place{6, "Running Track", "Runners are running here"},
+		&Place{7, "Bridges", "The bridges of the river"},
+	)
+
+	// the stem of running is run, the prefix matches the word
+	assert.Equal(t, []int64{6}, searchIDs(t, imap, "runnin*"))
+	assert.Equal(t, []int64{6}, searchIDs(t, imap, "runner*"))
+	assert.Equal(t, []int64{6}, searchIDs(t, imap, "running"))
+	assert.ElementsMatch(t, []int64{1, 7}, searchIDs(t, imap, "bridge*"))
+	assert.Equal(t, []int64{7}, searchIDs(t, imap, "bridges*"))
+	assert.Empty(t, searchIDs(t, imap, "rivers*"))
+
+	imap.Remove(6)
+	assert.Empty(t, searchIDs(t, imap, "runnin*"))
+	index := imap.indexes[TextIndexName].(*TextIndex[Place])
+	assert.NotContains(t, index.words, "running")
+	assert.Contains(t, index.words, "bridges")
+}
+
+func TestTextIndex_NamedLikeField(t *testing.T) {
+	imap := createPlaces()
+	imap.Insert(&Place{6, "Kennel", "golden retriever"})
+	imap.AddIndex("Description", NewTextIndex(func(value *Place) []string {
+		return []string{value.Description}
+	}, EnglishAnalyzer()))
+
+	// the field is compared, the index keys the words
+	result, err := imap.Query(`Description = "golden retriever"`)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, int64(6), result[0].ID)
+	plan, err := imap.Explain(`Description = "golden retriever"`)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "IndexLookup", plan.Op)
+}
+
+func TestTextIndex_SearchRanked(t *testing.T) {
+	imap := createPlaces()
+	imap.Insert(&Place{6, "Golden Gate Park", "A golden park near the Golden Gate"})
+
+	for _, scoring := range []Scoring{BM25, TFIDF} {
+		hits, err := imap.SearchRanked(TextIndexName, "golden", scoring)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(hits))
+		assert.Equal(t, int64(6), hits[0].Value.ID)
+		assert.GreaterOrEqual(t, hits[0].Score, hits[1].Score)
+		assert.GreaterOrEqual(t, hits[1].Score, hits[2].Score)
+	}
+
+	hits, err := imap.SearchRanked(TextIndexName, "city OR botswana", BM25)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), hits[0].Value.ID)
+}
+
+func TestTextIndex_Errors(t *testing.T) {
+	imap := createPlaces()
+
+	_, err := imap.Search(InvalidIndex, "san")
+	assert.ErrorIs(t, err, ErrUnknownName)
+	_, err = imap.SearchRanked(InvalidIndex, "san", BM25)
+	assert.ErrorIs(t, err, ErrUnknownName)
+
+	for _, query := range []string{"", "(san", "san)", `"san`, "*", "OR san", "san OR"} {
+		_, err = imap.Search(TextIndexName, query)
+		assert.ErrorIs(t, err, ErrInvalidQuery, query)
+	}
+}
@@ -0,0 +1,219 @@
+package indexmap
+
+// Tx is a transaction of a DB, see DB.Update and DB.View.
+// The tables are accessed by GetTxTable.
+type Tx struct {
+	tables map[string]dbTable
+	write  bool
+}
+
+// txLog records the modifications of the tables of a transaction.
+type txLog struct {
+	// undo the modifications in reverse order
+	undo []func()
+	// the change events delivered on commit
+	emits []func()
+}
+
+// Update runs fn in a transaction that may modify all tables of the DB,
+// they are locked for the whole transaction, together with the maps related to them by foreign keys.
+// If fn returns an error or panics, all modifications of the tables are rolled back,
+// including the cascades of foreign keys, and the error is returned.
+// The change events of the transaction are delivered after fn returns successfully.
+//
+// fn must only access the tables by GetTxTable, calling methods of the DB or the tables
+// will deadlock.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	tables := db.snapshotTables()
+	members := make([]groupMember, 0, len(tables))
+	for _, t := range tables {
+		members = append(members, t)
+	}
+	_, _, unlock := lockGroups(members...)
+	defer unlock()
+
+	log := &txLog{}
+	for _, t := range tables {
+		t.setTxLog(log)
+	}
+	committed := false
+	defer func() {
+		for _, t := range tables {
+			t.setTxLog(nil)
+		}
+		if !committed {
+			for i := len(log.undo) - 1; i >= 0; i-- {
+				log.undo[i]()
+			}
+			return
+		}
+		for _, emit := range log.emits {
+			emit()
+		}
+	}()
+
+	if err := fn(&Tx{tables: tables, write: true}); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// View runs fn in a read-only transaction, all tables of the DB are read locked
+// for the whole transaction, so fn sees a consistent state of them.
+// Modifying the tables fails with ErrReadOnly. The error of fn is returned.
+//
+// fn must only access the tables by GetTxTable, modifying the tables directly
+// will deadlock.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	tables := db.snapshotTables()
+	locks := make([]mapLock, 0, len(tables))
+	for _, t := range tables {
+		locks = append(locks, t.mapLock())
+	}
+	defer lockMaps(false, locks...)()
+
+	return fn(&Tx{tables: tables})
+}
+
+func (imap *IndexMap[K, V]) setTxLog(log *txLog) {
+	imap.txLog = log
+}
+
+// logPut records inserting the value into the primary index.
+func (imap *IndexMap[K, V]) logPut(value *V) {
+	if imap.txLog == nil {
+		return
+	}
+	imap.txLog.undo = append(imap.txLog.undo, func() {
+		imap.del(imap.primaryIndex.extractField(value))
+	})
+}
+
+// logDel records removing the value from the primary index,
+// it's restored as it is now, as it may be modified afterwards.
+func (imap *IndexMap[K, V]) logDel(old *V) {
+	if imap.txLog == nil {
+		return
+	}
+	snapshot := *old
+	imap.txLog.undo = append(imap.txLog.undo, func() {
+		*old = snapshot
+		imap.put(old)
+	})
+}
+
+// TxTable is a table of a DB accessed within a transaction,
+// it must not be used after the transaction function returned.
+// The methods are the ones of IndexMap, modifications report errors
+// like the Try methods of IndexMap.
+type TxTable[K comparable, V any] struct {
+	imap  *IndexMap[K, V]
+	write bool
+}
+
+// GetTxTable returns the table by name, it fails with ErrUnknownName if there is none,
+// and with ErrTableType if the table has other types.
+func GetTxTable[K comparable, V any](tx *Tx, name string) (*TxTable[K, V], error) {
+	imap, err := tableOf[K, V](tx.tables, name)
+	if err != nil {
+		return nil, err
+	}
+	return &TxTable[K, V]{imap: imap, write: tx.write}, nil
+}
+
+// checkWrite returns ErrReadOnly in read-only transactions.
+func (table *TxTable[K, V]) checkWrite() error {
+	if !table.write {
+		return ErrReadOnly
+	}
+	return table.imap.checkWrite()
+}
+
+// Get value by the primary key,
+// nil if key not exists.
+func (table *TxTable[K, V]) Get(key K) *V {
+	return table.imap.primaryIndex.get(key)
+}
+
+// Contains reports whether the value with given key exists.
+func (table *TxTable[K, V]) Contains(key K) bool {
+	return table.imap.primaryIndex.get(key) != nil
+}
+
+// GetAllBy returns all values seeked by the key,
+// nil if index or key not exists.
+func (table *TxTable[K, V]) GetAllBy(indexName string, key any) []*V {
+	values := table.imap.getAllBy(indexName, key)
+	if values.len() == 0 {
+		return nil
+	}
+	return values.collect()
+}
+
+// Range iterates over all the elements,
+// stops iteration if fn returns false,
+// no any guarantee to the order.
+func (table *TxTable[K, V]) Range(fn func(key K, value *V) bool) {
+	for k, v := range table.imap.primaryIndex.inner {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Len returns the number of values.
+func (table *TxTable[K, V]) Len() int {
+	return len(table.imap.primaryIndex.inner)
+}
+
+// Insert is IndexMap.TryInsert.
+func (table *TxTable[K, V]) Insert(values ...*V) error {
+	if err := table.checkWrite(); err != nil {
+		return err
+	}
+	return table.imap.insert(values...)
+}
+
+// Update is IndexMap.TryUpdate.
+func (table *TxTable[K, V]) Update(key K, updateFn UpdateFn[V]) (*V, error) {
+	if err := table.checkWrite(); err != nil {
+		return nil, err
+	}
+	return table.imap.update(key, func(old *V) *V {
+		value, _ := updateFn(old)
+		return value
+	})
+}
+
+// UpdateBy is IndexMap.TryUpdateBy.
+func (table *TxTable[K, V]) UpdateBy(indexName string, key any, updateFn UpdateFn[V]) error {
+	if err := table.checkWrite(); err != nil {
+		return err
+	}
+	return table.imap.updateBy(indexName, key, updateFn)
+}
+
+// Remove is IndexMap.TryRemove.
+func (table *TxTable[K, V]) Remove(keys ...K) error {
+	if err := table.checkWrite(); err != nil {
+		return err
+	}
+	return table.imap.remove(keys...)
+}
+
+// RemoveBy is IndexMap.TryRemoveBy.
+func (table *TxTable[K, V]) RemoveBy(indexName string, keys ...any) error {
+	if err := table.checkWrite(); err != nil {
+		return err
+	}
+	return table.imap.removeBy(indexName, keys...)
+}
+
+// Clear is IndexMap.TryClear.
+func (table *TxTable[K, V]) Clear() error {
+	if err := table.checkWrite(); err != nil {
+		return err
+	}
+	return table.imap.clear()
+}
@@ -0,0 +1,238 @@
+package indexmap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Update(t *testing.T) {
+	db := createDB(t)
+	orders, _ := GetTable[int64, Order](db, OrdersTable)
+
+	var changes []TableChange
+	db.OnChange(func(change TableChange) {
+		changes = append(changes, change)
+	})
+
+	err := db.Update(func(tx *Tx) error {
+		persons, err := GetTxTable[int64, Person](tx, PersonsTable)
+		if err != nil {
+			return err
+		}
+		orders, err := GetTxTable[int64, Order](tx, OrdersTable)
+		if err != nil {
+			return err
+		}
+		if err := persons.Insert(&Person{ID: 1000, Name: "New"}); err != nil {
+			return err
+		}
+		if err := orders.Insert(&Order{ID: 1000, PersonID: 1000}); err != nil {
+			return err
+		}
+		assert.Empty(t, changes, "delivered on commit")
+		assert.Len(t, orders.GetAllBy(OrderPersonFK, int64(1000)), 1)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, PersonsTable, changes[0].Table)
+	assert.Equal(t, OrdersTable, changes[1].Table)
+	assert.True(t, orders.Contains(1000))
+
+	_, err = GetTxTable[int64, Order](&Tx{tables: db.snapshotTables()}, PersonsTable)
+	assert.ErrorIs(t, err, ErrTableType)
+}
+
+func TestDB_UpdateView(t *testing.T) {
+	db := createDB(t)
+	persons, _ := GetTable[int64, Person](db, PersonsTable)
+	view := NewView(persons, func(value *Person) bool { return value.Age >= 18 }, func(value *Person) *Person {
+		projected := *value
+		return &projected
+	})
+	defer view.Close()
+	assert.ErrorIs(t, AddTable(db, "adults", view.IndexMap), ErrReadOnly)
+	assert.Equal(t, []string{OrdersTable, PersonsTable}, db.Tables())
+
+	// the view of a table is updated on commit
+	err := db.Update(func(tx *Tx) error {
+		persons, err := GetTxTable[int64, Person](tx, PersonsTable)
+		if err != nil {
+			return err
+		}
+		return persons.Insert(&Person{ID: 1000, Name: "New", Age: 40})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "New", view.Get(1000).Name)
+}
+
+func TestDB_UpdateRollback(t *testing.T) {
+	db := createDB(t)
+	persons, _ := GetTable[int64, Person](db, PersonsTable)
+	orders, _ := GetTable[int64, Order](db, OrdersTable)
+	persons.AddOrdering("age", func(value1, value2 *Person) int {
+		return value1.Age - value2.Age
+	})
+	expectedPersons, expectedOrders := persons.CollectValues(), orders.CollectValues()
+	personCopies := make(map[int64]Person)
+	for _, person := range expectedPersons {
+		personCopies[person.ID] = *person
+	}
+	city := expectedPersons[0].City
+	inCity := len(persons.GetAllBy(CityIndex, city))
+	var renamed int64
+	for _, person := range expectedPersons {
+		// persons from 50 on have no orders, renaming them is fine
+		if person.ID >= 50 && person.City != city {
+			renamed = person.ID
+			break
+		}
+	}
+
+	var changes int
+	db.OnChange(func(change TableChange) {
+		changes++
+	})
+
+	errFailed := errors.New("failed")
+	err := db.Update(func(tx *Tx) error {
+		persons, _ := GetTxTable[int64, Person](tx, PersonsTable)
+		orders, _ := GetTxTable[int64, Order](tx, OrdersTable)
+
+		// cascades into orders
+		assert.NoError(t, persons.Remove(1, 2))
+		assert.NoError(t, persons.RemoveBy(CityIndex, city))
+		_, err := persons.Update(renamed, func(value *Person) (*Person, bool) {
+			value.ID = 2000
+			value.Age = 200
+			return value, true
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, persons.UpdateBy(CityIndex, expectedPersons[1].City, func(value *Person) (*Person, bool) {
+			value.City = "Nowhere"
+			return value, true
+		}))
+		assert.NoError(t, persons.Insert(&Person{ID: 4, Name: "Replaced"}, &Person{ID: 3000}))
+		// failed operations are rolled back by themselves
+		assert.ErrorIs(t, orders.Insert(&Order{ID: 5000, PersonID: 1}), ErrForeignKey)
+		assert.NoError(t, orders.Insert(&Order{ID: 5000, PersonID: 3000}))
+		assert.NoError(t, persons.Clear())
+		assert.Zero(t, orders.Len())
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	assert.Zero(t, changes)
+
+	assert.ElementsMatch(t, expectedPersons, persons.CollectValues())
+	assert.ElementsMatch(t, expectedOrders, orders.CollectValues())
+	for _, person := range expectedPersons {
+		assert.Equal(t, personCopies[person.ID], *person)
+	}
+	assert.Len(t, persons.GetAllBy(CityIndex, city), inCity)
+	assert.Len(t, orders.GetAllBy(OrderPersonFK, int64(1)), 6)
+	assertOrdered(t, persons)
+	assertNoOrphans(t, persons, orders)
+
+	// panics roll back as well
+	assert.Panics(t, func() {
+		_ = db.Update(func(tx *Tx) error {
+			persons, _ := GetTxTable[int64, Person](tx, PersonsTable)
+			_ = persons.Clear()
+			panic("failed")
+		})
+	})
+	assert.Equal(t, 100, persons.Len())
+	assert.Equal(t, 300, orders.Len())
+	assert.Zero(t, changes)
+}
+
+func assertOrdered(t *testing.T, persons *IndexMap[int64, Person]) {
+	age, n := -1, 0
+	persons.RangeOrderedBy("age", func(_ int64, value *Person) bool {
+		assert.LessOrEqual(t, age, value.Age)
+		age = value.Age
+		n++
+		return true
+	})
+	assert.Equal(t, persons.Len(), n)
+}
+
+func TestDB_View(t *testing.T) {
+	db := createDB(t)
+
+	err := db.View(func(tx *Tx) error {
+		persons, _ := GetTxTable[int64, Person](tx, PersonsTable)
+		orders, err := GetTxTable[int64, Order](tx, OrdersTable)
+		assert.Equal(t, 100, persons.Len())
+		assert.True(t, persons.Contains(1))
+		assert.Equal(t, int64(1), persons.Get(1).ID)
+		n := 0
+		orders.Range(func(_ int64, value *Order) bool {
+			n++
+			return true
+		})
+		assert.Equal(t, 300, n)
+		assert.ErrorIs(t, persons.Remove(1), ErrReadOnly)
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func TestDB_Concurrent(t *testing.T) {
+	db := createDB(t)
+	persons, _ := GetTable[int64, Person](db, PersonsTable)
+	orders, _ := GetTable[int64, Order](db, OrdersTable)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id := int64(i*1000 + j)
+				_ = db.Update(func(tx *Tx) error {
+					persons, _ := GetTxTable[int64, Person](tx, PersonsTable)
+					orders, _ := GetTxTable[int64, Order](tx, OrdersTable)
+					if err := persons.Insert(&Person{ID: id}); err != nil {
+						return err
+					}
+					if err := orders.Insert(&Order{ID: id, PersonID: id}); err != nil {
+						return err
+					}
+					if j%2 == 0 {
+						return errors.New("rollback")
+					}
+					return nil
+				})
+			}
+		}(i + 1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				persons.Remove(int64(i*25 + j%25))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = db.View(func(tx *Tx) error {
+					persons, _ := GetTxTable[int64, Person](tx, PersonsTable)
+					orders, _ := GetTxTable[int64, Order](tx, OrdersTable)
+					orders.Range(func(_ int64, value *Order) bool {
+						assert.True(t, persons.Contains(value.PersonID))
+						return true
+					})
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	assertNoOrphans(t, persons, orders)
+	// the initial persons are removed, half of the transactions are committed
+	assert.Equal(t, 100, persons.Len())
+	assert.Equal(t, 100, orders.Len())
+}
@@ -129,3 +129,11 @@ func TestCreateJsons(t *testing.T) {
 		os.WriteFile("jsonfiles/person_"+strconv.Itoa(i)+".json", jsonByte, 0666)
 	}
 }
+
+func InsertRandomDataFrom(imap *IndexMap[int64, Person], start, n int) {
+	myRand := rand.New(rand.NewSource(int64(start)))
+	for i := range n {
+		p := createRandomPerson(int64(start+i), myRand)
+		imap.Insert(p)
+	}
+}
@@ -0,0 +1,87 @@
+package indexmap
+
+// View is a read-only IndexMap derived from a source IndexMap,
+// it holds the projections of the source values the filter holds for,
+// under the same primary keys.
+// The view is updated automatically on every change of the source,
+// the changes of one operation like RemoveBy are applied at once,
+// so readers never see a partially applied operation.
+// The view is locked together with the source and the maps related to it by foreign keys,
+// so it can be joined with them.
+// Secondary indexes, orderings, aggregates and change listeners can be added to the
+// view as usual, modifying its values fails with ErrReadOnly:
+// the Try methods return it, the other methods panic with it.
+type View[K comparable, W any] struct {
+	*IndexMap[K, W]
+
+	// the primary keys of the projections, as W doesn't need to contain them
+	keys   map[*W]K
+	cancel func()
+}
+
+// NewView creates a view of the source values the filter holds for,
+// a nil filter takes all values.
+// project derives the value of the view, it must not return nil.
+// filter and project are called while the source is locked,
+// they must not call methods of the source, or else it will deadlock.
+// Modifying the source from a callback of the view, i.e. Range,
+// will deadlock as well.
+func NewView[K comparable, V, W any](source *IndexMap[K, V], filter func(value *V) bool, project func(value *V) *W) *View[K, W] {
+	view := &View[K, W]{keys: make(map[*W]K)}
+	view.IndexMap = NewIndexMap(NewPrimaryIndex(func(value *W) K {
+		return view.keys[value]
+	}))
+	view.readOnly = true
+
+	add := func(key K, value *V) *W {
+		if filter != nil && !filter(value) {
+			return nil
+		}
+		projected := project(value)
+		view.keys[projected] = key
+		view.put(projected)
+		return projected
+	}
+
+	// the source locks the view with its group
+	apply := func(changes []Change[K, V]) {
+		var viewChanges []Change[K, W]
+		for _, change := range changes {
+			var old, projected *W
+			if change.Kind != Inserted {
+				if old = view.del(change.OldKey); old != nil {
+					delete(view.keys, old)
+				}
+			}
+			if change.Kind != Removed {
+				projected = add(change.NewKey, change.New)
+			}
+
+			switch {
+			case old != nil && projected != nil:
+				viewChanges = append(viewChanges, Change[K, W]{Kind: Updated, OldKey: change.OldKey, NewKey: change.NewKey, Old: old, New: projected})
+			case old != nil:
+				viewChanges = append(viewChanges, Change[K, W]{Kind: Removed, OldKey: change.OldKey, Old: old})
+			case projected != nil:
+				viewChanges = append(viewChanges, Change[K, W]{Kind: Inserted, NewKey: change.NewKey, New: projected})
+			}
+		}
+		view.emit(viewChanges...)
+	}
+
+	unlock := joinGroups(source, view.IndexMap)
+	defer unlock()
+
+	source.primaryIndex.iterate(func(key K, value *V) {
+		add(key, value)
+	})
+	view.cancel = source.listen(listener[K, V]{batch: apply})
+	return view
+}
+
+// Close detaches the view from its source,
+// it keeps the values it holds but isn't updated any more.
+// It stays locked together with the source.
+func (view *View[K, W]) Close() {
+	view.cancel()
+}
@@ -0,0 +1,250 @@
+package indexmap
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Summary struct {
+	Name string
+	City string
+}
+
+func summarize(value *Person) *Summary {
+	return &Summary{Name: value.Name, City: value.City}
+}
+
+func isSenior(value *Person) bool {
+	return value.Age >= 60
+}
+
+func checkView(t *testing.T, source *IndexMap[int64, Person], view *View[int64, Summary]) {
+	count := 0
+	source.Range(func(key int64, value *Person) bool {
+		summary := view.Get(key)
+		if !isSenior(value) {
+			assert.Nil(t, summary, key)
+			return true
+		}
+		count++
+		assert.Equal(t, summarize(value), summary, key)
+		if summary != nil {
+			assert.Equal(t, key, view.PrimaryKey(summary))
+		}
+		return true
+	})
+	assert.Equal(t, count, view.Len())
+	for _, city := range cities {
+		seniors := 0
+		for _, person := range source.GetAllBy(CityIndex, city) {
+			if isSenior(person) {
+				seniors++
+			}
+		}
+		assert.Len(t, view.GetAllBy(CityIndex, city), seniors, city)
+	}
+}
+
+func TestView(t *testing.T) {
+	source := CreateTestMap(1000)
+	view := NewView(source, isSenior, summarize)
+	view.AddIndex(CityIndex, NewSecondaryIndex(func(value *Summary) []any {
+		return []any{value.City}
+	}))
+	checkView(t, source, view)
+
+	var changes []Change[int64, Summary]
+	view.OnChange(func(change Change[int64, Summary]) {
+		changes = append(changes, change)
+	})
+
+	myRand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		id := int64(myRand.Intn(1000))
+		switch myRand.Intn(4) {
+		case 0:
+			source.Remove(id)
+		case 1:
+			source.Update(id, func(value *Person) (*Person, bool) {
+				if value == nil {
+					return nil, false
+				}
+				value.Age = myRand.Intn(100)
+				value.City = cities[myRand.Intn(len(cities))]
+				return value, true
+			})
+		case 2:
+			// renames
+			source.Update(id, func(value *Person) (*Person, bool) {
+				if value == nil {
+					return nil, false
+				}
+				value.ID += 1000
+				return value, true
+			})
+		default:
+			InsertRandomDataFrom(source, int(id), 1)
+		}
+	}
+	checkView(t, source, view)
+	assert.NotEmpty(t, changes)
+
+	source.RemoveBy(CityIndex, cities[0])
+	assert.Empty(t, view.GetAllBy(CityIndex, cities[0]))
+	checkView(t, source, view)
+
+	// detached
+	view.Close()
+	n := view.Len()
+	source.Clear()
+	assert.Equal(t, n, view.Len())
+	assert.Zero(t, source.Len())
+}
+
+func TestView_Changes(t *testing.T) {
+	source := CreateTestMap(0)
+	source.Insert(&Person{ID: 1, Name: "Ashe", Age: 70})
+	view := NewView(source, isSenior, summarize)
+	changes := recordViewChanges(view)
+
+	source.Insert(&Person{ID: 2, Name: "Bob", Age: 10})
+	assert.Empty(t, *changes)
+
+	source.Update(2, func(value *Person) (*Person, bool) {
+		value.Age = 80
+		return value, true
+	})
+	source.Update(1, func(value *Person) (*Person, bool) {
+		value.Age = 50
+		return value, true
+	})
+	source.Update(2, func(value *Person) (*Person, bool) {
+		value.ID = 3
+		return value, true
+	})
+	source.Remove(3)
+
+	kinds := make([]ChangeKind, len(*changes))
+	for i, change := range *changes {
+		kinds[i] = change.Kind
+	}
+	assert.Equal(t, []ChangeKind{Inserted, Removed, Updated, Removed}, kinds)
+	assert.Equal(t, int64(2), (*changes)[2].OldKey)
+	assert.Equal(t, int64(3), (*changes)[2].NewKey)
+	assert.Zero(t, view.Len())
+}
+
+func recordViewChanges(view *View[int64, Summary]) *[]Change[int64, Summary] {
+	changes := &[]Change[int64, Summary]{}
+	view.OnChange(func(change Change[int64, Summary]) {
+		*changes = append(*changes, change)
+	})
+	return changes
+}
+
+func TestView_ReadOnly(t *testing.T) {
+	source := CreateTestMap(10)
+	view := NewView(source, nil, summarize)
+	assert.Equal(t, 10, view.Len())
+
+	assert.PanicsWithValue(t, ErrReadOnly, func() { view.Insert(&Summary{}) })
+	assert.PanicsWithValue(t, ErrReadOnly, func() { view.Remove(1) })
+	assert.PanicsWithValue(t, ErrReadOnly, func() { view.Clear() })
+	assert.PanicsWithValue(t, ErrReadOnly, func() {
+		view.Update(1, func(value *Summary) (*Summary, bool) { return value, true })
+	})
+	assert.PanicsWithValue(t, ErrReadOnly, func() { view.BulkInsert(&Summary{}) })
+
+	// the Try methods and the methods returning errors don't panic
+	assert.ErrorIs(t, view.TryInsert(&Summary{}), ErrReadOnly)
+	assert.ErrorIs(t, view.TryRemove(1), ErrReadOnly)
+	assert.ErrorIs(t, view.TryRemoveBy(NameIndex, "Alice"), ErrReadOnly)
+	assert.ErrorIs(t, view.TryClear(), ErrReadOnly)
+	assert.ErrorIs(t, view.TryBulkInsert(&Summary{}), ErrReadOnly)
+	assert.ErrorIs(t, view.BulkLoad([]*Summary{{}}), ErrReadOnly)
+	assert.ErrorIs(t, view.UnmarshalJSON([]byte("{}")), ErrReadOnly)
+	_, err := view.TryUpdate(1, func(value *Summary) (*Summary, bool) { return value, true })
+	assert.ErrorIs(t, err, ErrReadOnly)
+	err = view.TryUpdateBy(NameIndex, "Alice", func(value *Summary) (*Summary, bool) { return value, true })
+	assert.ErrorIs(t, err, ErrReadOnly)
+	_, err = view.TryUpsert(&Summary{}, nil)
+	assert.ErrorIs(t, err, ErrReadOnly)
+	_, err = view.TryCompute(1, func(key int64, old *Summary) *Summary { return old })
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.Equal(t, 10, view.Len())
+
+	// views of views
+	names := NewView(view.IndexMap, nil, func(value *Summary) *string {
+		return &value.Name
+	})
+	source.Remove(0, 1)
+	assert.Equal(t, 8, names.Len())
+}
+
+func TestView_Atomic(t *testing.T) {
+	source := CreateTestMap(0)
+	for i := 0; i < 100; i++ {
+		source.Insert(&Person{ID: int64(i), Age: 70, City: "Berlin"})
+	}
+	view := NewView(source, isSenior, summarize)
+	persons := source.CollectValues()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			source.RemoveBy(CityIndex, "Berlin")
+			source.Insert(persons...)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if n := view.Len(); n != 0 && n != 100 {
+			assert.Fail(t, "partially applied", "%d values", n)
+			break
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, 100, view.Len())
+}
+
+func TestView_JoinLockOrder(t *testing.T) {
+	persons := CreateTestMap(100)
+	view := NewView(persons, isSenior, summarize)
+	// created after the view, so it's locked after it
+	orders := createOrderMap(100, 0)
+	assert.NoError(t, AddForeignKey(OrderPersonFK, orders, persons, orderPersonFK(Cascade)))
+	for i := 0; i < 100; i++ {
+		orders.Insert(&Order{ID: int64(i), PersonID: int64(i)})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				persons.Insert(&Person{ID: int64(i % 100), Age: 60 + i%2})
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			for range InnerJoin(orders, view.IndexMap, func(value *Order) any {
+				return value.PersonID
+			}, PrimaryKeyName) {
+			}
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		assert.FailNow(t, "deadlock")
+	}
+	checkView(t, persons, view)
+}
@@ -0,0 +1,307 @@
+package indexmap
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operator compares a field in Where.
+type Operator int
+
+const (
+	// Eq matches fields equal to the value.
+	Eq Operator = iota + 1
+	// Ne matches fields not equal to the value.
+	Ne
+	// Lt matches fields less than the value.
+	Lt
+	// Le matches fields less than or equal to the value.
+	Le
+	// Gt matches fields greater than the value.
+	Gt
+	// Ge matches fields greater than or equal to the value.
+	Ge
+	// In matches fields equal to any element of the value, a slice or array.
+	In
+	// Contains matches string fields containing the value as substring,
+	// and slice fields with an element equal to the value.
+	Contains
+	// Regex matches string fields by the value, a pattern or a *regexp.Regexp.
+	Regex
+)
+
+func (op Operator) String() string {
+	switch op {
+	case Eq:
+		return "="
+	case Ne:
+		return "!="
+	case Lt:
+		return "<"
+	case Le:
+		return "<="
+	case Gt:
+		return ">"
+	case Ge:
+		return ">="
+	case In:
+		return "IN"
+	case Contains:
+		return "CONTAINS"
+	case Regex:
+		return "REGEX"
+	}
+	return "unknown"
+}
+
+// Where returns the values whose field by path compares to the value by the operator,
+// like
+//
+//	imap.Where("Age", indexmap.Gt, 30)
+//	imap.Where("Address.City", indexmap.Eq, "SF")
+//
+// The path names exported fields, matched case-insensitively, nested fields
+// are separated by dots. The fields are read by reflection and compared like
+// the fields of Query, so slices match if any element matches and nil matches nil pointers.
+// The values are scanned, unless a SecondaryIndex is named like the path,
+// it's expected to index the field and looked up then, see Query.
+// Contains and Regex always scan.
+//
+// Unknown fields and values not comparable with the field are reported with ErrInvalidQuery.
+func (imap *IndexMap[K, V]) Where(path string, op Operator, value any) ([]*V, error) {
+	imap.lock.RLock()
+	defer imap.lock.RUnlock()
+
+	cond, err := whereCond(imap, path, op, value)
+	if err != nil {
+		return nil, err
+	}
+	_, result := (&compiledQuery[K, V]{imap: imap, where: cond, limit: -1}).run()
+	return result, nil
+}
+
+// whereCond compiles a predicate of Where to a condition of a query,
+// the caller holds the lock of the map.
+func whereCond[K comparable, V any](imap *IndexMap[K, V], path string, op Operator, value any) (*queryCond[V], error) {
+	if op < Eq || op > Regex {
+		return nil, fmt.Errorf("%w: %s: unknown operator %d", ErrInvalidQuery, path, int(op))
+	}
+	cond := &queryCond[V]{op: queryCompare, compare: op.String()}
+	if op == In {
+		cond.op, cond.compare = queryIn, ""
+		values := reflect.ValueOf(value)
+		if value == nil || (values.Kind() != reflect.Slice && values.Kind() != reflect.Array) {
+			return nil, fmt.Errorf("%w: %s IN takes a slice, got %#v", ErrInvalidQuery, path, value)
+		}
+		for i := 0; i < values.Len(); i++ {
+			literal, err := whereLiteral(values.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrInvalidQuery, path, err)
+			}
+			cond.literals = append(cond.literals, literal)
+		}
+	} else if op != Regex {
+		literal, err := whereLiteral(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidQuery, path, err)
+		}
+		cond.literals = []any{literal}
+	}
+	cond.text = whereText(path, op, value, cond.literals)
+
+	if op != Contains && op != Regex {
+		cond.index = imap.fieldIndex(path)
+	}
+
+	accessor, err := accessorOf(reflect.TypeOf((*V)(nil)).Elem(), path)
+	if err != nil {
+		if cond.index != nil {
+			return cond, nil
+		}
+		return nil, fmt.Errorf("%w: unknown field %s: %s", ErrInvalidQuery, strconv.Quote(path), err)
+	}
+
+	switch op {
+	case Contains:
+		cond.match, err = containsMatch[V](accessor, cond.literals[0])
+	case Regex:
+		cond.match, err = regexMatch[V](accessor, value)
+	default:
+		literals := make([]any, len(cond.literals))
+		for i, literal := range cond.literals {
+			if literals[i], err = literalFor(accessor.typ, literal); err != nil {
+				if cond.index != nil {
+					return cond, nil
+				}
+				break
+			}
+		}
+		cond.match = fieldMatch[V](accessor, literals, comparison(cond.compare))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidQuery, path, err)
+	}
+	return cond, nil
+}
+
+// fieldIndex returns the SecondaryIndex named like the path, nil if there is none.
+// The name is matched case-insensitively if there is no index with the exact name.
+func (imap *IndexMap[K, V]) fieldIndex(path string) keyedIndex[V] {
+	if index, ok := imap.indexes[path].(*SecondaryIndex[V]); ok {
+		return index
+	}
+	var found keyedIndex[V]
+	for name, index := range imap.indexes {
+		if secondary, ok := index.(*SecondaryIndex[V]); ok && strings.EqualFold(name, path) {
+			if found != nil {
+				// ambiguous
+				return nil
+			}
+			found = secondary
+		}
+	}
+	return found
+}
+
+// whereLiteral converts a value of Where to a literal of a query,
+// i.e. integers to int64 and floats to float64, pointers are dereferenced.
+func whereLiteral(value any) (any, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, nil
+	}
+
+	switch kind := v.Kind(); {
+	case reflect.Int <= kind && kind <= reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint <= kind && kind <= reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return float64(v.Uint()), nil
+		}
+		return int64(v.Uint()), nil
+	case kind == reflect.Float32 || kind == reflect.Float64:
+		return v.Float(), nil
+	case kind == reflect.String:
+		return v.String(), nil
+	case kind == reflect.Bool:
+		return v.Bool(), nil
+	}
+	return nil, fmt.Errorf("can't compare with %#v", value)
+}
+
+// whereText formats the predicate for Explain, like a condition of a query.
+func whereText(path string, op Operator, value any, literals []any) string {
+	format := func(literal any) string {
+		switch literal := literal.(type) {
+		case nil:
+			return "null"
+		case string:
+			return strconv.Quote(literal)
+		case time.Time:
+			return strconv.Quote(literal.Format(time.RFC3339Nano))
+		}
+		return fmt.Sprint(literal)
+	}
+	switch op {
+	case In:
+		texts := make([]string, len(literals))
+		for i, literal := range literals {
+			texts[i] = format(literal)
+		}
+		return fmt.Sprintf("%s IN (%s)", path, strings.Join(texts, ", "))
+	case Regex:
+		if re, ok := value.(*regexp.Regexp); ok {
+			value = re.String()
+		}
+		return fmt.Sprintf("%s REGEX %s", path, format(value))
+	}
+	return fmt.Sprintf("%s %s %s", path, op, format(literals[0]))
+}
+
+// containsMatch matches string fields containing the literal, and slices containing it.
+func containsMatch[V any](accessor *fieldAccessor, literal any) (func(value *V) bool, error) {
+	typ := accessor.typ
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.String {
+		substr, ok := literal.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't search %#v in %s", literal, typ)
+		}
+		return stringMatch[V](accessor, func(s string) bool {
+			return strings.Contains(s, substr)
+		}), nil
+	}
+
+	if (typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array) || typ.Elem().Kind() == reflect.Uint8 {
+		return nil, fmt.Errorf("%s is no string or slice", typ)
+	}
+	element, err := literalFor(typ.Elem(), literal)
+	if err != nil {
+		return nil, err
+	}
+	return fieldMatch[V](accessor, []any{element}, comparison("=")), nil
+}
+
+// regexMatch matches string fields, or any element of string slices, by the pattern.
+func regexMatch[V any](accessor *fieldAccessor, pattern any) (func(value *V) bool, error) {
+	var re *regexp.Regexp
+	switch pattern := pattern.(type) {
+	case *regexp.Regexp:
+		re = pattern
+	case string:
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("REGEX takes a string or *regexp.Regexp, got %#v", pattern)
+	}
+
+	typ := accessor.typ
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.String {
+		return nil, fmt.Errorf("can't match %s by REGEX", accessor.typ)
+	}
+	return stringMatch[V](accessor, re.MatchString), nil
+}
+
+// stringMatch matches string fields, or any element of string slices, by fn.
+func stringMatch[V any](accessor *fieldAccessor, fn func(s string) bool) func(value *V) bool {
+	var match func(field reflect.Value) bool
+	match = func(field reflect.Value) bool {
+		switch field.Kind() {
+		case reflect.Pointer:
+			return !field.IsNil() && match(field.Elem())
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < field.Len(); i++ {
+				if match(field.Index(i)) {
+					return true
+				}
+			}
+			return false
+		}
+		return fn(field.String())
+	}
+	return func(value *V) bool {
+		field, ok := accessor.get(reflect.ValueOf(value).Elem())
+		return ok && match(field)
+	}
+}
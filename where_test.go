@@ -0,0 +1,112 @@
+package indexmap
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexMap_Where(t *testing.T) {
+	imap := CreateTestMap(1000)
+	city := imap.Get(1).City
+
+	tests := []struct {
+		path   string
+		op     Operator
+		value  any
+		filter func(value *Person) bool
+	}{
+		{"Age", Gt, 30, func(value *Person) bool { return value.Age > 30 }},
+		{"age", Le, uint8(30), func(value *Person) bool { return value.Age <= 30 }},
+		{"Age", Lt, 10.5, func(value *Person) bool { return value.Age <= 10 }},
+		{"Age", Ne, 20, func(value *Person) bool { return value.Age != 20 }},
+		{"City", Eq, city, func(value *Person) bool { return value.City == city }},
+		{"City", In, []string{city, "Venice"}, func(value *Person) bool { return value.City == city || value.City == "Venice" }},
+		{"Age", In, [2]int{1, 2}, func(value *Person) bool { return value.Age == 1 || value.Age == 2 }},
+		{"Name", Contains, "ar", func(value *Person) bool { return strings.Contains(value.Name, "ar") }},
+		{"Like", Contains, "Mary", func(value *Person) bool { return slices.Contains(value.Like, "Mary") }},
+		{"Name", Regex, "^J.*s$", func(value *Person) bool {
+			return strings.HasPrefix(value.Name, "J") && strings.HasSuffix(value.Name, "s")
+		}},
+		{"Like", Regex, regexp.MustCompile("^Ma"), func(value *Person) bool {
+			return slices.ContainsFunc(value.Like, func(like string) bool { return strings.HasPrefix(like, "Ma") })
+		}},
+		{"Like", Eq, nil, func(value *Person) bool { return value.Like == nil }},
+	}
+	for _, test := range tests {
+		result, err := imap.Where(test.path, test.op, test.value)
+		assert.NoError(t, err, test.path, test.op)
+		assert.ElementsMatch(t, filterPersons(imap, test.filter), result, test.path, test.op)
+	}
+}
+
+func TestIndexMap_WhereFields(t *testing.T) {
+	customers := createCustomers()
+	count := func(path string, op Operator, value any) int {
+		result, err := customers.Where(path, op, value)
+		assert.NoError(t, err, path, op)
+		return len(result)
+	}
+
+	assert.Equal(t, 20, count("Address.City", Eq, cities[1]))
+	assert.Equal(t, 10, count("Address.City", Eq, nil))
+	assert.Equal(t, 90, count("address.street", Contains, "ai"))
+	assert.Equal(t, 34, count("Tags", Contains, "vip"))
+	assert.Equal(t, 12, count("Since", Lt, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 12, count("Since", Lt, "2021-01-01"))
+	assert.Equal(t, 50, count("Active", Eq, true))
+	assert.Equal(t, 50, count("Score", Ge, float32(5)))
+}
+
+func TestIndexMap_WhereIndex(t *testing.T) {
+	imap := CreateTestMap(1000)
+	// named like the field, but indexes nothing, so a lookup finds nothing
+	imap.AddIndex("Age", NewSecondaryIndex(func(value *Person) []any {
+		return nil
+	}))
+	result, err := imap.Where("age", Eq, 30)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+	// Contains always scans
+	result, err = imap.Where("name", Contains, "a")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result)
+
+	// index only
+	imap.AddIndex("town", NewSecondaryIndex(func(value *Person) []any {
+		return []any{value.City}
+	}))
+	result, err = imap.Where("Town", Eq, "Venice")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, imap.GetAllBy(CityIndex, "Venice"), result)
+}
+
+func TestIndexMap_WhereErrors(t *testing.T) {
+	imap := CreateTestMap(10)
+
+	tests := []struct {
+		path    string
+		op      Operator
+		value   any
+		message string
+	}{
+		{"Unknown", Eq, 1, `indexmap: invalid query: unknown field "Unknown": indexmap.Person has no field Unknown`},
+		{"Age", Eq, "old", `indexmap: invalid query: Age: can't compare int with "old"`},
+		{"Age", In, 1, `indexmap: invalid query: Age IN takes a slice, got 1`},
+		{"Age", Eq, struct{}{}, `indexmap: invalid query: Age: can't compare with struct {}{}`},
+		{"Age", Contains, 1, `indexmap: invalid query: Age: int is no string or slice`},
+		{"Name", Contains, 1, `indexmap: invalid query: Name: can't search 1 in string`},
+		{"Name", Regex, "(", "indexmap: invalid query: Name: error parsing regexp: missing closing ): `(`"},
+		{"Age", Regex, "1", `indexmap: invalid query: Age: can't match int by REGEX`},
+		{"Age", Operator(0), 1, `indexmap: invalid query: Age: unknown operator 0`},
+	}
+	for _, test := range tests {
+		_, err := imap.Where(test.path, test.op, test.value)
+		assert.ErrorIs(t, err, ErrInvalidQuery, test.path, test.op)
+		assert.EqualError(t, err, test.message)
+	}
+}